@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// AuditTopic is the topic on which the overseer publishes an AuditEvent for every method request
+// denied by its access policy.
+const AuditTopic = "overseer:audit"
+
+// AccessRule allows Caller to call Methods on Subsystem. Every field is a path.Match pattern, so
+// "*" matches any caller, subsystem or method, and "get_*" any method starting with "get_".
+type AccessRule struct {
+	Caller    string   `json:"caller"`
+	Subsystem string   `json:"subsystem"`
+	Methods   []string `json:"methods"`
+}
+
+// AccessPolicy decides which callers may call which methods. A request is allowed if any rule
+// allows it, so a policy without rules denies everything.
+//
+// A request made with the ctx of a call the overseer is serving, as SubsystemMethodCtx and the
+// SubsystemLibrary do, is attributed to the subsystem serving that call, whatever caller it
+// names. Other requests are attributed to the caller they name, see MethodRequest.Caller, so the
+// policy keeps subsystems from calling methods they are not meant to, but does not authenticate
+// code holding the bus.
+type AccessPolicy struct {
+	Rules []AccessRule `json:"rules"`
+}
+
+// AuditEvent is published on AuditTopic when the access policy denies a request.
+type AuditEvent struct {
+	Caller    string
+	Subsystem string
+	Method    string
+	RequestID string
+	Time      time.Time
+}
+
+// Validate checks that every pattern of the policy is well-formed.
+func (p *AccessPolicy) Validate() error {
+	for i, rule := range p.Rules {
+		patterns := append([]string{rule.Caller, rule.Subsystem}, rule.Methods...)
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Allows reports whether caller may call method on subsystem.
+func (p *AccessPolicy) Allows(caller string, subsystem string, method string) bool {
+	for _, rule := range p.Rules {
+		if !match(rule.Caller, caller) || !match(rule.Subsystem, subsystem) {
+			continue
+		}
+		for _, pattern := range rule.Methods {
+			if match(pattern, method) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match is path.Match for patterns that passed Validate.
+func match(pattern string, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// SetAccessPolicy restricts the methods callers may call to those allowed by policy. Requests it
+// denies fail with ErrPermissionDenied and are published on AuditTopic. A nil policy, the
+// default, allows every request.
+func (s *Overseer) SetAccessPolicy(policy *AccessPolicy) error {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("invalid access policy: %w", err)
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.policy = policy
+	return nil
+}
+
+// attributeCaller sets the caller of a request made by a call the overseer is serving to the
+// subsystem serving that call.
+func (s *Overseer) attributeCaller(methodRequest MethodRequest) MethodRequest {
+	if methodRequest.ParentID == "" {
+		return methodRequest
+	}
+	if entry, ok := s.inflight.Load(methodRequest.ParentID); ok {
+		if parent, ok := entry.(*inflightRequest); ok {
+			methodRequest.Caller = parent.request.Subsystem
+		}
+	}
+	return methodRequest
+}
+
+// authorize reports whether the access policy allows methodRequest, and publishes an AuditEvent
+// if it does not.
+func (s *Overseer) authorize(methodRequest MethodRequest) bool {
+	s.lock.RLock()
+	policy := s.policy
+	s.lock.RUnlock()
+	if policy == nil || policy.Allows(methodRequest.Caller, methodRequest.Subsystem, methodRequest.Method) {
+		return true
+	}
+	s.eventBus.Publish(AuditTopic, AuditEvent{
+		Caller:    methodRequest.Caller,
+		Subsystem: methodRequest.Subsystem,
+		Method:    methodRequest.Method,
+		RequestID: methodRequest.ID,
+		Time:      time.Now(),
+	})
+	return false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"overseer/eventbus"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessPolicyAllows(t *testing.T) {
+	policy := &AccessPolicy{Rules: []AccessRule{
+		{Caller: "plugin", Subsystem: "store", Methods: []string{"get_*"}},
+		{Caller: "admin", Subsystem: "*", Methods: []string{"*"}},
+	}}
+	require.NoError(t, policy.Validate())
+
+	for _, tc := range []struct {
+		caller, subsystem, method string
+		allowed                   bool
+	}{
+		{"plugin", "store", "get_block", true},
+		{"plugin", "store", "put_block", false},
+		{"plugin", "wallet", "get_balance", false},
+		{"admin", "wallet", "transfer", true},
+		{"", "store", "get_block", false},
+	} {
+		require.Equal(t, tc.allowed, policy.Allows(tc.caller, tc.subsystem, tc.method), "%+v", tc)
+	}
+
+	require.False(t, (&AccessPolicy{}).Allows("admin", "store", "get_block"))
+	require.Error(t, (&AccessPolicy{Rules: []AccessRule{{Caller: "[", Subsystem: "*"}}}).Validate())
+}
+
+func TestAccessPolicyDeniesRequests(t *testing.T) {
+	bus := eventbus.New()
+	overseer := NewOverseer(bus, NewBaseSubsystem(&recordingSubsystem{name: "store", recorder: &recorder{}}))
+	require.NoError(t, overseer.StartAll(context.Background()))
+	require.NoError(t, overseer.SetAccessPolicy(&AccessPolicy{Rules: []AccessRule{
+		{Caller: "plugin", Subsystem: "store", Methods: []string{"get_*"}},
+	}}))
+
+	audits := make(chan AuditEvent, 1)
+	_, err := bus.Subscribe(AuditTopic, func(data any) {
+		audits <- data.(AuditEvent)
+	})
+	require.NoError(t, err)
+
+	resp := SubsystemMethod(bus, "plugin", "store", "get_block")
+	require.NoError(t, resp.Error)
+
+	resp = SubsystemMethod(bus, "plugin", "store", "put_block")
+	require.ErrorIs(t, resp.Error, ErrPermissionDenied)
+	var methodErr *MethodError
+	require.True(t, errors.As(resp.Error, &methodErr))
+	require.Equal(t, resp.Request.ID, methodErr.RequestID)
+
+	event := <-audits
+	require.Equal(t, "plugin", event.Caller)
+	require.Equal(t, "put_block", event.Method)
+	require.Equal(t, resp.Request.ID, event.RequestID)
+
+	require.NoError(t, overseer.SetAccessPolicy(nil))
+	resp = SubsystemMethod(bus, "plugin", "store", "put_block")
+	require.NoError(t, resp.Error)
+}
+
+func TestAccessPolicyAttributesNestedCalls(t *testing.T) {
+	bus := eventbus.New()
+	store := NewBaseSubsystem(&recordingSubsystem{name: "store", recorder: &recorder{}})
+	store.MustRegister("caller", "", func(ctx context.Context) (string, error) {
+		caller, _ := CallerFromContext(ctx)
+		return caller, nil
+	})
+	plugin := NewBaseSubsystem(&recordingSubsystem{name: "plugin", recorder: &recorder{}})
+	plugin.MustRegister("impersonate", "", func(ctx context.Context, method string) (any, error) {
+		resp := SubsystemMethodCtx(ctx, bus, "admin", "store", method)
+		return resp.Data, resp.Error
+	})
+	overseer := NewOverseer(bus, store, plugin)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+
+	resp := SubsystemMethod(bus, "test", "plugin", "impersonate", "caller")
+	require.NoError(t, resp.Error)
+	require.Equal(t, "plugin", resp.Data)
+
+	require.NoError(t, overseer.SetAccessPolicy(&AccessPolicy{Rules: []AccessRule{
+		{Caller: "admin", Subsystem: "*", Methods: []string{"*"}},
+		{Caller: "*", Subsystem: "plugin", Methods: []string{"*"}},
+	}}))
+	resp = SubsystemMethod(bus, "test", "plugin", "impersonate", "ping")
+	require.ErrorIs(t, resp.Error, ErrPermissionDenied)
+	require.Contains(t, resp.Error.Error(), "plugin may not call store.ping")
+	require.NoError(t, SubsystemMethod(bus, "admin", "store", "ping").Error)
+}
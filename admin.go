@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// AdminName is the name of the admin subsystem.
+const AdminName = "admin"
+
+// AdminHeader must be set, to any value, on the requests changing the state of the overseer. Browsers
+// do not send custom headers cross-site unless the server allows it, which the admin API does not,
+// so other sites cannot make the browsers of operators call it.
+const AdminHeader = "X-Overseer-Admin"
+
+// Admin is a subsystem serving an HTTP API for operators to inspect and control the overseer:
+//
+//	GET    /subsystems                 the subsystems, their states and methods
+//	GET    /subsystems/<name>          a single subsystem
+//	POST   /subsystems/<name>/start    starts a subsystem, see Overseer.StartSubsystem
+//	POST   /subsystems/<name>/stop     stops a subsystem, see Overseer.StopSubsystem
+//	POST   /subsystems/<name>/restart  restarts a subsystem, see Overseer.RestartSubsystem
+//	GET    /topics                     the topics and patterns of the event bus with subscribers
+//	GET    /middleware                 the middleware chain of the event bus
+//	GET    /requests                   the method requests in flight
+//	DELETE /requests/<id>              cancels a method request in flight
+//	GET    /waits                      the requests in flight waiting for each other, see Overseer.WaitForGraph
+//
+// Responses are JSON; errors are returned as {"error": "..."}. POST and DELETE requests must carry
+// AdminHeader. The API has no authentication, so it should only listen on addresses operators alone
+// can reach.
+type Admin struct {
+	bs       *BaseSubsystem
+	overseer *Overseer
+	http     httpServer
+}
+
+// NewAdmin returns the admin API of overseer, listening on addr once started. The admin API is
+// also an http.Handler, for serving it from a server of one's own.
+func NewAdmin(overseer *Overseer, addr string) *Admin {
+	return &Admin{overseer: overseer, http: httpServer{addr: addr}}
+}
+
+func (a *Admin) Name() string {
+	return AdminName
+}
+
+func (a *Admin) SetBaseSubsystem(bs *BaseSubsystem) {
+	a.bs = bs
+}
+
+// OnStart starts listening.
+func (a *Admin) OnStart() error {
+	return a.http.start(a.bs, a)
+}
+
+// OnStop closes the listener and every connection.
+func (a *Admin) OnStop() error {
+	return a.http.stop()
+}
+
+// Call serves no methods: the admin API is only reachable over HTTP.
+func (a *Admin) Call(ctx context.Context, method string, args ...any) (any, error) {
+	return nil, ErrMethodNotFound
+}
+
+// Addr returns the address the admin API listens on, or nil if it is not running.
+func (a *Admin) Addr() net.Addr {
+	return a.http.Addr()
+}
+
+// ServeHTTP routes a request of the admin API.
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Header.Get(AdminHeader) == "" {
+		writeError(w, http.StatusForbidden, fmt.Errorf("%v requests must have the header %v", r.Method, AdminHeader))
+		return
+	}
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(path) == 1 && path[0] == "subsystems":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, a.overseer.Describe())
+		}
+	case len(path) == 2 && path[0] == "subsystems":
+		if allowMethod(w, r, http.MethodGet) {
+			a.getSubsystem(w, path[1])
+		}
+	case len(path) == 3 && path[0] == "subsystems":
+		if allowMethod(w, r, http.MethodPost) {
+			a.controlSubsystem(w, path[1], path[2])
+		}
+	case len(path) == 1 && path[0] == "topics":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, a.overseer.eventBus.Topics())
+		}
+	case len(path) == 1 && path[0] == "middleware":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, a.overseer.eventBus.Middleware())
+		}
+	case len(path) == 1 && path[0] == "requests":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, a.overseer.Inflight())
+		}
+	case len(path) == 1 && path[0] == "waits":
+		if allowMethod(w, r, http.MethodGet) {
+			writeJSON(w, http.StatusOK, a.overseer.WaitForGraph())
+		}
+	case len(path) == 2 && path[0] == "requests":
+		if allowMethod(w, r, http.MethodDelete) {
+			a.cancelRequest(w, path[1])
+		}
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (a *Admin) getSubsystem(w http.ResponseWriter, name string) {
+	for _, description := range a.overseer.Describe() {
+		if description.Name == name {
+			writeJSON(w, http.StatusOK, description)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, ErrSubsystemNotFound)
+}
+
+func (a *Admin) controlSubsystem(w http.ResponseWriter, name string, action string) {
+	var control func(string) error
+	switch action {
+	case "start":
+		control = a.overseer.StartSubsystem
+	case "stop":
+		control = a.overseer.StopSubsystem
+	case "restart":
+		control = a.overseer.RestartSubsystem
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if name == a.Name() && action != "start" {
+		// stopping the server would cut off the response to this request
+		writeError(w, http.StatusConflict, errors.New("the admin API cannot stop itself"))
+		return
+	}
+	err := control(name)
+	if errors.Is(err, ErrSubsystemNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logging.WithFields(logging.Fields{"Subsystem": name, "action": action}).Info("subsystem controlled through admin API")
+	a.getSubsystem(w, name)
+}
+
+func (a *Admin) cancelRequest(w http.ResponseWriter, id string) {
+	for _, request := range a.overseer.Inflight() {
+		if request.ID != id {
+			continue
+		}
+		err := a.overseer.eventBus.Publish(MethodCancelTopic, MethodCancel{ID: id, Err: ErrMethodCancelled})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeError(w, http.StatusNotFound, errors.New("no such request in flight"))
+}
+
+// allowMethod reports whether r uses method, and answers it with 405 otherwise.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	b, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
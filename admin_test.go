@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"overseer/eventbus"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func adminRequest(t *testing.T, method string, url string, v any) int {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	req.Header.Set(AdminHeader, "1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp.StatusCode
+}
+
+func TestAdmin(t *testing.T) {
+	bus := eventbus.New()
+	worker := NewBaseSubsystem(&recordingSubsystem{name: "worker", recorder: &recorder{}})
+	started := make(chan struct{})
+	worker.MustRegister("wait", "Wait blocks until cancelled.", func(ctx context.Context) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, context.Cause(ctx)
+	})
+	overseer := NewOverseer(bus, worker)
+	admin := NewAdmin(overseer, "127.0.0.1:0")
+	require.NoError(t, overseer.RegisterSubsystem(NewBaseSubsystem(admin)))
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+	url := "http://" + admin.Addr().String()
+
+	var subsystems []struct {
+		Name    string `json:"name"`
+		State   string `json:"state"`
+		Methods []struct {
+			Name string `json:"name"`
+		} `json:"methods"`
+	}
+	require.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, url+"/subsystems", &subsystems))
+	require.Len(t, subsystems, 2)
+	require.Equal(t, "admin", subsystems[0].Name)
+	require.Equal(t, "worker", subsystems[1].Name)
+	require.Equal(t, "running", subsystems[1].State)
+	require.Equal(t, "wait", subsystems[1].Methods[0].Name)
+
+	var subsystem struct {
+		State string `json:"state"`
+	}
+	require.Equal(t, http.StatusOK, adminRequest(t, http.MethodPost, url+"/subsystems/worker/stop", &subsystem))
+	require.Equal(t, "stopped", subsystem.State)
+	require.Equal(t, http.StatusOK, adminRequest(t, http.MethodPost, url+"/subsystems/worker/start", &subsystem))
+	require.Equal(t, "running", subsystem.State)
+	require.Equal(t, http.StatusOK, adminRequest(t, http.MethodPost, url+"/subsystems/worker/restart", &subsystem))
+	require.Equal(t, "running", subsystem.State)
+	require.Equal(t, http.StatusNotFound, adminRequest(t, http.MethodPost, url+"/subsystems/missing/stop", nil))
+	require.Equal(t, http.StatusNotFound, adminRequest(t, http.MethodPost, url+"/subsystems/worker/pause", nil))
+	require.Equal(t, http.StatusConflict, adminRequest(t, http.MethodPost, url+"/subsystems/admin/stop", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, adminRequest(t, http.MethodGet, url+"/subsystems/worker/stop", nil))
+
+	// a form on another site can POST, but not with a custom header
+	resp, err := http.Post(url+"/subsystems/worker/stop", "application/x-www-form-urlencoded", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.True(t, worker.IsRunning())
+
+	remove, err := overseer.UseRequestMiddleware(func(req MethodRequest, next func(MethodRequest) error) error {
+		return next(req)
+	}, eventbus.WithName("quota"))
+	require.NoError(t, err)
+	defer remove()
+	var middleware []eventbus.MiddlewareInfo
+	require.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, url+"/middleware", &middleware))
+	require.Equal(t, []eventbus.MiddlewareInfo{{Name: "quota", Topics: []string{"method"}}}, middleware)
+
+	var topics []eventbus.TopicInfo
+	require.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, url+"/topics", &topics))
+	require.Contains(t, topics, eventbus.TopicInfo{Topic: "method", Subscribers: 1})
+
+	done := make(chan MethodResponse, 1)
+	go func() {
+		done <- SubsystemMethod(bus, "operator", "worker", "wait")
+	}()
+	<-started
+	var requests []InflightRequest
+	require.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, url+"/requests", &requests))
+	require.Len(t, requests, 1)
+	require.Equal(t, "operator", requests[0].Caller)
+	require.Equal(t, "wait", requests[0].Method)
+
+	require.Equal(t, http.StatusNoContent, adminRequest(t, http.MethodDelete, url+"/requests/"+requests[0].ID, nil))
+	select {
+	case resp := <-done:
+		require.ErrorIs(t, resp.Error, ErrMethodCancelled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not cancelled")
+	}
+	require.Equal(t, http.StatusNotFound, adminRequest(t, http.MethodDelete, url+"/requests/"+requests[0].ID, nil))
+}
+
+func TestAdminHandler(t *testing.T) {
+	server := httptest.NewServer(NewAdmin(NewOverseer(eventbus.New()), ""))
+	defer server.Close()
+	require.Equal(t, http.StatusNotFound, adminRequest(t, http.MethodGet, server.URL+"/nope", nil))
+	var requests []InflightRequest
+	require.Equal(t, http.StatusOK, adminRequest(t, http.MethodGet, server.URL+"/requests", &requests))
+	require.Empty(t, requests)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// CyclePolicy decides what becomes of a call cycle: a request to a subsystem serving a call that
+// waits for the request, directly or through other subsystems.
+type CyclePolicy int
+
+const (
+	// CycleWarn logs call cycles and routes them.
+	CycleWarn CyclePolicy = iota
+	// CycleReject fails call cycles with ErrCallCycle.
+	CycleReject
+)
+
+// SetCyclePolicy decides what becomes of call cycles into subsystems that serve calls concurrently.
+// Cycles into subsystems serving calls one at a time, see WithMailbox, would deadlock and always
+// fail with ErrCallCycle, as do cycles into subsystems with a signal pending, which waits for the
+// call that started the cycle. The default is CycleWarn.
+//
+// Cycles are only seen if every subsystem on the way makes its requests with the ctx of the call it
+// serves, as SubsystemMethodCtx and SubsystemRequest do.
+func (s *Overseer) SetCyclePolicy(policy CyclePolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cyclePolicy = policy
+}
+
+// joinChain makes a request a child of the request served in ctx, if any.
+func joinChain(ctx context.Context, methodRequest MethodRequest) MethodRequest {
+	parent, ok := RequestFromContext(ctx)
+	if !ok || methodRequest.ParentID != "" {
+		return methodRequest
+	}
+	methodRequest.ParentID = parent.ID
+	methodRequest.Chain = append(slices.Clip(parent.Chain), parent.Subsystem)
+	return methodRequest
+}
+
+// checkCycle returns ErrCallCycle for a request closing a call cycle that would deadlock, or any
+// call cycle under CycleReject, and logs the others.
+func (s *Overseer) checkCycle(baseSubsystem *BaseSubsystem, methodRequest MethodRequest) error {
+	i := slices.Index(methodRequest.Chain, methodRequest.Subsystem)
+	if i < 0 {
+		return nil
+	}
+	cycle := strings.Join(append(slices.Clip(methodRequest.Chain[i:]), methodRequest.Subsystem), " -> ")
+	if baseSubsystem.servesOneAtATime() {
+		return newMethodError(ErrCallCycle, methodRequest, "call cycle %v would deadlock: %v serves one call at a time", cycle, methodRequest.Subsystem)
+	}
+	s.lock.RLock()
+	policy := s.cyclePolicy
+	s.lock.RUnlock()
+	if policy == CycleReject {
+		return newMethodError(ErrCallCycle, methodRequest, "call cycle %v", cycle)
+	}
+	logging.WithFields(logging.Fields{
+		"Caller":    methodRequest.Caller,
+		"Subsystem": methodRequest.Subsystem,
+		"Method":    methodRequest.Method,
+		"Cycle":     cycle,
+	}).Warn("call cycle")
+	return nil
+}
+
+// WaitEdge is an edge of a WaitForGraph: the request From waits for the request To, because
+//   - "call": From is served by the call that made To, waiting for its response, or
+//   - "mailbox": From is queued at a subsystem serving calls one at a time, which serves To.
+type WaitEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+// WaitForGraph is the graph of method requests in flight that wait for each other.
+type WaitForGraph struct {
+	Requests []InflightRequest `json:"requests"` // those with an edge, oldest first
+	Edges    []WaitEdge        `json:"edges"`
+	Cycles   [][]string        `json:"cycles"` // of request IDs, each a deadlock
+}
+
+// WaitForGraph returns the wait-for graph of the method requests in flight, for debugging hung
+// calls. Like call cycles, calls are only linked to the requests they make with their ctx.
+func (s *Overseer) WaitForGraph() WaitForGraph {
+	return buildWaitForGraph(s.Inflight(), func(name string) bool {
+		bs, ok := s.subsystem(name)
+		return ok && bs.servesOneAtATime()
+	})
+}
+
+// buildWaitForGraph links requests, oldest first, by the edges described by WaitEdge.
+func buildWaitForGraph(requests []InflightRequest, servesOneAtATime func(subsystem string) bool) WaitForGraph {
+	graph := WaitForGraph{Requests: make([]InflightRequest, 0), Edges: make([]WaitEdge, 0), Cycles: make([][]string, 0)}
+	byID := make(map[string]InflightRequest, len(requests))
+	for _, req := range requests {
+		byID[req.ID] = req
+	}
+	linked := make(map[string]bool)
+	next := make(map[string][]string)
+	link := func(from string, to string, reason string) {
+		graph.Edges = append(graph.Edges, WaitEdge{From: from, To: to, Reason: reason})
+		next[from] = append(next[from], to)
+		linked[from], linked[to] = true, true
+	}
+	for _, req := range requests {
+		if _, ok := byID[req.ParentID]; ok {
+			link(req.ParentID, req.ID, "call")
+		}
+	}
+	for _, queued := range requests {
+		if queued.Running || !servesOneAtATime(queued.Subsystem) {
+			continue
+		}
+		for _, running := range requests {
+			if running.Running && running.Subsystem == queued.Subsystem {
+				link(queued.ID, running.ID, "mailbox")
+			}
+		}
+	}
+	for _, req := range requests {
+		if linked[req.ID] {
+			graph.Requests = append(graph.Requests, req)
+		}
+	}
+
+	// depth-first search for back edges, each closing a cycle of the requests on the path
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = onPath
+		path = append(path, id)
+		for _, to := range next[id] {
+			switch state[to] {
+			case unvisited:
+				visit(to)
+			case onPath:
+				i := slices.Index(path, to)
+				graph.Cycles = append(graph.Cycles, slices.Clone(path[i:]))
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = done
+	}
+	for _, req := range graph.Requests {
+		if state[req.ID] == unvisited {
+			visit(req.ID)
+		}
+	}
+	return graph
+}
+
+// String renders the graph for logs and terminals, a request per line followed by what it waits
+// for, and the deadlocks last.
+func (g WaitForGraph) String() string {
+	var b strings.Builder
+	now := time.Now()
+	for _, req := range g.Requests {
+		state := "queued"
+		if req.Running {
+			state = "running"
+		}
+		fmt.Fprintf(&b, "%v %v.%v from %v, %v for %v\n", req.ID, req.Subsystem, req.Method, req.Caller, state, now.Sub(req.Started).Round(time.Millisecond))
+		for _, edge := range g.Edges {
+			if edge.From == req.ID {
+				fmt.Fprintf(&b, "\twaits for %v (%v)\n", edge.To, edge.Reason)
+			}
+		}
+	}
+	for _, cycle := range g.Cycles {
+		fmt.Fprintf(&b, "deadlock: %v\n", strings.Join(append(slices.Clone(cycle), cycle[0]), " -> "))
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"overseer/eventbus"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallCycle(t *testing.T) {
+	bus := eventbus.New()
+	actor := NewBaseSubsystem(&recordingSubsystem{name: "actor", recorder: &recorder{}}, WithMailbox(0, 1))
+	actor.MustRegister("loop", "", func(ctx context.Context) (any, error) {
+		resp := SubsystemMethodCtx(ctx, bus, "actor", "helper", "back")
+		return resp.Data, resp.Error
+	})
+	helper := NewBaseSubsystem(&recordingSubsystem{name: "helper", recorder: &recorder{}})
+	helper.MustRegister("back", "", func(ctx context.Context) (any, error) {
+		resp := SubsystemMethodCtx(ctx, bus, "helper", "actor", "ping")
+		return resp.Data, resp.Error
+	})
+	helper.MustRegister("self", "", func(ctx context.Context) (any, error) {
+		resp := SubsystemMethodCtx(ctx, bus, "helper", "helper", "ping")
+		return resp.Data, resp.Error
+	})
+	overseer := NewOverseer(bus, actor, helper)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp := SubsystemMethodCtx(ctx, bus, "test", "actor", "loop")
+	require.ErrorIs(t, resp.Error, ErrCallCycle)
+	require.Contains(t, resp.Error.Error(), "actor -> helper -> actor")
+
+	resp = SubsystemMethodCtx(ctx, bus, "test", "helper", "self")
+	require.NoError(t, resp.Error)
+	require.Equal(t, "helper", resp.Data)
+
+	overseer.SetCyclePolicy(CycleReject)
+	resp = SubsystemMethodCtx(ctx, bus, "test", "helper", "self")
+	require.ErrorIs(t, resp.Error, ErrCallCycle)
+	require.NoError(t, SubsystemMethodCtx(ctx, bus, "test", "helper", "ping").Error)
+}
+
+func TestCallCycleBehindSignal(t *testing.T) {
+	bus := eventbus.New()
+	entered, release := make(chan struct{}), make(chan struct{})
+	a := NewBaseSubsystem(&recordingSubsystem{name: "a", recorder: &recorder{}})
+	a.MustRegister("loop", "", func(ctx context.Context) (any, error) {
+		resp := SubsystemMethodCtx(ctx, bus, "a", "b", "back")
+		return resp.Data, resp.Error
+	})
+	b := NewBaseSubsystem(&recordingSubsystem{name: "b", recorder: &recorder{}})
+	b.MustRegister("back", "", func(ctx context.Context) (any, error) {
+		close(entered)
+		<-release
+		resp := SubsystemMethodCtx(ctx, bus, "b", "a", "ping")
+		return resp.Data, resp.Error
+	})
+	overseer := NewOverseer(bus, a, b)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	responses := make(chan MethodResponse, 1)
+	go func() { responses <- SubsystemMethodCtx(ctx, bus, "test", "a", "loop") }()
+	<-entered
+	// the signal waits for loop, which waits for the call back into a
+	signalled := make(chan error, 1)
+	go func() { signalled <- overseer.BroadcastSignal(ctx, BlockFinalized{}) }()
+	require.Eventually(t, func() bool {
+		a.lock.Lock()
+		m := a.mailbox
+		a.lock.Unlock()
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		return m.signals > 0
+	}, 5*time.Second, time.Millisecond)
+	close(release)
+
+	resp := <-responses
+	require.ErrorIs(t, resp.Error, ErrCallCycle)
+	require.Contains(t, resp.Error.Error(), "a has a signal pending")
+	require.NoError(t, <-signalled)
+	require.NoError(t, SubsystemMethodCtx(ctx, bus, "test", "a", "ping").Error)
+}
+
+func TestWaitForGraph(t *testing.T) {
+	bus := eventbus.New()
+	actor := NewBaseSubsystem(&recordingSubsystem{name: "actor", recorder: &recorder{}}, WithMailbox(0, 1))
+	held, release := make(chan struct{}), make(chan struct{})
+	actor.MustRegister("hold", "", func(ctx context.Context) (any, error) {
+		close(held)
+		<-release
+		return nil, nil
+	})
+	relay := NewBaseSubsystem(&recordingSubsystem{name: "relay", recorder: &recorder{}})
+	relay.MustRegister("relay", "", func(ctx context.Context) (any, error) {
+		resp := SubsystemMethodCtx(ctx, bus, "relay", "actor", "ping")
+		return resp.Data, resp.Error
+	})
+	overseer := NewOverseer(bus, actor, relay)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+
+	responses := make(chan MethodResponse, 2)
+	go func() { responses <- SubsystemMethod(bus, "test", "actor", "hold") }()
+	<-held
+	go func() { responses <- SubsystemMethod(bus, "test", "relay", "relay") }()
+
+	var graph WaitForGraph
+	require.Eventually(t, func() bool {
+		graph = overseer.WaitForGraph()
+		return len(graph.Edges) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	ids := make(map[string]string)
+	for _, req := range graph.Requests {
+		ids[req.Method] = req.ID
+	}
+	require.Len(t, ids, 3)
+	require.ElementsMatch(t, []WaitEdge{
+		{From: ids["relay"], To: ids["ping"], Reason: "call"},
+		{From: ids["ping"], To: ids["hold"], Reason: "mailbox"},
+	}, graph.Edges)
+	require.Empty(t, graph.Cycles)
+	require.Contains(t, graph.String(), ids["ping"]+" actor.ping from relay, queued for ")
+	require.Contains(t, graph.String(), "\twaits for "+ids["hold"]+" (mailbox)\n")
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, (<-responses).Error)
+	}
+	require.Empty(t, overseer.WaitForGraph().Requests)
+}
+
+func TestWaitForGraphCycles(t *testing.T) {
+	requests := []InflightRequest{
+		{ID: "1", Subsystem: "a", Running: true},
+		{ID: "2", Subsystem: "b", ParentID: "1", Running: true},
+		{ID: "3", Subsystem: "a", ParentID: "2"},
+		{ID: "4", Subsystem: "c", Running: true},
+	}
+	graph := buildWaitForGraph(requests, func(subsystem string) bool { return subsystem == "a" })
+	require.Equal(t, []WaitEdge{
+		{From: "1", To: "2", Reason: "call"},
+		{From: "2", To: "3", Reason: "call"},
+		{From: "3", To: "1", Reason: "mailbox"},
+	}, graph.Edges)
+	require.Len(t, graph.Requests, 3)
+	require.Equal(t, [][]string{{"1", "2", "3"}}, graph.Cycles)
+	require.Contains(t, graph.String(), "deadlock: 1 -> 2 -> 3 -> 1\n")
+}
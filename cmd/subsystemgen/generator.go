@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+const (
+	subsystemDirective = "//overseer:subsystem "
+	methodDirective    = "//overseer:method "
+)
+
+// reservedNames are identifiers used by the generated code that parameters must not shadow.
+var reservedNames = map[string]bool{
+	"ctx": true, "m": true, "impl": true, "method": true, "args": true,
+	"ok": true, "result": true, "methodResponse": true,
+}
+
+// apiSpec describes an annotated subsystem interface.
+type apiSpec struct {
+	Source    string
+	Package   string
+	Interface string
+	Subsystem string
+	Client    string
+	Instance  string
+	Imports   []string
+	Methods   []methodSpec
+}
+
+type methodSpec struct {
+	GoName string
+	Name   string
+	Doc    []string
+	Params []paramSpec
+	Result string
+}
+
+type paramSpec struct {
+	Name string
+	Type string
+}
+
+// Untyped reports whether the method returns an empty interface, which needs no type assertion.
+func (m methodSpec) Untyped() bool {
+	return m.Result == "any" || m.Result == "interface{}"
+}
+
+// Description returns the doc comment of the method as a single line.
+func (m methodSpec) Description() string {
+	return strings.Join(m.Doc, " ")
+}
+
+// ArgList returns the parameters as they appear in a function signature.
+func (m methodSpec) ArgList() string {
+	args := make([]string, 0, len(m.Params))
+	for _, p := range m.Params {
+		args = append(args, p.Name+" "+p.Type)
+	}
+	return strings.Join(args, ", ")
+}
+
+// ArgNames returns the parameter names as they appear in a call.
+func (m methodSpec) ArgNames() string {
+	names := make([]string, 0, len(m.Params))
+	for _, p := range m.Params {
+		names = append(names, p.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseAPI finds the interface typeName in the Go source src and describes it.
+func parseAPI(filename string, src []byte, typeName string) (*apiSpec, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var iface *ast.InterfaceType
+	var doc *ast.CommentGroup
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range genDecl.Specs {
+			typeSpec := s.(*ast.TypeSpec)
+			if typeSpec.Name.Name != typeName {
+				continue
+			}
+			if iface, ok = typeSpec.Type.(*ast.InterfaceType); !ok {
+				return nil, fmt.Errorf("%v is not an interface", typeName)
+			}
+			doc = typeSpec.Doc
+			if doc == nil {
+				doc = genDecl.Doc
+			}
+		}
+	}
+	if iface == nil {
+		return nil, fmt.Errorf("interface %v not found in %v", typeName, filename)
+	}
+
+	subsystem := directive(doc, subsystemDirective)
+	if subsystem == "" {
+		return nil, fmt.Errorf("interface %v has no %v annotation", typeName, strings.TrimSpace(subsystemDirective))
+	}
+	client := strings.TrimSuffix(typeName, "API") + "Methods"
+	spec := &apiSpec{
+		Source:    filename,
+		Package:   file.Name.Name,
+		Interface: typeName,
+		Subsystem: subsystem,
+		Client:    client,
+		Instance:  client + "Instance",
+	}
+
+	usedPackages := map[string]bool{"context": true}
+	typeString := func(expr ast.Expr) string {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok {
+					usedPackages[ident.Name] = true
+				}
+			}
+			return true
+		})
+		var buf bytes.Buffer
+		_ = printer.Fprint(&buf, fset, expr)
+		return buf.String()
+	}
+
+	for _, field := range iface.Methods.List {
+		funcType, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) != 1 {
+			return nil, fmt.Errorf("%v: embedded interfaces are not supported", typeName)
+		}
+		m, err := parseMethod(field.Names[0].Name, field.Doc, funcType, typeString)
+		if err != nil {
+			return nil, fmt.Errorf("%v.%v: %w", typeName, field.Names[0].Name, err)
+		}
+		spec.Methods = append(spec.Methods, m)
+	}
+	if len(spec.Methods) == 0 {
+		return nil, fmt.Errorf("interface %v has no methods", typeName)
+	}
+
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if usedPackages[name] && path != "context" {
+			spec.Imports = append(spec.Imports, importSpec(imp))
+		}
+	}
+	return spec, nil
+}
+
+func parseMethod(goName string, doc *ast.CommentGroup, funcType *ast.FuncType, typeString func(ast.Expr) string) (methodSpec, error) {
+	m := methodSpec{GoName: goName, Name: directive(doc, methodDirective)}
+	if m.Name == "" {
+		m.Name = snakeCase(goName)
+	}
+	if doc != nil {
+		for _, line := range strings.Split(strings.TrimSpace(doc.Text()), "\n") {
+			if line != "" {
+				m.Doc = append(m.Doc, line)
+			}
+		}
+	}
+
+	var params []paramSpec
+	for _, field := range funcType.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return m, errors.New("variadic parameters are not supported")
+		}
+		t := typeString(field.Type)
+		if len(field.Names) == 0 {
+			params = append(params, paramSpec{Type: t})
+		}
+		for _, name := range field.Names {
+			params = append(params, paramSpec{Name: name.Name, Type: t})
+		}
+	}
+	if len(params) == 0 || params[0].Type != "context.Context" {
+		return m, errors.New("the first parameter must be a context.Context")
+	}
+	for i := range params[1:] {
+		p := &params[i+1]
+		if p.Name == "" || p.Name == "_" || reservedNames[p.Name] {
+			p.Name = fmt.Sprintf("arg%d", i)
+		}
+	}
+	m.Params = params[1:]
+
+	var results []string
+	if funcType.Results != nil {
+		for _, field := range funcType.Results.List {
+			t := typeString(field.Type)
+			for n := 0; n < max(1, len(field.Names)); n++ {
+				results = append(results, t)
+			}
+		}
+	}
+	if len(results) != 2 || results[1] != "error" {
+		return m, errors.New("the results must be a value and an error")
+	}
+	m.Result = results[0]
+	return m, nil
+}
+
+// directive returns the argument of the first comment in doc that starts with prefix.
+func directive(doc *ast.CommentGroup, prefix string) string {
+	if doc == nil {
+		return ""
+	}
+	for _, comment := range doc.List {
+		if strings.HasPrefix(comment.Text, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(comment.Text, prefix))
+		}
+	}
+	return ""
+}
+
+func importSpec(imp *ast.ImportSpec) string {
+	if imp.Name != nil {
+		return imp.Name.Name + " " + imp.Path.Value
+	}
+	return imp.Path.Value
+}
+
+// snakeCase converts a Go method name such as PingSubsystem1 to ping_subsystem1.
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// generate renders the client wrapper and the server-side dispatch for spec.
+func generate(spec *apiSpec) ([]byte, error) {
+	imports := append([]string{`"context"`, `"fmt"`, `"overseer/eventbus"`, `"reflect"`}, spec.Imports...)
+	sort.Strings(imports)
+	imports = slices.Compact(imports)
+
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, struct {
+		*apiSpec
+		AllImports []string
+	}{spec, imports})
+	if err != nil {
+		return nil, err
+	}
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w\n%s", err, buf.Bytes())
+	}
+	return out, nil
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by subsystemgen from {{.Source}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .AllImports}}
+	{{.}}
+{{- end}}
+)
+
+// {{.Client}} calls the methods served by {{.Subsystem}} over the event bus.
+type {{.Client}} interface {
+	SetOwner(owner string)
+	GetOwner() (owner string)
+{{- range .Methods}}
+	{{.GoName}}({{.ArgList}}) ({{.Result}}, error)
+	{{.GoName}}Ctx(ctx context.Context{{if .Params}}, {{.ArgList}}{{end}}) ({{.Result}}, error)
+{{- end}}
+}
+
+type {{.Instance}} struct {
+	owner    string
+	eventBus eventbus.Bus
+}
+
+func (m *{{.Instance}}) GetOwner() (owner string) {
+	return m.owner
+}
+
+func (m *{{.Instance}}) SetOwner(owner string) {
+	m.owner = owner
+}
+{{range .Methods}}
+{{range .Doc}}// {{.}}
+{{end -}}
+func (m *{{$.Instance}}) {{.GoName}}({{.ArgList}}) ({{.Result}}, error) {
+	return m.{{.GoName}}Ctx(context.Background(){{if .Params}}, {{.ArgNames}}{{end}})
+}
+
+func (m *{{$.Instance}}) {{.GoName}}Ctx(ctx context.Context{{if .Params}}, {{.ArgList}}{{end}}) ({{.Result}}, error) {
+	var result {{.Result}}
+	methodResponse := SubsystemMethodCtx(ctx, m.eventBus, m.owner, "{{$.Subsystem}}", "{{.Name}}"{{if .Params}}, {{.ArgNames}}{{end}})
+	if methodResponse.Error != nil {
+		return result, methodResponse.Error
+	}
+	if methodResponse.Data == nil {
+		return result, nil
+	}
+{{- if .Untyped}}
+	return methodResponse.Data, nil
+{{- else}}
+	result, ok := methodResponse.Data.({{.Result}})
+	if !ok {
+		return result, fmt.Errorf("{{$.Subsystem}}.{{.Name}} returned %T, expected {{.Result}}", methodResponse.Data)
+	}
+	return result, nil
+{{- end}}
+}
+{{end}}
+// register{{.Interface}} registers the methods of impl in the method registry of bs.
+func register{{.Interface}}(bs *BaseSubsystem, impl {{.Interface}}) {
+{{- range .Methods}}
+	bs.registerMethod(MethodInfo{
+		Name: "{{.Name}}",
+		Args: []reflect.Type{
+{{- range .Params}}
+			reflect.TypeOf((*{{.Type}})(nil)).Elem(),
+{{- end}}
+		},
+		ArgNames:    []string{ {{- range $i, $p := .Params}}{{if $i}}, {{end}}"{{$p.Name}}"{{end -}} },
+		Result:      reflect.TypeOf((*{{.Result}})(nil)).Elem(),
+		Description: {{printf "%q" .Description}},
+	}, func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != {{len .Params}} {
+			return nil, fmt.Errorf("%w: {{.Name}} expects {{len .Params}} args, got %d", ErrInvalidArgs, len(args))
+		}
+{{- range $i, $p := .Params}}
+		{{$p.Name}}, ok := args[{{$i}}].({{$p.Type}})
+		if !ok {
+			return nil, fmt.Errorf("%w: {{$p.Name}} must be {{$p.Type}}, got %T", ErrInvalidArgs, args[{{$i}}])
+		}
+{{- end}}
+		return impl.{{.GoName}}(ctx{{if .Params}}, {{.ArgNames}}{{end}})
+	})
+{{- end}}
+}
+`))
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGeneratedFilesUpToDate fails if a generated file was edited by hand or not regenerated after
+// its interface changed.
+func TestGeneratedFilesUpToDate(t *testing.T) {
+	for _, tc := range []struct {
+		typeName, input, output string
+	}{
+		{"Subsystem1API", "subsystem1.go", "subsystem1_gen.go"},
+		{"Subsystem2API", "subsystem2.go", "subsystem2_gen.go"},
+	} {
+		src, err := os.ReadFile(filepath.Join("..", "..", tc.input))
+		require.NoError(t, err)
+		spec, err := parseAPI(tc.input, src, tc.typeName)
+		require.NoError(t, err)
+		generated, err := generate(spec)
+		require.NoError(t, err)
+
+		existing, err := os.ReadFile(filepath.Join("..", "..", tc.output))
+		require.NoError(t, err)
+		require.Equal(t, string(existing), string(generated), "%v is out of date, run go generate", tc.output)
+	}
+}
+
+func TestParseAPI(t *testing.T) {
+	src := `package demo
+
+import (
+	"context"
+	"time"
+)
+
+//overseer:subsystem clock
+type ClockAPI interface {
+	// Now returns the current time.
+	Now(ctx context.Context) (time.Time, error)
+
+	//overseer:method add
+	AddDuration(ctx context.Context, t time.Time, d time.Duration) (time.Time, error)
+}
+`
+	spec, err := parseAPI("clock.go", []byte(src), "ClockAPI")
+	require.NoError(t, err)
+	require.Equal(t, "clock", spec.Subsystem)
+	require.Equal(t, "ClockMethods", spec.Client)
+	require.Equal(t, []string{`"time"`}, spec.Imports)
+	require.Len(t, spec.Methods, 2)
+	require.Equal(t, "now", spec.Methods[0].Name)
+	require.Equal(t, []string{"Now returns the current time."}, spec.Methods[0].Doc)
+	require.Equal(t, "add", spec.Methods[1].Name)
+	require.Equal(t, "t time.Time, d time.Duration", spec.Methods[1].ArgList())
+
+	_, err = generate(spec)
+	require.NoError(t, err)
+}
+
+func TestParseAPIErrors(t *testing.T) {
+	for name, src := range map[string]string{
+		"missing annotation": `package demo
+type API interface {
+	Ping(ctx context.Context) (string, error)
+}`,
+		"missing context": `package demo
+//overseer:subsystem demo
+type API interface {
+	Ping(message string) (string, error)
+}`,
+		"missing error": `package demo
+//overseer:subsystem demo
+type API interface {
+	Ping(ctx context.Context) string
+}`,
+		"variadic": `package demo
+//overseer:subsystem demo
+type API interface {
+	Ping(ctx context.Context, messages ...string) (string, error)
+}`,
+	} {
+		_, err := parseAPI("api.go", []byte(src), "API")
+		require.Error(t, err, name)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	require.Equal(t, "ping", snakeCase("Ping"))
+	require.Equal(t, "ping_subsystem1", snakeCase("PingSubsystem1"))
+	require.Equal(t, "process_active_leaves_update", snakeCase("ProcessActiveLeavesUpdate"))
+	require.Equal(t, "get_http_status", snakeCase("GetHTTPStatus"))
+}
@@ -0,0 +1,57 @@
+// Command subsystemgen generates the typed client wrapper and the server-side dispatch of a
+// subsystem from an annotated Go interface, so that the two can never drift apart.
+//
+// The interface is annotated with the name the subsystem is registered under. Every method takes a
+// context.Context followed by its arguments and returns a value and an error. Methods are called
+// by the snake_case form of their name unless annotated otherwise:
+//
+//	//overseer:subsystem subsystem1
+//	type Subsystem1API interface {
+//		// Ping replies with "pong".
+//		//overseer:method ping
+//		Ping(ctx context.Context, message string) (string, error)
+//	}
+//
+// For this interface subsystemgen emits the Subsystem1Methods client used by SubsystemLibrary and
+// registerSubsystem1API, which registers the methods in the method registry of a BaseSubsystem
+// together with their argument types and doc comments. It is meant to be run by go generate:
+//
+//	//go:generate go run ./cmd/subsystemgen -type Subsystem1API -output subsystem1_gen.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	typeName := flag.String("type", "", "name of the annotated interface")
+	input := flag.String("input", os.Getenv("GOFILE"), "file declaring the interface (defaults to $GOFILE)")
+	output := flag.String("output", "", "file to write the generated code to")
+	flag.Parse()
+
+	if err := run(*typeName, *input, *output); err != nil {
+		fmt.Fprintln(os.Stderr, "subsystemgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(typeName, input, output string) error {
+	if typeName == "" || input == "" || output == "" {
+		return fmt.Errorf("-type, -input and -output are required")
+	}
+	src, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	spec, err := parseAPI(input, src, typeName)
+	if err != nil {
+		return err
+	}
+	out, err := generate(spec)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, out, 0o644)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"overseer/eventbus"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfig is returned, wrapping every problem found, for a Config that cannot be built.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Config declares an overseer: its event bus, supervisor, policies, request middleware and
+// subsystems, see Factories.Build. It is read from YAML, or JSON, which is valid YAML:
+//
+//	bus:
+//	  worker_pool: {workers: 8, queue_size: 1024, overflow: block}
+//	  metrics: {topics: [method]}
+//	supervisor: {strategy: one_for_one, max_restarts: 5, window: 1m}
+//	subsystems:
+//	  - type: subsystem1
+//	  - type: gateway
+//	    settings: {addr: "127.0.0.1:8545"}
+//	    depends_on: [subsystem1]
+type Config struct {
+	Bus          BusConfig          `yaml:"bus"`
+	Supervisor   *SupervisorConfig  `yaml:"supervisor"`    // without, failed subsystems stay stopped
+	CyclePolicy  string             `yaml:"cycle_policy"`  // warn or reject, see Overseer.SetCyclePolicy
+	AccessPolicy *AccessPolicy      `yaml:"access_policy"` // without, every call is allowed
+	Middleware   []MiddlewareConfig `yaml:"middleware"`
+	Subsystems   []SubsystemConfig  `yaml:"subsystems"`
+}
+
+// BusConfig configures the event bus, see eventbus.New.
+type BusConfig struct {
+	WorkerPool *WorkerPoolConfig `yaml:"worker_pool"`
+	Metrics    *MetricsConfig    `yaml:"metrics"`
+}
+
+// WorkerPoolConfig configures the worker pool of the event bus, see eventbus.WithWorkerPool.
+type WorkerPoolConfig struct {
+	Workers   int    `yaml:"workers"`
+	QueueSize int    `yaml:"queue_size"`
+	Overflow  string `yaml:"overflow"` // block, the default and only policy accepted, see validate
+}
+
+// MetricsConfig makes the bus and the overseer report to a PrometheusMetrics, which the metrics
+// subsystem type serves. Topics scope the metrics of the bus, see eventbus.WithMetrics.
+type MetricsConfig struct {
+	Topics []string `yaml:"topics"`
+}
+
+// SupervisorConfig configures the supervisor, see SupervisorSpec. Fields left out are taken from
+// DefaultSupervisorSpec.
+type SupervisorConfig struct {
+	Strategy    string        `yaml:"strategy"` // one_for_one, one_for_all or rest_for_one
+	MaxRestarts int           `yaml:"max_restarts"`
+	Window      time.Duration `yaml:"window"`
+	MinBackoff  time.Duration `yaml:"min_backoff"`
+	MaxBackoff  time.Duration `yaml:"max_backoff"`
+}
+
+// MiddlewareConfig declares request middleware built by the middleware factory of Type, and named
+// after it unless Name is given, see Overseer.UseRequestMiddleware.
+type MiddlewareConfig struct {
+	Name     string   `yaml:"name"`
+	Type     string   `yaml:"type"`
+	Priority int      `yaml:"priority"`
+	Settings Settings `yaml:"settings"`
+}
+
+// SubsystemConfig declares a subsystem built by the subsystem factory of Type, and named after it
+// unless Name is given.
+type SubsystemConfig struct {
+	Name      string         `yaml:"name"`
+	Type      string         `yaml:"type"`
+	DependsOn []string       `yaml:"depends_on"`
+	Mailbox   *MailboxConfig `yaml:"mailbox"`
+	Settings  Settings       `yaml:"settings"`
+}
+
+// MailboxConfig configures the mailbox of a subsystem, see WithMailbox.
+type MailboxConfig struct {
+	Capacity int `yaml:"capacity"`
+	Workers  int `yaml:"workers"`
+}
+
+// LoadConfig reads the config in the YAML or JSON file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfig parses a config in YAML or JSON. Fields the config has no place for are an error.
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	return &config, nil
+}
+
+// Settings are the settings of a subsystem or middleware in a Config, which its factory decodes.
+type Settings struct {
+	node yaml.Node
+}
+
+func (s *Settings) UnmarshalYAML(node *yaml.Node) error {
+	s.node = *node
+	return nil
+}
+
+// IsZero reports whether no settings were given.
+func (s Settings) IsZero() bool {
+	return s.node.Kind == 0
+}
+
+// Decode decodes the settings, if any, into v, a pointer to a struct with yaml tags. Settings v
+// has no field for are an error.
+func (s Settings) Decode(v any) error {
+	if s.IsZero() {
+		return nil
+	}
+	if s.node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: settings must be a mapping", s.node.Line)
+	}
+	fields := make(map[string]bool)
+	if t := reflect.TypeOf(v); t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct {
+		for _, field := range reflect.VisibleFields(t.Elem()) {
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			fields[name] = true
+		}
+	}
+	for i := 0; i < len(s.node.Content); i += 2 {
+		if key := s.node.Content[i]; !fields[key.Value] {
+			return fmt.Errorf("line %d: unknown setting %q", key.Line, key.Value)
+		}
+	}
+	return s.node.Decode(v)
+}
+
+// validate checks the parts of the config that need no factory to be built.
+func (c *Config) validate(f *Factories) []error {
+	var errs []error
+	if c.Bus.WorkerPool != nil {
+		// the other policies fail or lose the events of subsystems, which have no way to notice
+		if policy, err := parseOverflowPolicy(c.Bus.WorkerPool.Overflow); err != nil {
+			errs = append(errs, fmt.Errorf("bus.worker_pool.overflow: %w", err))
+		} else if policy != eventbus.OverflowBlock {
+			errs = append(errs, fmt.Errorf("bus.worker_pool.overflow: %v fails or loses events once the queue is full, only block is supported", policy))
+		}
+		if c.Bus.WorkerPool.Workers < 1 {
+			errs = append(errs, errors.New("bus.worker_pool.workers: must be at least 1"))
+		}
+		if c.Bus.WorkerPool.QueueSize < 1 {
+			errs = append(errs, errors.New("bus.worker_pool.queue_size: must be at least 1"))
+		}
+	}
+	if c.Bus.Metrics != nil {
+		for _, topic := range c.Bus.Metrics.Topics {
+			if err := eventbus.ValidatePattern(topic); err != nil {
+				errs = append(errs, fmt.Errorf("bus.metrics.topics: %w", err))
+			}
+		}
+	}
+	if c.Supervisor != nil {
+		if _, err := c.Supervisor.spec(); err != nil {
+			errs = append(errs, fmt.Errorf("supervisor.strategy: %w", err))
+		}
+	}
+	if _, err := parseCyclePolicy(c.CyclePolicy); err != nil {
+		errs = append(errs, fmt.Errorf("cycle_policy: %w", err))
+	}
+	if c.AccessPolicy != nil {
+		if err := c.AccessPolicy.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("access_policy: %w", err))
+		}
+	}
+	for i, mc := range c.Middleware {
+		if mc.Type == "" {
+			errs = append(errs, fmt.Errorf("middleware[%d].type: missing", i))
+		} else if _, ok := f.middlewareFactory(mc.Type); !ok {
+			errs = append(errs, fmt.Errorf("middleware[%d].type: unknown middleware type %q", i, mc.Type))
+		}
+	}
+
+	names := make(map[string]int)
+	for i, sc := range c.Subsystems {
+		if sc.Type == "" {
+			errs = append(errs, fmt.Errorf("subsystems[%d].type: missing", i))
+		} else if _, ok := f.subsystemFactory(sc.Type); !ok {
+			errs = append(errs, fmt.Errorf("subsystems[%d].type: unknown subsystem type %q", i, sc.Type))
+		}
+		if first, ok := names[sc.name()]; ok {
+			errs = append(errs, fmt.Errorf("subsystems[%d].name: %q is already the name of subsystems[%d]", i, sc.name(), first))
+		} else {
+			names[sc.name()] = i
+		}
+		if sc.Mailbox != nil && (sc.Mailbox.Capacity < 0 || sc.Mailbox.Workers < 1) {
+			errs = append(errs, fmt.Errorf("subsystems[%d].mailbox: capacity must not be negative and workers must be at least 1", i))
+		}
+	}
+	for i, sc := range c.Subsystems {
+		for _, dependency := range sc.DependsOn {
+			if _, ok := names[dependency]; !ok {
+				errs = append(errs, fmt.Errorf("subsystems[%d].depends_on: unknown subsystem %q", i, dependency))
+			}
+		}
+	}
+	return errs
+}
+
+func (sc SubsystemConfig) name() string {
+	if sc.Name != "" {
+		return sc.Name
+	}
+	return sc.Type
+}
+
+func (mc MiddlewareConfig) name() string {
+	if mc.Name != "" {
+		return mc.Name
+	}
+	return mc.Type
+}
+
+// spec returns the supervisor spec, with the fields left out taken from DefaultSupervisorSpec.
+func (sc *SupervisorConfig) spec() (SupervisorSpec, error) {
+	spec := DefaultSupervisorSpec
+	if sc.Strategy != "" {
+		found := false
+		for _, strategy := range []RestartStrategy{OneForOne, OneForAll, RestForOne} {
+			if strategy.String() == sc.Strategy {
+				spec.Strategy, found = strategy, true
+			}
+		}
+		if !found {
+			return spec, fmt.Errorf("unknown strategy %q", sc.Strategy)
+		}
+	}
+	if sc.MaxRestarts != 0 {
+		spec.MaxRestarts = sc.MaxRestarts
+	}
+	if sc.Window != 0 {
+		spec.Window = sc.Window
+	}
+	if sc.MinBackoff != 0 {
+		spec.MinBackoff = sc.MinBackoff
+	}
+	if sc.MaxBackoff != 0 {
+		spec.MaxBackoff = sc.MaxBackoff
+	}
+	return spec, nil
+}
+
+func parseOverflowPolicy(name string) (eventbus.OverflowPolicy, error) {
+	if name == "" {
+		return eventbus.OverflowBlock, nil
+	}
+	for _, policy := range []eventbus.OverflowPolicy{eventbus.OverflowBlock, eventbus.OverflowDropNewest, eventbus.OverflowDropOldest, eventbus.OverflowError} {
+		if policy.String() == name {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q", name)
+}
+
+func parseCyclePolicy(name string) (CyclePolicy, error) {
+	switch name {
+	case "", "warn":
+		return CycleWarn, nil
+	case "reject":
+		return CycleReject, nil
+	default:
+		return 0, fmt.Errorf("unknown cycle policy %q", name)
+	}
+}
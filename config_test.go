@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testFactories(t *testing.T) *Factories {
+	factories := NewFactories()
+	factories.MustRegisterSubsystem("recording", func(env FactoryEnv, name string, settings Settings) (*BaseSubsystem, error) {
+		var s struct {
+			Deps []string `yaml:"deps"`
+		}
+		err := settings.Decode(&s)
+		return NewBaseSubsystem(&recordingSubsystem{name: name, deps: s.Deps, recorder: &recorder{}}), err
+	})
+	factories.MustRegisterMiddleware("deny", func(env FactoryEnv, settings Settings) (RequestMiddleware, error) {
+		var s struct {
+			Method string `yaml:"method"`
+		}
+		if err := settings.Decode(&s); err != nil {
+			return nil, err
+		}
+		return func(req MethodRequest, next func(MethodRequest) error) error {
+			if req.Method == s.Method {
+				return ErrPermissionDenied
+			}
+			return next(req)
+		}, nil
+	})
+	require.Error(t, factories.RegisterSubsystem("recording", nil))
+	return factories
+}
+
+func TestBuildConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+bus:
+  worker_pool: {workers: 4, queue_size: 64, overflow: block}
+  metrics: {topics: [method]}
+supervisor:
+  strategy: one_for_all
+  window: 30s
+cycle_policy: reject
+access_policy:
+  rules:
+    - {caller: "*", subsystem: "*", methods: ["*"]}
+middleware:
+  - type: deny
+    name: no-secrets
+    settings: {method: secret}
+subsystems:
+  - type: subsystem1
+  - name: worker
+    type: recording
+    depends_on: [subsystem1]
+    mailbox: {capacity: 16, workers: 1}
+  - name: reporter
+    type: recording
+    settings:
+      deps: [worker]
+  - type: metrics
+    settings: {addr: "127.0.0.1:0"}
+`))
+	require.NoError(t, err)
+	overseer, err := testFactories(t).Build(context.Background(), config)
+	require.NoError(t, err)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+
+	bus := overseer.EventBus()
+	resp := SubsystemMethod(bus, "test", "worker", "ping")
+	require.NoError(t, resp.Error)
+	require.Equal(t, "worker", resp.Data)
+	require.ErrorIs(t, SubsystemMethod(bus, "test", "reporter", "secret").Error, ErrPermissionDenied)
+	require.Equal(t, []string{"subsystem1"}, overseer.dependencies["worker"])
+	require.Equal(t, []string{"worker"}, overseer.dependencies["reporter"])
+	require.True(t, overseer.Subsystems["worker"].servesOneAtATime())
+	require.Equal(t, OneForAll, overseer.supervisor.spec.Strategy)
+	require.Equal(t, DefaultSupervisorSpec.MaxRestarts, overseer.supervisor.spec.MaxRestarts)
+	require.Equal(t, CycleReject, overseer.cyclePolicy)
+	require.NotNil(t, overseer.Subsystems[MetricsName].impl.(*MetricsServer).Addr())
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overseer.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"subsystems": [{"type": "subsystem1"}, {"type": "subsystem2"}]}`), 0o644))
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	overseer, err := NewFactories().Build(context.Background(), config)
+	require.NoError(t, err)
+	require.Len(t, overseer.Subsystems, 2)
+
+	require.NoError(t, os.WriteFile(path, []byte("subsystems:\n  - type: subsystem1\n    restart: always\n"), 0o644))
+	_, err = LoadConfig(path)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.Contains(t, err.Error(), "line 3: field restart not found")
+}
+
+func TestConfigErrors(t *testing.T) {
+	factories := testFactories(t)
+	config, err := ParseConfig([]byte(`
+bus:
+  worker_pool: {workers: 0, queue_size: 8, overflow: spill}
+  metrics: {topics: ["a:#:b"]}
+supervisor: {strategy: one_for_some}
+cycle_policy: ignore
+middleware:
+  - type: audit
+subsystems:
+  - type: subsystem1
+  - type: subsystem1
+  - name: worker
+    type: missing
+    depends_on: [nobody]
+  - type: gateway
+  - type: recording
+    mailbox: {workers: 0}
+`))
+	require.NoError(t, err)
+	_, err = factories.Build(context.Background(), config)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	for _, problem := range []string{
+		`bus.worker_pool.overflow: unknown overflow policy "spill"`,
+		"bus.worker_pool.workers: must be at least 1",
+		`bus.metrics.topics: invalid pattern "a:#:b"`,
+		`supervisor.strategy: unknown strategy "one_for_some"`,
+		`cycle_policy: unknown cycle policy "ignore"`,
+		`middleware[0].type: unknown middleware type "audit"`,
+		`subsystems[1].name: "subsystem1" is already the name of subsystems[0]`,
+		`subsystems[2].type: unknown subsystem type "missing"`,
+		`subsystems[2].depends_on: unknown subsystem "nobody"`,
+		"subsystems[4].mailbox: capacity must not be negative and workers must be at least 1",
+	} {
+		require.Contains(t, err.Error(), problem)
+	}
+
+	config, err = ParseConfig([]byte(`
+subsystems:
+  - name: first
+    type: subsystem1
+  - type: gateway
+  - type: metrics
+    settings: {addr: ":0"}
+  - name: a
+    type: recording
+    settings:
+      deps: [b]
+      color: red
+  - name: b
+    type: recording
+    depends_on: [a]
+`))
+	require.NoError(t, err)
+	_, err = factories.Build(context.Background(), config)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	for _, problem := range []string{
+		`subsystems[0].name: subsystems of type subsystem1 are named "subsystem1", not "first"`,
+		`subsystems[1] (gateway).settings: missing setting "addr"`,
+		"subsystems[2] (metrics).settings: metrics are not enabled, see bus.metrics",
+		`subsystems[3] (a).settings: line 12: unknown setting "color"`,
+	} {
+		require.Contains(t, err.Error(), problem)
+	}
+
+	config.Subsystems = config.Subsystems[3:]
+	config.Subsystems[0].Settings = Settings{}
+	config.Subsystems[0].DependsOn = []string{"b"}
+	_, err = factories.Build(context.Background(), config)
+	require.ErrorIs(t, err, ErrDependencyCycle)
+	require.Contains(t, err.Error(), "subsystems[1].depends_on: dependency cycle: b -> a -> b")
+
+	for _, policy := range []string{"drop_newest", "drop_oldest", "error"} {
+		config := &Config{Bus: BusConfig{WorkerPool: &WorkerPoolConfig{Workers: 1, QueueSize: 1, Overflow: policy}}}
+		_, err = factories.Build(context.Background(), config)
+		require.ErrorIs(t, err, ErrInvalidConfig)
+		require.Contains(t, err.Error(), "bus.worker_pool.overflow: "+policy+" fails or loses events")
+	}
+}
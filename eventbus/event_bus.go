@@ -1,31 +1,43 @@
 package eventbus
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // BusSubscriber defines subscription-related bus behavior
 type BusSubscriber interface {
-	Subscribe(topic string, fn func(any)) error
-	SubscribeAsync(topic string, fn func(any), transactional bool) error
-	SubscribeOnce(topic string, fn func(any)) error
-	SubscribeOnceAsync(topic string, fn func(any)) error
+	Subscribe(topic string, fn func(any), opts ...SubscribeOption) (Subscription, error)
+	SubscribeAsync(topic string, fn func(any), transactional bool, opts ...SubscribeOption) (Subscription, error)
+	SubscribeOnce(topic string, fn func(any), opts ...SubscribeOption) (Subscription, error)
+	SubscribeOnceAsync(topic string, fn func(any), opts ...SubscribeOption) (Subscription, error)
+	SubscribePattern(pattern string, fn func(topic string, data any), opts ...SubscribeOption) (Subscription, error)
+	SubscribePatternAsync(pattern string, fn func(topic string, data any), transactional bool, opts ...SubscribeOption) (Subscription, error)
+	// Deprecated: use the Unsubscribe method of the Subscription returned by Subscribe.
 	Unsubscribe(topic string, handler func(any)) error
 	UnsubscribeAll(topic string) error
 }
 
 // BusPublisher defines publishing-related bus behavior
 type BusPublisher interface {
-	Publish(topic string, data any)
+	Publish(topic string, data any) error
 }
 
 // BusController defines bus control behavior (checking handler's presence, synchronization)
 type BusController interface {
+	Use(fn Middleware, opts ...MiddlewareOption) (func(), error)
+	// Deprecated: use Use.
 	AddMiddleware(*func(string, any) any)
+	// Deprecated: use the function returned by Use.
 	RemoveMiddleware(*func(string, any) any)
 	HasCallback(topic string) bool
+	Topics() []TopicInfo
+	Middleware() []MiddlewareInfo
 	WaitAsync()
 }
 
@@ -38,99 +50,144 @@ type Bus interface {
 
 // EventBus - box for handlers and callbacks.
 type EventBus struct {
-	middleware []*func(string, any) any
-	handlers   map[string][]*eventHandler
-	lock       sync.Mutex // a lock for the map
-	wg         sync.WaitGroup
+	middleware       atomic.Pointer[[]*middleware] // replaced, never modified, so Publish reads it without locking
+	middlewareLock   sync.Mutex                    // serializes changes to the middleware chain
+	legacyMiddleware map[*func(string, any) any]*middleware
+	handlers         map[string][]*eventHandler
+	patterns         *patternNode
+	lock             sync.Mutex // a lock for the map and the pattern trie
+	wg               sync.WaitGroup
+	pool             *pool // runs async handlers without a pool of their own, if set
+	log              *EventLog
+	logScope         *patternNode // the topics to log, or nil for every topic
+	metrics          Metrics
+	metricsScope     *patternNode // the topics reported by name, or nil for every topic
+	queue            atomic.Int64 // async handler invocations waiting to run, reported to metrics
 }
 
 type eventHandler struct {
 	callBack      func(any)
+	topicCallBack func(string, any) // set instead of callBack for pattern subscriptions
 	flagOnce      bool
 	async         bool
 	transactional bool
+	sub           *subscription
+	pool          *pool // overrides the pool of the bus, if set
 	sync.Mutex
 }
 
 // New returns new EventBus with empty handlers.
-func New() Bus {
+func New(opts ...Option) Bus {
 	b := &EventBus{
-		*new([]*func(string, any) any),
-		make(map[string][]*eventHandler),
-		sync.Mutex{},
-		sync.WaitGroup{},
+		legacyMiddleware: make(map[*func(string, any) any]*middleware),
+		handlers:         make(map[string][]*eventHandler),
+		patterns:         newPatternNode(),
+	}
+	for _, opt := range opts {
+		opt(b)
 	}
 	return Bus(b)
 }
 
 // doSubscribe handles the subscription logic and is utilized by the public Subscribe functions
-func (bus *EventBus) doSubscribe(topic string, handler *eventHandler) error {
+func (bus *EventBus) doSubscribe(topic string, handler *eventHandler, opts []SubscribeOption) (Subscription, error) {
+	sub, o := bus.newSubscription(topic, handler, opts)
 	bus.lock.Lock()
-	defer bus.lock.Unlock()
 	bus.handlers[topic] = append(bus.handlers[topic], handler)
-	return nil
-}
-
-func (bus *EventBus) AddMiddleware(middleware *func(string, any) any) {
-	bus.middleware = append(bus.middleware, middleware)
-}
-
-func (bus *EventBus) RemoveMiddleware(middleware *func(string, any) any) {
-	if middleware == nil {
-		return
-	}
-	index := -1
-	for i, m := range bus.middleware {
-		if middleware == m {
-			index = i
-		}
-	}
-	if index != -1 {
-		bus.middleware = append(bus.middleware[:index], bus.middleware[index+1:]...)
+	bus.lock.Unlock()
+	if o.ctx != nil {
+		sub.bind(o.ctx)
 	}
+	return sub, nil
 }
 
-func runMiddleware(middleware []*func(string, any) any, topic string, input any) (output any) {
-	output = input
-	for _, m := range middleware {
-		output = (*m)(topic, output)
+// newSubscription prepares a subscription of handler to topic, configured by opts.
+func (bus *EventBus) newSubscription(topic string, handler *eventHandler, opts []SubscribeOption) (*subscription, subscribeOptions) {
+	var o subscribeOptions
+	for _, opt := range opts {
+		opt(&o)
 	}
-	return
+	handler.pool = o.pool
+	sub := &subscription{bus: bus, topic: topic, handler: handler, done: make(chan struct{})}
+	handler.sub = sub
+	return sub, o
 }
 
 // Subscribe subscribes to a topic.
 // Returns error if `fn` is not a function.
-func (bus *EventBus) Subscribe(topic string, fn func(any)) error {
+func (bus *EventBus) Subscribe(topic string, fn func(any), opts ...SubscribeOption) (Subscription, error) {
 	return bus.doSubscribe(topic, &eventHandler{
-		fn, false, false, false, sync.Mutex{},
-	})
+		callBack: fn,
+	}, opts)
 }
 
 // SubscribeAsync subscribes to a topic with an asynchronous callback
 // Transactional determines whether subsequent callbacks for a topic are
 // run serially (true) or concurrently (false)
 // Returns error if `fn` is not a function.
-func (bus *EventBus) SubscribeAsync(topic string, fn func(any), transactional bool) error {
+func (bus *EventBus) SubscribeAsync(topic string, fn func(any), transactional bool, opts ...SubscribeOption) (Subscription, error) {
 	return bus.doSubscribe(topic, &eventHandler{
-		fn, false, true, transactional, sync.Mutex{},
-	})
+		callBack: fn, async: true, transactional: transactional,
+	}, opts)
 }
 
 // SubscribeOnce subscribes to a topic once. Handler will be removed after executing.
 // Returns error if `fn` is not a function.
-func (bus *EventBus) SubscribeOnce(topic string, fn func(any)) error {
+func (bus *EventBus) SubscribeOnce(topic string, fn func(any), opts ...SubscribeOption) (Subscription, error) {
 	return bus.doSubscribe(topic, &eventHandler{
-		fn, true, false, false, sync.Mutex{},
-	})
+		callBack: fn, flagOnce: true,
+	}, opts)
 }
 
 // SubscribeOnceAsync subscribes to a topic once with an asynchronous callback
 // Handler will be removed after executing.
 // Returns error if `fn` is not a function.
-func (bus *EventBus) SubscribeOnceAsync(topic string, fn func(any)) error {
+func (bus *EventBus) SubscribeOnceAsync(topic string, fn func(any), opts ...SubscribeOption) (Subscription, error) {
 	return bus.doSubscribe(topic, &eventHandler{
-		fn, true, true, false, sync.Mutex{},
-	})
+		callBack: fn, flagOnce: true, async: true,
+	}, opts)
+}
+
+// SubscribePattern subscribes to every topic matching pattern. fn receives the topic of each event
+// along with its data. Patterns are matched segment by segment, where segments are separated by
+// ':' or '/' (the two are interchangeable, and empty segments are ignored). A pattern segment is
+//
+//   - "+", matching exactly one segment,
+//   - "#", the last segment only, matching any number of remaining segments, including none,
+//   - a glob such as "subsystem*", where '*' matches any run of characters within the segment,
+//   - or any other string, matching itself.
+//
+// So "+:error" matches "subsystem1:error", "subsystem*:start" matches "subsystem2:start", and
+// "lifecycle/#" matches "lifecycle", "lifecycle/start" and "lifecycle/subsystem1/stop".
+// Returns error if the pattern is malformed.
+func (bus *EventBus) SubscribePattern(pattern string, fn func(topic string, data any), opts ...SubscribeOption) (Subscription, error) {
+	return bus.doSubscribePattern(pattern, &eventHandler{
+		topicCallBack: fn,
+	}, opts)
+}
+
+// SubscribePatternAsync subscribes to every topic matching pattern with an asynchronous callback.
+// Transactional determines whether subsequent callbacks are run serially (true) or concurrently (false).
+// Returns error if the pattern is malformed.
+func (bus *EventBus) SubscribePatternAsync(pattern string, fn func(topic string, data any), transactional bool, opts ...SubscribeOption) (Subscription, error) {
+	return bus.doSubscribePattern(pattern, &eventHandler{
+		topicCallBack: fn, async: true, transactional: transactional,
+	}, opts)
+}
+
+func (bus *EventBus) doSubscribePattern(pattern string, handler *eventHandler, opts []SubscribeOption) (Subscription, error) {
+	if err := validatePattern(pattern); err != nil {
+		return nil, err
+	}
+	sub, o := bus.newSubscription(pattern, handler, opts)
+	sub.pattern = true
+	bus.lock.Lock()
+	bus.patterns.insert(splitTopic(pattern), handler)
+	bus.lock.Unlock()
+	if o.ctx != nil {
+		sub.bind(o.ctx)
+	}
+	return sub, nil
 }
 
 // HasCallback returns true if exists any callback subscribed to the topic.
@@ -144,67 +201,190 @@ func (bus *EventBus) HasCallback(topic string) bool {
 	return false
 }
 
+// TopicInfo describes a topic, or a pattern, with subscribers.
+type TopicInfo struct {
+	Topic       string `json:"topic"`
+	Pattern     bool   `json:"pattern,omitempty"`
+	Subscribers int    `json:"subscribers"`
+}
+
+// Topics returns the topics and patterns with subscribers, sorted by name.
+func (bus *EventBus) Topics() []TopicInfo {
+	bus.lock.Lock()
+	topics := make([]TopicInfo, 0, len(bus.handlers))
+	for topic, handlers := range bus.handlers {
+		if len(handlers) > 0 {
+			topics = append(topics, TopicInfo{Topic: topic, Subscribers: len(handlers)})
+		}
+	}
+	patterns := make(map[string]int)
+	bus.patterns.each(func(handler *eventHandler) {
+		patterns[handler.sub.topic]++
+	})
+	bus.lock.Unlock()
+	for pattern, subscribers := range patterns {
+		topics = append(topics, TopicInfo{Topic: pattern, Pattern: true, Subscribers: subscribers})
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if topics[i].Topic != topics[j].Topic {
+			return topics[i].Topic < topics[j].Topic
+		}
+		return !topics[i].Pattern
+	})
+	return topics
+}
+
 // Unsubscribe removes callback defined for a topic.
 // Returns error if there are no callbacks subscribed to the topic.
+//
+// Deprecated: handlers are found by comparing function values, which cannot tell closures or two
+// subscriptions of the same function apart. Use the Unsubscribe method of the Subscription
+// returned by Subscribe instead.
 func (bus *EventBus) Unsubscribe(topic string, handler func(any)) error {
 	bus.lock.Lock()
-	defer bus.lock.Unlock()
-	if _, ok := bus.handlers[topic]; ok && len(bus.handlers[topic]) > 0 {
-		bus.removeHandler(topic, bus.findHandlerIdx(topic, handler))
-		return nil
+	if _, ok := bus.handlers[topic]; !ok || len(bus.handlers[topic]) == 0 {
+		bus.lock.Unlock()
+		return fmt.Errorf("topic %s doesn't exist", topic)
 	}
-	return fmt.Errorf("topic %s doesn't exist", topic)
+	found := bus.findHandler(topic, handler)
+	bus.removeHandler(topic, found)
+	bus.lock.Unlock()
+	if found != nil {
+		found.sub.finish()
+	}
+	return nil
 }
 
+// UnsubscribeAll removes every callback defined for a topic.
+// Returns error if there are no callbacks subscribed to the topic.
 func (bus *EventBus) UnsubscribeAll(topic string) error {
 	bus.lock.Lock()
-	defer bus.lock.Unlock()
-	if _, ok := bus.handlers[topic]; ok && len(bus.handlers[topic]) > 0 {
-		for i := 0; i < len(bus.handlers[topic]); i++ {
-			bus.removeHandler(topic, i)
+	handlers := bus.handlers[topic]
+	delete(bus.handlers, topic)
+	bus.lock.Unlock()
+	if len(handlers) == 0 {
+		return fmt.Errorf("topic %s doesn't exist", topic)
+	}
+	for _, handler := range handlers {
+		handler.sub.finish()
+	}
+	return nil
+}
+
+// Publish runs the middleware chain for an event, and executes the callbacks defined for its topic.
+// Returns the error of a middleware that rejected the event, ErrQueueFull if the event was
+// discarded by a worker pool with the OverflowError policy, or the error of the event log. Events
+// that could not be logged are not delivered.
+func (bus *EventBus) Publish(topic string, data any) error {
+	var chain []*middleware
+	if p := bus.middleware.Load(); p != nil {
+		chain = *p
+	}
+	segments := splitTopic(topic)
+	if bus.metrics != nil {
+		if inScope(bus.metricsScope, segments) {
+			bus.metrics.EventPublished(topic)
+		} else {
+			bus.metrics.EventPublished(OtherTopics)
 		}
-		return nil
 	}
-	return fmt.Errorf("topic %s doesn't exist", topic)
+	return bus.runMiddleware(chain, 0, topic, segments, data)
 }
 
-// Publish executes callback defined for a topic. Any additional argument will be transferred to the callback.
-func (bus *EventBus) Publish(topic string, data any) {
+// deliver appends an event to the event log, if the bus has one, and executes the callbacks
+// defined for its topic, made of segments. An event that could not be logged is dropped, so that
+// the log holds every event that was delivered. The event is logged under bus.lock, so that the
+// log holds the events in the order they were delivered.
+func (bus *EventBus) deliver(topic string, segments []string, data any) error {
+	var errs []error
 	bus.lock.Lock() // will unlock if handler is not found or always after setUpPublish
 	defer bus.lock.Unlock()
+	if bus.log != nil && inScope(bus.logScope, segments) {
+		if _, err := bus.log.Append(topic, data); err != nil {
+			return fmt.Errorf("could not log event: %w", err)
+		}
+	}
 	if handlers, ok := bus.handlers[topic]; ok && 0 < len(handlers) {
 		// Handlers slice may be changed by removeHandler and Unsubscribe during iteration,
 		// so make a copy and iterate the copied slice.
 		copyHandlers := make([]*eventHandler, 0, len(handlers))
 		copyHandlers = append(copyHandlers, handlers...)
-		for i, handler := range copyHandlers {
+		for _, handler := range copyHandlers {
 			if handler.flagOnce {
-				bus.removeHandler(topic, i)
-			}
-			if !handler.async {
-				bus.doPublish(handler, topic, data)
-			} else {
-				bus.wg.Add(1)
-				if handler.transactional {
-					bus.lock.Unlock()
-					handler.Lock()
-					bus.lock.Lock()
+				if !bus.removeHandler(topic, handler) {
+					// removed while a transactional handler released the lock
+					continue
 				}
-				go bus.doPublishAsync(handler, topic, data)
+				handler.sub.finish()
+			}
+			if err := bus.publishTo(handler, topic, data); err != nil {
+				errs = append(errs, err)
 			}
 		}
 	}
+	// match returns a fresh slice, so pattern handlers may be unsubscribed during iteration
+	for _, handler := range bus.patterns.match(segments, nil) {
+		if err := bus.publishTo(handler, topic, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publishTo runs handler for an event, in place, on a worker pool or in a goroutine. The caller
+// holds bus.lock.
+func (bus *EventBus) publishTo(handler *eventHandler, topic string, data any) error {
+	if !handler.async {
+		bus.doPublish(handler, topic, data)
+		return nil
+	}
+	bus.wg.Add(1)
+	if handler.transactional {
+		bus.lock.Unlock()
+		handler.Lock()
+		bus.lock.Lock()
+	}
+	p := handler.pool
+	if p == nil {
+		p = bus.pool
+	}
+	bus.queued(1)
+	if p == nil {
+		go bus.doPublishAsync(handler, topic, data)
+		return nil
+	}
+	// the queue may be full, so let other publishers and subscribers through while waiting for it
+	bus.lock.Unlock()
+	defer bus.lock.Lock()
+	return p.submit(job{
+		run: func() {
+			bus.doPublishAsync(handler, topic, data)
+		},
+		drop: func() {
+			bus.queued(-1)
+			if handler.transactional {
+				handler.Unlock()
+			}
+			bus.wg.Done()
+		},
+	})
 }
 
-func (bus *EventBus) doPublish(handler *eventHandler, topic string, origData any) {
-	modData := runMiddleware(bus.middleware, topic, origData)
-	if modData == nil {
+func (bus *EventBus) doPublish(handler *eventHandler, topic string, data any) {
+	if bus.metrics != nil {
+		defer func(start time.Time) {
+			bus.metrics.HandlerDone(bus.metricsTopic(topic), handler.async, time.Since(start))
+		}(time.Now())
+	}
+	if handler.topicCallBack != nil {
+		handler.topicCallBack(topic, data)
 		return
 	}
-	handler.callBack(modData)
+	handler.callBack(data)
 }
 
 func (bus *EventBus) doPublishAsync(handler *eventHandler, topic string, data any) {
+	bus.queued(-1)
 	defer bus.wg.Done()
 	if handler.transactional {
 		defer handler.Unlock()
@@ -212,33 +392,32 @@ func (bus *EventBus) doPublishAsync(handler *eventHandler, topic string, data an
 	bus.doPublish(handler, topic, data)
 }
 
-func (bus *EventBus) removeHandler(topic string, idx int) {
-	if _, ok := bus.handlers[topic]; !ok {
-		return
-	}
-	l := len(bus.handlers[topic])
-
-	if !(0 <= idx && idx < l) {
-		return
-	}
-
-	copy(bus.handlers[topic][idx:], bus.handlers[topic][idx+1:])
-	bus.handlers[topic][l-1] = nil // or the zero value of T
-	bus.handlers[topic] = bus.handlers[topic][:l-1]
-	if len(bus.handlers[topic]) == 0 {
-		delete(bus.handlers, topic)
+// removeHandler removes handler from the handlers of topic, and reports whether it was subscribed.
+func (bus *EventBus) removeHandler(topic string, handler *eventHandler) bool {
+	handlers := bus.handlers[topic]
+	for idx, h := range handlers {
+		if h != handler {
+			continue
+		}
+		l := len(handlers)
+		copy(handlers[idx:], handlers[idx+1:])
+		handlers[l-1] = nil // or the zero value of T
+		bus.handlers[topic] = handlers[:l-1]
+		if len(bus.handlers[topic]) == 0 {
+			delete(bus.handlers, topic)
+		}
+		return true
 	}
+	return false
 }
 
-func (bus *EventBus) findHandlerIdx(topic string, callback func(any)) int {
-	if _, ok := bus.handlers[topic]; ok {
-		for idx, handler := range bus.handlers[topic] {
-			if reflect.ValueOf(handler.callBack) == reflect.ValueOf(callback) {
-				return idx
-			}
+func (bus *EventBus) findHandler(topic string, callback func(any)) *eventHandler {
+	for _, handler := range bus.handlers[topic] {
+		if reflect.ValueOf(handler.callBack) == reflect.ValueOf(callback) {
+			return handler
 		}
 	}
-	return -1
+	return nil
 }
 
 // WaitAsync waits for all async callbacks to complete
@@ -15,7 +15,7 @@ func TestNew(t *testing.T) {
 
 func TestHasCallback(t *testing.T) {
 	bus := New()
-	_ = bus.Subscribe("topic", func(any) {})
+	_, _ = bus.Subscribe("topic", func(any) {})
 	if bus.HasCallback("topic_topic") {
 		t.Fail()
 	}
@@ -24,16 +24,42 @@ func TestHasCallback(t *testing.T) {
 	}
 }
 
+func TestTopics(t *testing.T) {
+	bus := New()
+	_, _ = bus.Subscribe("topic", func(any) {})
+	_, _ = bus.SubscribeAsync("topic", func(any) {}, false)
+	sub, _ := bus.Subscribe("other", func(any) {})
+	_, _ = bus.SubscribePattern("topic", func(string, any) {})
+	_, _ = bus.SubscribePattern("subsystem*:#", func(string, any) {})
+	_, _ = bus.SubscribePattern("subsystem*:#", func(string, any) {})
+	sub.Unsubscribe()
+
+	want := []TopicInfo{
+		{Topic: "subsystem*:#", Pattern: true, Subscribers: 2},
+		{Topic: "topic", Subscribers: 2},
+		{Topic: "topic", Pattern: true, Subscribers: 1},
+	}
+	got := bus.Topics()
+	if len(got) != len(want) {
+		t.Fatalf("got topics %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got topic %v, want %v", got[i], want[i])
+		}
+	}
+}
+
 func TestSubscribe(t *testing.T) {
 	bus := New()
-	if bus.Subscribe("topic", func(any) {}) != nil {
+	if _, err := bus.Subscribe("topic", func(any) {}); err != nil {
 		t.Fail()
 	}
 }
 
 func TestSubscribeOnce(t *testing.T) {
 	bus := New()
-	if bus.SubscribeOnce("topic", func(any) {}) != nil {
+	if _, err := bus.SubscribeOnce("topic", func(any) {}); err != nil {
 		t.Fail()
 	}
 }
@@ -43,9 +69,9 @@ func TestSubscribeOnceAndManySubscribe(t *testing.T) {
 	event := "topic"
 	flag := 0
 	fn := func(any) { flag += 1 }
-	_ = bus.SubscribeOnce(event, fn)
-	_ = bus.Subscribe(event, fn)
-	_ = bus.Subscribe(event, fn)
+	_, _ = bus.SubscribeOnce(event, fn)
+	_, _ = bus.Subscribe(event, fn)
+	_, _ = bus.Subscribe(event, fn)
 	bus.Publish(event, nil)
 
 	if flag != 3 {
@@ -56,7 +82,7 @@ func TestSubscribeOnceAndManySubscribe(t *testing.T) {
 func TestUnsubscribe(t *testing.T) {
 	bus := New()
 	handler := func(any) {}
-	_ = bus.Subscribe("topic", handler)
+	_, _ = bus.Subscribe("topic", handler)
 	if bus.Unsubscribe("topic", handler) != nil {
 		t.Fail()
 	}
@@ -68,7 +94,7 @@ func TestUnsubscribe(t *testing.T) {
 func TestUnsubscribeAll(t *testing.T) {
 	bus := New()
 	handler := func(any) {}
-	_ = bus.Subscribe("topic", handler)
+	_, _ = bus.Subscribe("topic", handler)
 	if bus.UnsubscribeAll("topic") != nil {
 		t.Fail()
 	}
@@ -84,7 +110,7 @@ type AB struct {
 
 func TestPublish(t *testing.T) {
 	bus := New()
-	_ = bus.Subscribe("topic", func(ab any) {
+	_, _ = bus.Subscribe("topic", func(ab any) {
 		abstruct := ab.(AB)
 		if abstruct.A != abstruct.B {
 			t.Fail()
@@ -102,7 +128,7 @@ func TestSubcribeOnceAsync(t *testing.T) {
 	results := make([]int, 0)
 
 	bus := New()
-	_ = bus.SubscribeOnceAsync("topic", func(aout any) {
+	_, _ = bus.SubscribeOnceAsync("topic", func(aout any) {
 		aoutstruct := aout.(AOUT)
 		*aoutstruct.Out = append(*aoutstruct.Out, aoutstruct.A)
 	})
@@ -131,7 +157,7 @@ func TestSubscribeAsyncTransactional(t *testing.T) {
 	results := make([]int, 0)
 
 	bus := New()
-	_ = bus.SubscribeAsync("topic", func(aoutdur any) {
+	_, _ = bus.SubscribeAsync("topic", func(aoutdur any) {
 		aoutdurstruct := aoutdur.(AOUTDUR)
 		sleep, _ := time.ParseDuration(aoutdurstruct.Dur)
 		time.Sleep(sleep)
@@ -161,7 +187,7 @@ func TestSubscribeAsync(t *testing.T) {
 	results := make(chan int)
 
 	bus := New()
-	_ = bus.SubscribeAsync("topic", func(aoutch any) {
+	_, _ = bus.SubscribeAsync("topic", func(aoutch any) {
 		aoutchstruct := aoutch.(AOUTCH)
 		aoutchstruct.Out <- aoutchstruct.A
 	}, false)
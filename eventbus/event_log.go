@@ -0,0 +1,446 @@
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLogClosed is returned by the methods of a closed EventLog.
+var ErrLogClosed = errors.New("event log closed")
+
+// errCorruptRecord is returned while reading a record that is truncated or fails its checksum.
+var errCorruptRecord = errors.New("corrupt record")
+
+const (
+	defaultSegmentSize = 64 << 20
+	maxRecordSize      = 64 << 20
+	recordHeaderSize   = 8 // length and checksum of the record body
+	segmentSuffix      = ".log"
+	offsetsFile        = "offsets.json"
+)
+
+// Codec encodes the data of the events written to an EventLog.
+type Codec interface {
+	Encode(data any) ([]byte, error)
+	Decode(b []byte) (any, error)
+}
+
+// GobCodec encodes event data with encoding/gob, so the concrete types of the data must be
+// registered with gob.Register. It is the default codec of an EventLog.
+type GobCodec struct{}
+
+// gobEvent wraps the data of an event, since gob cannot encode a nil interface on its own.
+type gobEvent struct {
+	Data any
+}
+
+func (GobCodec) Encode(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(gobEvent{Data: data}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Decode(b []byte) (any, error) {
+	var event gobEvent
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&event)
+	return event.Data, err
+}
+
+// JSONCodec encodes event data as JSON. Replayed data is decoded into the generic types of
+// encoding/json, such as map[string]any, rather than the types that were published.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(data any) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+func (JSONCodec) Decode(b []byte) (any, error) {
+	var data any
+	err := json.Unmarshal(b, &data)
+	return data, err
+}
+
+// Event is an event read back from an EventLog.
+type Event struct {
+	Offset uint64
+	Time   time.Time
+	Topic  string
+	Data   any
+}
+
+// WithEventLog appends the events published on the bus to log once they passed the middleware
+// chain, in the order they are delivered. Events that could not be logged are not delivered, and
+// Publish returns the error. If topics are given, only events on topics matching one of the
+// patterns are logged, see SubscribePattern. It returns an error if a pattern is malformed.
+func WithEventLog(log *EventLog, topics ...string) (Option, error) {
+	scope, err := newScope(topics)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event log topics: %w", err)
+	}
+	return func(bus *EventBus) {
+		bus.log, bus.logScope = log, scope
+	}, nil
+}
+
+// LogOption configures an EventLog.
+type LogOption func(*EventLog)
+
+// WithCodec sets the codec encoding the data of events, GobCodec by default.
+func WithCodec(codec Codec) LogOption {
+	return func(l *EventLog) {
+		l.codec = codec
+	}
+}
+
+// WithSegmentSize sets the size in bytes after which the log starts a new segment file, 64 MiB
+// by default.
+func WithSegmentSize(size int64) LogOption {
+	return func(l *EventLog) {
+		l.segmentSize = size
+	}
+}
+
+// EventLog is an append-only log of events, stored in a directory as segment files named after
+// the offset of their first event. Every event gets the next offset, starting from 0. A record
+// torn by a crash is discarded when the log is opened again.
+type EventLog struct {
+	dir         string
+	codec       Codec
+	segmentSize int64
+	lock        sync.Mutex // guards the fields below
+	segments    []uint64   // first offsets of the segments, ascending
+	active      *os.File   // the last segment
+	size        int64      // of the last segment
+	next        uint64
+	offsets     map[string]uint64
+	closed      bool
+}
+
+// OpenEventLog opens the event log in dir, creating it if needed.
+func OpenEventLog(dir string, opts ...LogOption) (*EventLog, error) {
+	l := &EventLog{dir: dir, codec: GobCodec{}, segmentSize: defaultSegmentSize, offsets: make(map[string]uint64)}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		l.segments = append(l.segments, base)
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+	if len(l.segments) == 0 {
+		l.segments = []uint64{0}
+	}
+	if err := l.recover(); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(dir, offsetsFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		l.active.Close()
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &l.offsets); err != nil {
+			l.active.Close()
+			return nil, fmt.Errorf("could not read consumer offsets: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// recover opens the last segment, truncating it after its last intact record, and finds the next
+// offset.
+func (l *EventLog) recover() error {
+	base := l.segments[len(l.segments)-1]
+	f, err := os.OpenFile(l.segmentPath(base), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.next = base
+	r := bufio.NewReader(f)
+	var size int64
+	for {
+		rec, n, err := readRecord(r)
+		if err != nil {
+			break
+		}
+		size += int64(n)
+		l.next = rec.offset + 1
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	l.active, l.size = f, size
+	return nil
+}
+
+func (l *EventLog) segmentPath(base uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%v", base, segmentSuffix))
+}
+
+// Append writes an event to the log, and returns its offset.
+func (l *EventLog) Append(topic string, data any) (uint64, error) {
+	payload, err := l.codec.Encode(data)
+	if err != nil {
+		return 0, fmt.Errorf("could not encode event on %v: %w", topic, err)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return 0, ErrLogClosed
+	}
+	b := encodeRecord(record{offset: l.next, time: time.Now(), topic: topic, payload: payload})
+	if len(b) > maxRecordSize {
+		return 0, fmt.Errorf("event on %v is %d bytes, more than %d", topic, len(b), maxRecordSize)
+	}
+	if l.size > 0 && l.size+int64(len(b)) > l.segmentSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if n, err := l.active.Write(b); err != nil {
+		// drop what was written of the record, so the next one does not follow a torn record
+		_ = l.active.Truncate(l.size)
+		return 0, fmt.Errorf("could not write event on %v after %d bytes: %w", topic, n, err)
+	}
+	l.size += int64(len(b))
+	l.next++
+	return l.next - 1, nil
+}
+
+// rotate starts a new segment at the next offset. The caller holds l.lock.
+func (l *EventLog) rotate() error {
+	f, err := os.OpenFile(l.segmentPath(l.next), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := l.active.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	l.active.Close()
+	l.active, l.size = f, 0
+	l.segments = append(l.segments, l.next)
+	return nil
+}
+
+// NextOffset returns the offset the next appended event will get.
+func (l *EventLog) NextOffset() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.next
+}
+
+// Replay calls fn for the events from offset from on, up to the last event appended before Replay
+// was called, in order. If filter is not empty, only events on topics matching the pattern are
+// replayed, see SubscribePattern. Replay stops at the first error returned by fn, and returns it.
+func (l *EventLog) Replay(from uint64, filter string, fn func(Event) error) error {
+	var scope *patternNode
+	if filter != "" {
+		var err error
+		if scope, err = newScope([]string{filter}); err != nil {
+			return err
+		}
+	}
+	l.lock.Lock()
+	if l.closed {
+		l.lock.Unlock()
+		return ErrLogClosed
+	}
+	segments := append([]uint64(nil), l.segments...)
+	end := l.next
+	l.lock.Unlock()
+
+	// start at the last segment beginning at or before from
+	first := max(sort.Search(len(segments), func(i int) bool { return segments[i] > from })-1, 0)
+	for _, base := range segments[first:] {
+		if base >= end {
+			break
+		}
+		if err := l.replaySegment(base, from, end, scope, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *EventLog) replaySegment(base uint64, from uint64, end uint64, scope *patternNode, fn func(Event) error) error {
+	f, err := os.Open(l.segmentPath(base))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		rec, _, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read segment %v: %w", base, err)
+		}
+		if rec.offset >= end {
+			return nil
+		}
+		if rec.offset >= from && inScope(scope, splitTopic(rec.topic)) {
+			data, err := l.codec.Decode(rec.payload)
+			if err != nil {
+				return fmt.Errorf("could not decode event %d: %w", rec.offset, err)
+			}
+			if err := fn(Event{Offset: rec.offset, Time: rec.time, Topic: rec.topic, Data: data}); err != nil {
+				return err
+			}
+		}
+		// the records after end may still be written, so stop before reading them
+		if rec.offset+1 >= end {
+			return nil
+		}
+	}
+}
+
+// Offset returns the offset of the first event consumer has not processed yet, as committed with
+// Commit, or 0 if consumer never committed.
+func (l *EventLog) Offset(consumer string) uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.offsets[consumer]
+}
+
+// Commit records that consumer processed the events before offset next. Offsets are stored in
+// the directory of the log, so they survive restarts.
+func (l *EventLog) Commit(consumer string, next uint64) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return ErrLogClosed
+	}
+	l.offsets[consumer] = next
+	b, err := json.Marshal(l.offsets)
+	if err != nil {
+		return err
+	}
+	// replace the file at once, so a crash leaves either the old or the new offsets
+	tmp := filepath.Join(l.dir, offsetsFile+".tmp")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(l.dir, offsetsFile))
+}
+
+// CatchUp replays the events consumer has not processed yet, see Replay, and commits the offset
+// of each event fn handled without error.
+func (l *EventLog) CatchUp(consumer string, filter string, fn func(Event) error) error {
+	return l.Replay(l.Offset(consumer), filter, func(event Event) error {
+		if err := fn(event); err != nil {
+			return err
+		}
+		return l.Commit(consumer, event.Offset+1)
+	})
+}
+
+// Sync commits the appended events to stable storage.
+func (l *EventLog) Sync() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return ErrLogClosed
+	}
+	return l.active.Sync()
+}
+
+// Close syncs and closes the log.
+func (l *EventLog) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return errors.Join(l.active.Sync(), l.active.Close())
+}
+
+// record is an event as stored in a segment: a header holding the length and the CRC-32 of the
+// body, followed by the body holding the offset, the time, the topic and the encoded data.
+type record struct {
+	offset  uint64
+	time    time.Time
+	topic   string
+	payload []byte
+}
+
+func encodeRecord(rec record) []byte {
+	b := make([]byte, recordHeaderSize, recordHeaderSize+16+binary.MaxVarintLen64+len(rec.topic)+len(rec.payload))
+	b = binary.BigEndian.AppendUint64(b, rec.offset)
+	b = binary.BigEndian.AppendUint64(b, uint64(rec.time.UnixNano()))
+	b = binary.AppendUvarint(b, uint64(len(rec.topic)))
+	b = append(b, rec.topic...)
+	b = append(b, rec.payload...)
+	body := b[recordHeaderSize:]
+	binary.BigEndian.PutUint32(b, uint32(len(body)))
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(body))
+	return b
+}
+
+// readRecord reads the next record from r, and returns it with its size. It returns io.EOF at the
+// end of r, and errCorruptRecord for a truncated or damaged record.
+func readRecord(r *bufio.Reader) (record, int, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return record{}, 0, errCorruptRecord
+		}
+		return record{}, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length < 16 || length > maxRecordSize {
+		return record{}, 0, errCorruptRecord
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return record{}, 0, errCorruptRecord
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:]) {
+		return record{}, 0, errCorruptRecord
+	}
+	rec := record{
+		offset: binary.BigEndian.Uint64(body),
+		time:   time.Unix(0, int64(binary.BigEndian.Uint64(body[8:]))),
+	}
+	topicLen, n := binary.Uvarint(body[16:])
+	if n <= 0 || topicLen > uint64(len(body)-16-n) {
+		return record{}, 0, errCorruptRecord
+	}
+	rest := body[16+n:]
+	rec.topic, rec.payload = string(rest[:topicLen]), rest[topicLen:]
+	return rec, recordHeaderSize + int(length), nil
+}
@@ -0,0 +1,225 @@
+package eventbus
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func replayAll(t *testing.T, l *EventLog, from uint64, filter string) []Event {
+	var events []Event
+	if err := l.Replay(from, filter, func(event Event) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestEventLogReplay(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenEventLog(dir, WithSegmentSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		topic := fmt.Sprintf("subsystem%d:tick", i%2+1)
+		if offset, err := l.Append(topic, i); err != nil || offset != uint64(i) {
+			t.Fatalf("appended %v at %v: %v", i, offset, err)
+		}
+	}
+	if len(l.segments) < 2 {
+		t.Errorf("log did not rotate: %v", l.segments)
+	}
+
+	events := replayAll(t, l, 5, "")
+	if len(events) != 15 || events[0].Offset != 5 || events[0].Data != 5 || events[14].Data != 19 {
+		t.Errorf("replayed %v", events)
+	}
+	events = replayAll(t, l, 0, "subsystem2:+")
+	if len(events) != 10 || events[0].Topic != "subsystem2:tick" || events[0].Data != 1 {
+		t.Errorf("replayed %v", events)
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = l.Replay(0, "", func(Event) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("replay returned %v after %d calls", err, calls)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Append("topic", nil); !errors.Is(err, ErrLogClosed) {
+		t.Errorf("closed log returned %v", err)
+	}
+}
+
+func TestEventLogRecovery(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenEventLog(dir, WithCodec(JSONCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = l.Append("topic", "first")
+	_, _ = l.Append("topic", "second")
+	_ = l.Close()
+
+	// simulate a crash in the middle of writing a record
+	path := l.segmentPath(0)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = OpenEventLog(dir, WithCodec(JSONCodec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if offset, err := l.Append("topic", "third"); err != nil || offset != 1 {
+		t.Fatalf("appended at %v: %v", offset, err)
+	}
+	events := replayAll(t, l, 0, "")
+	if len(events) != 2 || events[0].Data != "first" || events[1].Data != "third" {
+		t.Errorf("replayed %v", events)
+	}
+}
+
+func TestEventLogConsumerOffsets(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenEventLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = l.Append("topic", i)
+	}
+	var seen []any
+	errCrash := errors.New("crash")
+	err = l.CatchUp("consumer", "", func(event Event) error {
+		if event.Data == 3 {
+			return errCrash
+		}
+		seen = append(seen, event.Data)
+		return nil
+	})
+	if !errors.Is(err, errCrash) || len(seen) != 3 {
+		t.Fatalf("caught up on %v: %v", seen, err)
+	}
+	_ = l.Close()
+
+	l, err = OpenEventLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.Offset("consumer") != 3 || l.Offset("other") != 0 {
+		t.Errorf("offsets %v", l.offsets)
+	}
+	err = l.CatchUp("consumer", "", func(event Event) error {
+		seen = append(seen, event.Data)
+		return nil
+	})
+	if err != nil || fmt.Sprint(seen) != "[0 1 2 3 4]" || l.Offset("consumer") != 5 {
+		t.Errorf("caught up on %v: %v", seen, err)
+	}
+}
+
+func TestBusEventLog(t *testing.T) {
+	l, err := OpenEventLog(filepath.Join(t.TempDir(), "events"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	logOpt, err := WithEventLog(l, "subsystem*:#")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := New(logOpt)
+	_, _ = bus.Use(func(topic string, data any, next Next) error {
+		if data == "secret" {
+			return nil
+		}
+		if s, ok := data.(string); ok {
+			data = strings.ToUpper(s)
+		}
+		return next(data)
+	})
+	for _, topic := range []string{"subsystem1:start", "other", "subsystem2:stop"} {
+		if err := bus.Publish(topic, topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = bus.Publish("subsystem1:secret", "secret")
+
+	events := replayAll(t, l, 0, "")
+	if len(events) != 2 || events[0].Data != "SUBSYSTEM1:START" || events[1].Topic != "subsystem2:stop" {
+		t.Errorf("logged %v", events)
+	}
+
+	delivered := false
+	if _, err := bus.Subscribe("subsystem1:start", func(any) { delivered = true }); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish("subsystem1:start", func() {}); err == nil {
+		t.Error("event that cannot be encoded was logged")
+	}
+	if delivered {
+		t.Error("event that could not be logged was delivered")
+	}
+
+	if _, err := WithEventLog(l, "a/#/b"); err == nil {
+		t.Error("malformed pattern was accepted")
+	}
+}
+
+func TestBusEventLogOrder(t *testing.T) {
+	l, err := OpenEventLog(filepath.Join(t.TempDir(), "events"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	logOpt, err := WithEventLog(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := New(logOpt)
+	var delivered []any
+	_, _ = bus.Subscribe("topic", func(data any) {
+		delivered = append(delivered, data)
+	})
+	const publishers, events = 8, 100
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < events; i++ {
+				_ = bus.Publish("topic", p*events+i)
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	logged := replayAll(t, l, 0, "")
+	if len(logged) != len(delivered) {
+		t.Fatalf("logged %d events, delivered %d", len(logged), len(delivered))
+	}
+	for i, event := range logged {
+		if event.Data != delivered[i] {
+			t.Fatalf("event %d: logged %v, delivered %v", i, event.Data, delivered[i])
+		}
+	}
+}
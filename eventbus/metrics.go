@@ -0,0 +1,47 @@
+package eventbus
+
+import "time"
+
+// OtherTopics is the topic reported to Metrics for the events on topics outside the scope given to
+// WithMetrics.
+const OtherTopics = "_other"
+
+// Metrics receives measurements of a bus, see WithMetrics. Its methods are called concurrently, and
+// from the publishing goroutine, so they must be safe for concurrent use and cheap.
+type Metrics interface {
+	// EventPublished counts an event published on topic, before the middleware chain runs.
+	EventPublished(topic string)
+	// HandlerDone records how long a handler took to handle an event published on topic.
+	HandlerDone(topic string, async bool, duration time.Duration)
+	// AsyncQueueDepth reports the number of async handler invocations waiting to run.
+	AsyncQueueDepth(depth int)
+}
+
+// WithMetrics reports the events published on the bus and the handlers they run to m. If topics
+// are given, events on topics matching none of the patterns are reported as OtherTopics, see
+// SubscribePattern; as every method call is answered on a topic of its own, that keeps the number
+// of topics reported bounded. It panics if a pattern is malformed.
+func WithMetrics(m Metrics, topics ...string) Option {
+	scope, err := newScope(topics)
+	if err != nil {
+		panic(err)
+	}
+	return func(bus *EventBus) {
+		bus.metrics, bus.metricsScope = m, scope
+	}
+}
+
+// metricsTopic returns the topic to report to the metrics of the bus for an event on topic.
+func (bus *EventBus) metricsTopic(topic string) string {
+	if bus.metricsScope == nil || inScope(bus.metricsScope, splitTopic(topic)) {
+		return topic
+	}
+	return OtherTopics
+}
+
+// queued adds delta to the number of async handler invocations waiting to run.
+func (bus *EventBus) queued(delta int64) {
+	if bus.metrics != nil {
+		bus.metrics.AsyncQueueDepth(int(bus.queue.Add(delta)))
+	}
+}
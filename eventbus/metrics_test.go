@@ -0,0 +1,69 @@
+package eventbus
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedMetrics struct {
+	lock      sync.Mutex
+	published map[string]int
+	handled   map[string]int
+	maxDepth  int
+	depth     int
+}
+
+func (m *recordedMetrics) EventPublished(topic string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.published[topic]++
+}
+
+func (m *recordedMetrics) HandlerDone(topic string, async bool, duration time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if async {
+		topic += ":async"
+	}
+	m.handled[topic]++
+}
+
+func (m *recordedMetrics) AsyncQueueDepth(depth int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.depth = depth
+	m.maxDepth = max(m.maxDepth, depth)
+}
+
+func TestMetrics(t *testing.T) {
+	m := &recordedMetrics{published: make(map[string]int), handled: make(map[string]int)}
+	bus := New(WithMetrics(m, "orders:#"), WithWorkerPool(1, 10, OverflowBlock))
+	release := make(chan struct{})
+	_, _ = bus.Subscribe("orders:created", func(any) {})
+	_, _ = bus.SubscribeAsync("orders:paid", func(any) {
+		<-release
+	}, false)
+	_, _ = bus.Subscribe("1f3a", func(any) {})
+
+	_ = bus.Publish("orders:created", nil)
+	for i := 0; i < 3; i++ {
+		_ = bus.Publish("orders:paid", i)
+	}
+	_ = bus.Publish("1f3a", nil)
+	_ = bus.Publish("9bc0", nil)
+	close(release)
+	bus.WaitAsync()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.published["orders:created"] != 1 || m.published["orders:paid"] != 3 || m.published[OtherTopics] != 2 {
+		t.Errorf("got published %v", m.published)
+	}
+	if m.handled["orders:created"] != 1 || m.handled["orders:paid:async"] != 3 || m.handled[OtherTopics] != 1 {
+		t.Errorf("got handled %v", m.handled)
+	}
+	if m.depth != 0 || m.maxDepth < 1 {
+		t.Errorf("got queue depth %d, at most %d", m.depth, m.maxDepth)
+	}
+}
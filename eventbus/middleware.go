@@ -0,0 +1,166 @@
+package eventbus
+
+import "sort"
+
+// Next passes an event on to the rest of the middleware chain, and finally to the handlers of its
+// topic. It returns the error of the first middleware that rejected the event, if any.
+type Next func(data any) error
+
+// Middleware intercepts events before they reach their handlers. It may pass the event, or a
+// modified one, on with next; drop it by returning nil without calling next; or reject it by
+// returning an error, which Publish returns to the publisher.
+type Middleware func(topic string, data any, next Next) error
+
+// MiddlewareOption configures a middleware added with Use.
+type MiddlewareOption func(*middleware)
+
+// WithPriority orders a middleware in the chain: middleware with a higher priority runs first,
+// and middleware of equal priority runs in the order it was added. The default priority is 0.
+func WithPriority(priority int) MiddlewareOption {
+	return func(m *middleware) {
+		m.priority = priority
+	}
+}
+
+// WithTopics limits a middleware to the topics matching any of patterns, see SubscribePattern.
+// Events on other topics skip it.
+func WithTopics(patterns ...string) MiddlewareOption {
+	return func(m *middleware) {
+		m.patterns = patterns
+	}
+}
+
+// WithName names a middleware, for Middleware to list it by.
+func WithName(name string) MiddlewareOption {
+	return func(m *middleware) {
+		m.name = name
+	}
+}
+
+// MiddlewareInfo describes a middleware in the chain of a bus.
+type MiddlewareInfo struct {
+	Name     string   `json:"name,omitempty"`
+	Priority int      `json:"priority"`
+	Topics   []string `json:"topics,omitempty"` // empty if the middleware applies to every topic
+}
+
+type middleware struct {
+	fn       Middleware
+	name     string
+	priority int
+	patterns []string
+	scope    *patternNode // nil if the middleware applies to every topic
+}
+
+// Use adds fn to the middleware chain of the bus, and returns a function removing it again.
+// Returns error if a topic pattern is malformed.
+func (bus *EventBus) Use(fn Middleware, opts ...MiddlewareOption) (func(), error) {
+	m := &middleware{fn: fn}
+	for _, opt := range opts {
+		opt(m)
+	}
+	scope, err := newScope(m.patterns)
+	if err != nil {
+		return nil, err
+	}
+	m.scope = scope
+	bus.middlewareLock.Lock()
+	bus.addMiddleware(m)
+	bus.middlewareLock.Unlock()
+	return func() {
+		bus.middlewareLock.Lock()
+		bus.removeMiddleware(m)
+		bus.middlewareLock.Unlock()
+	}, nil
+}
+
+// AddMiddleware adds a middleware returning the data to pass on to the handlers, or nil to drop
+// the event, to every topic.
+//
+// Deprecated: use Use, whose middleware can reject events with an error.
+func (bus *EventBus) AddMiddleware(fn *func(string, any) any) {
+	if fn == nil {
+		return
+	}
+	m := &middleware{name: "legacy", fn: func(topic string, data any, next Next) error {
+		out := (*fn)(topic, data)
+		if out == nil && data != nil {
+			return nil
+		}
+		return next(out)
+	}}
+	bus.middlewareLock.Lock()
+	defer bus.middlewareLock.Unlock()
+	if _, ok := bus.legacyMiddleware[fn]; ok {
+		return
+	}
+	bus.legacyMiddleware[fn] = m
+	bus.addMiddleware(m)
+}
+
+// RemoveMiddleware removes a middleware added with AddMiddleware.
+//
+// Deprecated: use the function returned by Use.
+func (bus *EventBus) RemoveMiddleware(fn *func(string, any) any) {
+	bus.middlewareLock.Lock()
+	defer bus.middlewareLock.Unlock()
+	if m, ok := bus.legacyMiddleware[fn]; ok {
+		delete(bus.legacyMiddleware, fn)
+		bus.removeMiddleware(m)
+	}
+}
+
+// addMiddleware stores a copy of the chain with m inserted by priority, so that publishers can
+// keep running the chain they loaded. The caller holds bus.middlewareLock.
+func (bus *EventBus) addMiddleware(m *middleware) {
+	chain := append(bus.chain(), m)
+	sort.SliceStable(chain, func(i, j int) bool {
+		return chain[i].priority > chain[j].priority
+	})
+	bus.middleware.Store(&chain)
+}
+
+// removeMiddleware stores a copy of the chain without m. The caller holds bus.middlewareLock.
+func (bus *EventBus) removeMiddleware(m *middleware) {
+	chain := bus.chain()
+	for i, other := range chain {
+		if other == m {
+			chain = append(chain[:i], chain[i+1:]...)
+			break
+		}
+	}
+	bus.middleware.Store(&chain)
+}
+
+// chain returns a copy of the current middleware chain.
+func (bus *EventBus) chain() []*middleware {
+	if chain := bus.middleware.Load(); chain != nil {
+		return append([]*middleware(nil), *chain...)
+	}
+	return nil
+}
+
+// Middleware returns the middleware chain of the bus, in the order it runs. Middleware added with
+// the deprecated AddMiddleware is named "legacy".
+func (bus *EventBus) Middleware() []MiddlewareInfo {
+	chain := bus.chain()
+	infos := make([]MiddlewareInfo, len(chain))
+	for i, m := range chain {
+		infos[i] = MiddlewareInfo{Name: m.name, Priority: m.priority, Topics: m.patterns}
+	}
+	return infos
+}
+
+// runMiddleware runs the middleware of chain from index i on that applies to topic, and delivers
+// the event to the handlers of topic once the last one passed it on.
+func (bus *EventBus) runMiddleware(chain []*middleware, i int, topic string, segments []string, data any) error {
+	for ; i < len(chain); i++ {
+		if m := chain[i]; inScope(m.scope, segments) {
+			rest := i + 1
+			return m.fn(topic, data, func(data any) error {
+				return bus.runMiddleware(chain, rest, topic, segments, data)
+			})
+		}
+	}
+	return bus.deliver(topic, segments, data)
+}
@@ -0,0 +1,163 @@
+package eventbus
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	bus := New()
+	var order []string
+	use := func(name string, priority int) {
+		_, err := bus.Use(func(topic string, data any, next Next) error {
+			order = append(order, name)
+			return next(data.(string) + name)
+		}, WithPriority(priority))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	use("a", 0)
+	use("b", 10)
+	use("c", 0)
+	var received any
+	_, _ = bus.Subscribe("topic", func(data any) {
+		received = data
+	})
+
+	if err := bus.Publish("topic", ""); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(order, "") != "bac" || received != "bac" {
+		t.Errorf("middleware ran in order %v and delivered %v", order, received)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	bus := New()
+	errRejected := errors.New("rejected")
+	remove, _ := bus.Use(func(topic string, data any, next Next) error {
+		switch data {
+		case "drop":
+			return nil
+		case "reject":
+			return errRejected
+		}
+		return next(data)
+	})
+	var received []any
+	_, _ = bus.Subscribe("topic", func(data any) {
+		received = append(received, data)
+	})
+
+	if bus.Publish("topic", "drop") != nil || len(received) != 0 {
+		t.Error("dropped event was delivered")
+	}
+	if err := bus.Publish("topic", "reject"); !errors.Is(err, errRejected) || len(received) != 0 {
+		t.Errorf("rejected event returned %v", err)
+	}
+	remove()
+	if err := bus.Publish("topic", "reject"); err != nil || len(received) != 1 {
+		t.Errorf("removed middleware still ran: %v", err)
+	}
+}
+
+func TestMiddlewareTopics(t *testing.T) {
+	bus := New()
+	var topics []string
+	_, err := bus.Use(func(topic string, data any, next Next) error {
+		topics = append(topics, topic)
+		return next(data)
+	}, WithTopics("subsystem*:start", "method"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"subsystem1:start", "subsystem1:stop", "method", "other"} {
+		_ = bus.Publish(topic, nil)
+	}
+	if strings.Join(topics, ",") != "subsystem1:start,method" {
+		t.Errorf("middleware ran for %v", topics)
+	}
+
+	if _, err := bus.Use(func(string, any, Next) error { return nil }, WithTopics("#:start")); err == nil {
+		t.Error("malformed pattern was accepted")
+	}
+}
+
+func TestLegacyMiddleware(t *testing.T) {
+	bus := New()
+	upper := func(topic string, data any) any {
+		if s, ok := data.(string); ok {
+			return strings.ToUpper(s)
+		}
+		return data
+	}
+	drop := func(topic string, data any) any {
+		return nil
+	}
+	var received []any
+	_, _ = bus.Subscribe("topic", func(data any) {
+		received = append(received, data)
+	})
+
+	bus.AddMiddleware(&upper)
+	_ = bus.Publish("topic", "hello")
+	_ = bus.Publish("topic", nil)
+	bus.AddMiddleware(&drop)
+	_ = bus.Publish("topic", "dropped")
+	bus.RemoveMiddleware(&drop)
+	bus.RemoveMiddleware(&upper)
+	_ = bus.Publish("topic", "world")
+
+	if len(received) != 3 || received[0] != "HELLO" || received[1] != nil || received[2] != "world" {
+		t.Errorf("received %v", received)
+	}
+}
+
+func TestMiddlewareInfo(t *testing.T) {
+	bus := New()
+	pass := func(topic string, data any, next Next) error { return next(data) }
+	legacy := func(topic string, data any) any { return data }
+	_, _ = bus.Use(pass, WithName("audit"))
+	remove, _ := bus.Use(pass, WithName("quota"), WithPriority(10), WithTopics("method"))
+	bus.AddMiddleware(&legacy)
+
+	infos := bus.Middleware()
+	if len(infos) != 3 || infos[0].Name != "quota" || infos[0].Priority != 10 || strings.Join(infos[0].Topics, ",") != "method" ||
+		infos[1].Name != "audit" || infos[2].Name != "legacy" {
+		t.Errorf("got middleware %v", infos)
+	}
+	remove()
+	if infos := bus.Middleware(); len(infos) != 2 || infos[0].Name != "audit" {
+		t.Errorf("got middleware %v after removal", infos)
+	}
+}
+
+func TestMiddlewareConcurrentChanges(t *testing.T) {
+	bus := New()
+	_, _ = bus.Subscribe("topic", func(any) {})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				remove, _ := bus.Use(func(topic string, data any, next Next) error {
+					return next(data)
+				}, WithPriority(j))
+				remove()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := bus.Publish("topic", j); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,259 @@
+package eventbus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Wildcard segments of topic patterns, see SubscribePattern.
+const (
+	singleLevelWildcard = "+"
+	multiLevelWildcard  = "#"
+)
+
+// patternNode is a node of the trie indexing pattern subscriptions. Literal segments are looked
+// up by key, so matching a topic only visits the wildcard and glob branches in addition to the
+// path of the topic itself.
+type patternNode struct {
+	literal  map[string]*patternNode
+	globs    []*globNode
+	single   *patternNode
+	multi    []*eventHandler // handlers of patterns ending in "#" at this node
+	handlers []*eventHandler // handlers of patterns ending at this node
+}
+
+type globNode struct {
+	glob string
+	node *patternNode
+}
+
+func newPatternNode() *patternNode {
+	return &patternNode{literal: make(map[string]*patternNode)}
+}
+
+// splitTopic splits a topic or pattern into its segments.
+func splitTopic(topic string) []string {
+	return strings.FieldsFunc(topic, func(r rune) bool {
+		return r == ':' || r == '/'
+	})
+}
+
+// ValidatePattern returns an error if pattern is malformed, see SubscribePattern.
+func ValidatePattern(pattern string) error {
+	return validatePattern(pattern)
+}
+
+// TopicFilter matches topics against a set of patterns, see SubscribePattern.
+type TopicFilter struct {
+	scope *patternNode
+}
+
+// NewTopicFilter returns a filter matching the topics that match any of patterns. A filter
+// without patterns matches no topic. It returns an error if a pattern is malformed.
+func NewTopicFilter(patterns ...string) (*TopicFilter, error) {
+	scope, err := newScope(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return &TopicFilter{scope: scope}, nil
+}
+
+// Match reports whether topic matches any pattern of the filter.
+func (f *TopicFilter) Match(topic string) bool {
+	return f.scope != nil && inScope(f.scope, splitTopic(topic))
+}
+
+// validatePattern checks that the wildcards of pattern occupy whole segments, and that "#" only
+// appears last.
+func validatePattern(pattern string) error {
+	segments := splitTopic(pattern)
+	if len(segments) == 0 {
+		return fmt.Errorf("invalid pattern %q: no segments", pattern)
+	}
+	for i, segment := range segments {
+		switch {
+		case segment == multiLevelWildcard && i != len(segments)-1:
+			return fmt.Errorf("invalid pattern %q: %v must be the last segment", pattern, multiLevelWildcard)
+		case segment != multiLevelWildcard && strings.Contains(segment, multiLevelWildcard),
+			segment != singleLevelWildcard && strings.Contains(segment, singleLevelWildcard):
+			return fmt.Errorf("invalid pattern %q: wildcards must occupy a whole segment", pattern)
+		}
+	}
+	return nil
+}
+
+// insert adds handler for the pattern made of segments.
+func (n *patternNode) insert(segments []string, handler *eventHandler) {
+	if len(segments) == 0 {
+		n.handlers = append(n.handlers, handler)
+		return
+	}
+	segment := segments[0]
+	switch {
+	case segment == multiLevelWildcard:
+		n.multi = append(n.multi, handler)
+		return
+	case segment == singleLevelWildcard:
+		if n.single == nil {
+			n.single = newPatternNode()
+		}
+		n.single.insert(segments[1:], handler)
+	case strings.Contains(segment, "*"):
+		for _, g := range n.globs {
+			if g.glob == segment {
+				g.node.insert(segments[1:], handler)
+				return
+			}
+		}
+		g := &globNode{glob: segment, node: newPatternNode()}
+		n.globs = append(n.globs, g)
+		g.node.insert(segments[1:], handler)
+	default:
+		child, ok := n.literal[segment]
+		if !ok {
+			child = newPatternNode()
+			n.literal[segment] = child
+		}
+		child.insert(segments[1:], handler)
+	}
+}
+
+// remove removes the handlers of the pattern made of segments for which match returns true,
+// pruning branches left empty.
+func (n *patternNode) remove(segments []string, match func(*eventHandler) bool) {
+	if len(segments) == 0 {
+		n.handlers = removeHandlers(n.handlers, match)
+		return
+	}
+	segment := segments[0]
+	switch {
+	case segment == multiLevelWildcard:
+		n.multi = removeHandlers(n.multi, match)
+	case segment == singleLevelWildcard:
+		if n.single == nil {
+			return
+		}
+		n.single.remove(segments[1:], match)
+		if n.single.empty() {
+			n.single = nil
+		}
+	case strings.Contains(segment, "*"):
+		for i, g := range n.globs {
+			if g.glob != segment {
+				continue
+			}
+			g.node.remove(segments[1:], match)
+			if g.node.empty() {
+				n.globs = append(n.globs[:i], n.globs[i+1:]...)
+			}
+			return
+		}
+	default:
+		child, ok := n.literal[segment]
+		if !ok {
+			return
+		}
+		child.remove(segments[1:], match)
+		if child.empty() {
+			delete(n.literal, segment)
+		}
+	}
+}
+
+func (n *patternNode) empty() bool {
+	return len(n.literal) == 0 && len(n.globs) == 0 && n.single == nil && len(n.multi) == 0 && len(n.handlers) == 0
+}
+
+// match appends the handlers of every pattern matching the topic made of segments to handlers.
+func (n *patternNode) match(segments []string, handlers []*eventHandler) []*eventHandler {
+	handlers = append(handlers, n.multi...)
+	if len(segments) == 0 {
+		return append(handlers, n.handlers...)
+	}
+	segment, rest := segments[0], segments[1:]
+	if child, ok := n.literal[segment]; ok {
+		handlers = child.match(rest, handlers)
+	}
+	if n.single != nil {
+		handlers = n.single.match(rest, handlers)
+	}
+	for _, g := range n.globs {
+		if matchGlob(g.glob, segment) {
+			handlers = g.node.match(rest, handlers)
+		}
+	}
+	return handlers
+}
+
+// each calls fn for the handler of every pattern in the trie.
+func (n *patternNode) each(fn func(*eventHandler)) {
+	for _, handlers := range [][]*eventHandler{n.multi, n.handlers} {
+		for _, handler := range handlers {
+			fn(handler)
+		}
+	}
+	for _, child := range n.literal {
+		child.each(fn)
+	}
+	if n.single != nil {
+		n.single.each(fn)
+	}
+	for _, g := range n.globs {
+		g.node.each(fn)
+	}
+}
+
+func removeHandlers(handlers []*eventHandler, match func(*eventHandler) bool) []*eventHandler {
+	kept := handlers[:0]
+	for _, handler := range handlers {
+		if !match(handler) {
+			kept = append(kept, handler)
+		}
+	}
+	for i := len(kept); i < len(handlers); i++ {
+		handlers[i] = nil
+	}
+	return kept
+}
+
+// matchGlob reports whether s matches glob, in which '*' matches any run of characters.
+func matchGlob(glob string, s string) bool {
+	parts := strings.Split(glob, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 {
+			return strings.HasSuffix(s, part)
+		}
+		idx := strings.Index(s, part)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+	return s == ""
+}
+
+// newScope returns a trie matching the topics that match any of patterns, or nil if there are no
+// patterns.
+func newScope(patterns []string) (*patternNode, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	scope := newPatternNode()
+	for _, pattern := range patterns {
+		if err := validatePattern(pattern); err != nil {
+			return nil, err
+		}
+		// the trie only needs to tell whether any pattern matches, so a placeholder handler will do
+		scope.insert(splitTopic(pattern), &eventHandler{})
+	}
+	return scope, nil
+}
+
+// inScope reports whether the topic made of segments matches scope. A nil scope matches every topic.
+func inScope(scope *patternNode, segments []string) bool {
+	return scope == nil || len(scope.match(segments, nil)) > 0
+}
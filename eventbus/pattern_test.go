@@ -0,0 +1,112 @@
+package eventbus
+
+import (
+	"testing"
+)
+
+func TestSubscribePattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		topic   string
+		match   bool
+	}{
+		{"+:error", "subsystem1:error", true},
+		{"+:error", "subsystem1:start", false},
+		{"+:error", "a:b:error", false},
+		{"subsystem*:start", "subsystem2:start", true},
+		{"subsystem*:start", "other:start", false},
+		{"*system*:start", "subsystem2:start", true},
+		{"lifecycle/#", "lifecycle", true},
+		{"lifecycle/#", "lifecycle/subsystem1/stop", true},
+		{"lifecycle/#", "other/start", false},
+		{"#", "anything:at/all", true},
+		{"a/+", "a:b", true},
+		{"a:b", "a:b", true},
+		{"a:b", "a:b:c", false},
+	} {
+		bus := New()
+		var topics []string
+		if _, err := bus.SubscribePattern(tc.pattern, func(topic string, data any) {
+			topics = append(topics, topic)
+		}); err != nil {
+			t.Fatalf("%v: %v", tc.pattern, err)
+		}
+		bus.Publish(tc.topic, struct{}{})
+		if matched := len(topics) == 1 && topics[0] == tc.topic; matched != tc.match {
+			t.Errorf("pattern %v, topic %v: got %v, expected match %v", tc.pattern, tc.topic, topics, tc.match)
+		}
+	}
+}
+
+func TestSubscribePatternAlongsideTopics(t *testing.T) {
+	bus := New()
+	calls := 0
+	_, _ = bus.Subscribe("subsystem1:start", func(any) { calls++ })
+	_, _ = bus.SubscribePattern("+:start", func(string, any) { calls++ })
+	_, _ = bus.SubscribePattern("subsystem1:#", func(string, any) { calls++ })
+	bus.Publish("subsystem1:start", struct{}{})
+	if calls != 3 {
+		t.Fail()
+	}
+}
+
+func TestSubscribePatternAsync(t *testing.T) {
+	bus := New()
+	results := make(chan string, 2)
+	_, _ = bus.SubscribePatternAsync("+:stop", func(topic string, data any) {
+		results <- topic
+	}, true)
+	bus.Publish("a:stop", struct{}{})
+	bus.Publish("b:stop", struct{}{})
+	bus.WaitAsync()
+	if len(results) != 2 || <-results != "a:stop" || <-results != "b:stop" {
+		t.Fail()
+	}
+}
+
+func TestUnsubscribePattern(t *testing.T) {
+	bus := New()
+	calls := 0
+	sub, _ := bus.SubscribePattern("subsystem*:start", func(string, any) { calls++ })
+	sub.Unsubscribe()
+	bus.Publish("subsystem1:start", struct{}{})
+	if calls != 0 {
+		t.Fail()
+	}
+	if !bus.(*EventBus).patterns.empty() {
+		t.Error("pattern trie was not pruned")
+	}
+}
+
+func TestSubscribePatternInvalid(t *testing.T) {
+	bus := New()
+	for _, pattern := range []string{"", "a/#/b", "a+:b", "a/b#"} {
+		if _, err := bus.SubscribePattern(pattern, func(string, any) {}); err == nil {
+			t.Errorf("pattern %q was accepted", pattern)
+		}
+	}
+}
+
+func TestTopicFilter(t *testing.T) {
+	filter, err := NewTopicFilter("orders:*", "users/+/created")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for topic, want := range map[string]bool{
+		"orders:paid":       true,
+		"users:7:created":   true,
+		"users:7:deleted":   false,
+		"method:response:1": false,
+	} {
+		if got := filter.Match(topic); got != want {
+			t.Errorf("Match(%q) = %v", topic, got)
+		}
+	}
+	empty, _ := NewTopicFilter()
+	if empty.Match("orders:paid") {
+		t.Error("empty filter matched a topic")
+	}
+	if _, err := NewTopicFilter("a/#/b"); err == nil {
+		t.Error("malformed pattern was accepted")
+	}
+}
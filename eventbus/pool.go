@@ -0,0 +1,134 @@
+package eventbus
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned by Publish when the queue of a worker pool with the OverflowError
+// policy is full.
+var ErrQueueFull = errors.New("queue full")
+
+// OverflowPolicy decides what happens to an event published to an async handler whose worker pool
+// queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks Publish until the queue has room. Handlers that publish to their own bus
+	// may deadlock once all workers block on a full queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the event being published.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued event to make room.
+	OverflowDropOldest
+	// OverflowError discards the event being published and makes Publish return ErrQueueFull.
+	OverflowError
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop_newest"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Option configures an EventBus.
+type Option func(*EventBus)
+
+// WithWorkerPool runs the async handlers of the bus on at most workers goroutines, queueing up to
+// queueSize events for them and applying policy once the queue is full. Both workers and
+// queueSize are at least 1. Without a pool, every async handler invocation runs in a goroutine
+// of its own.
+func WithWorkerPool(workers int, queueSize int, policy OverflowPolicy) Option {
+	return func(bus *EventBus) {
+		bus.pool = newPool(workers, queueSize, policy)
+	}
+}
+
+// WithSubscriptionPool runs an async handler on a worker pool of its own instead of the pool of
+// the bus, see WithWorkerPool.
+func WithSubscriptionPool(workers int, queueSize int, policy OverflowPolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.pool = newPool(workers, queueSize, policy)
+	}
+}
+
+// job is an event queued on a pool. drop is called instead of run if the event is discarded.
+type job struct {
+	run  func()
+	drop func()
+}
+
+// pool runs jobs on a bounded number of goroutines. Workers are started as jobs arrive and exit
+// once the queue is empty, so an idle pool holds no goroutines.
+type pool struct {
+	workers int
+	size    int
+	policy  OverflowPolicy
+	lock    sync.Mutex
+	notFull *sync.Cond
+	queue   []job
+	running int
+}
+
+func newPool(workers int, size int, policy OverflowPolicy) *pool {
+	p := &pool{workers: max(workers, 1), size: max(size, 1), policy: policy}
+	p.notFull = sync.NewCond(&p.lock)
+	return p
+}
+
+// submit queues j, applying the overflow policy if the queue is full.
+func (p *pool) submit(j job) error {
+	p.lock.Lock()
+	for len(p.queue) >= p.size {
+		switch p.policy {
+		case OverflowDropNewest:
+			p.lock.Unlock()
+			j.drop()
+			return nil
+		case OverflowError:
+			p.lock.Unlock()
+			j.drop()
+			return ErrQueueFull
+		case OverflowDropOldest:
+			oldest := p.queue[0]
+			p.queue[0] = job{}
+			p.queue = p.queue[1:]
+			p.lock.Unlock()
+			oldest.drop()
+			p.lock.Lock()
+		default:
+			p.notFull.Wait()
+		}
+	}
+	p.queue = append(p.queue, j)
+	if p.running < p.workers {
+		p.running++
+		go p.work()
+	}
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *pool) work() {
+	p.lock.Lock()
+	for len(p.queue) > 0 {
+		j := p.queue[0]
+		p.queue[0] = job{}
+		p.queue = p.queue[1:]
+		p.notFull.Signal()
+		p.lock.Unlock()
+		j.run()
+		p.lock.Lock()
+	}
+	p.running--
+	p.lock.Unlock()
+}
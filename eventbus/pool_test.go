@@ -0,0 +1,100 @@
+package eventbus
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestWorkerPoolBoundsConcurrency(t *testing.T) {
+	bus := New(WithWorkerPool(2, 10, OverflowBlock))
+	var lock sync.Mutex
+	running, maxRunning, calls := 0, 0, 0
+	_, _ = bus.SubscribeAsync("topic", func(any) {
+		lock.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		lock.Unlock()
+
+		lock.Lock()
+		running--
+		calls++
+		lock.Unlock()
+	}, false)
+
+	for i := 0; i < 50; i++ {
+		if err := bus.Publish("topic", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bus.WaitAsync()
+
+	if calls != 50 || maxRunning > 2 {
+		t.Errorf("got %d calls with up to %d concurrent handlers", calls, maxRunning)
+	}
+}
+
+// publishBlocked publishes three events to a handler on a pool with a single worker and a queue of
+// one, while the handler is blocked on the first, and returns the events the handler received.
+func publishBlocked(t *testing.T, policy OverflowPolicy) ([]int, error) {
+	bus := New()
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	var lock sync.Mutex
+	var received []int
+	_, _ = bus.SubscribeAsync("topic", func(data any) {
+		started <- struct{}{}
+		<-release
+		lock.Lock()
+		received = append(received, data.(int))
+		lock.Unlock()
+	}, false, WithSubscriptionPool(1, 1, policy))
+
+	_ = bus.Publish("topic", 1)
+	<-started
+	_ = bus.Publish("topic", 2)
+	err := bus.Publish("topic", 3)
+	close(release)
+	bus.WaitAsync()
+	return received, err
+}
+
+func TestWorkerPoolOverflowPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy   OverflowPolicy
+		received []int
+		err      error
+	}{
+		{OverflowDropNewest, []int{1, 2}, nil},
+		{OverflowDropOldest, []int{1, 3}, nil},
+		{OverflowError, []int{1, 2}, ErrQueueFull},
+	} {
+		received, err := publishBlocked(t, tc.policy)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%v: got error %v, expected %v", tc.policy, err, tc.err)
+		}
+		if len(received) != len(tc.received) || received[0] != tc.received[0] || received[1] != tc.received[1] {
+			t.Errorf("%v: received %v, expected %v", tc.policy, received, tc.received)
+		}
+	}
+}
+
+func TestWorkerPoolTransactional(t *testing.T) {
+	bus := New(WithWorkerPool(4, 4, OverflowBlock))
+	var received []int
+	_, _ = bus.SubscribeAsync("topic", func(data any) {
+		received = append(received, data.(int))
+	}, true)
+	for i := 0; i < 20; i++ {
+		_ = bus.Publish("topic", i)
+	}
+	bus.WaitAsync()
+	for i, v := range received {
+		if i != v {
+			t.Fatalf("transactional handler received %v", received)
+		}
+	}
+	if len(received) != 20 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,679 @@
+package eventbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrBusClosed is returned by a RemoteBus whose connection is closed.
+var ErrBusClosed = errors.New("bus closed")
+
+// errSlowClient is returned for frames to a client whose queue of frames to write is full.
+var errSlowClient = errors.New("client does not keep up with its frames")
+
+const (
+	maxFrameSize    = 64 << 20
+	frameHeaderSize = 13       // length, kind and sequence number
+	maxQueuedBytes  = 16 << 20 // of the frames waiting to be written to a client
+
+	defaultWriteTimeout = 10 * time.Second
+)
+
+// frameKind identifies the frames exchanged between a Server and a RemoteBus.
+type frameKind byte
+
+const (
+	frameSubscribe          frameKind = iota + 1 // client: deliver the events on topic
+	frameUnsubscribe                             // client: stop delivering the events on topic
+	frameSubscribePattern                        // client: deliver the events on topics matching pattern
+	frameUnsubscribePattern                      // client: stop delivering the events matching pattern
+	framePublish                                 // client: publish an event
+	frameAck                                     // server: the result of a client frame, carrying an error if any
+	frameEvent                                   // server: an event on a topic the client subscribed to
+)
+
+// frame is the unit of the wire protocol: a big-endian uint32 length of the rest of the frame, the
+// kind byte, a big-endian uint64 sequence number, the topic prefixed with its uvarint length, and
+// the payload encoded by the codec.
+type frame struct {
+	kind    frameKind
+	seq     uint64
+	topic   string
+	payload []byte
+}
+
+// writeFrame writes an encoded frame to conn within timeout.
+func writeFrame(conn net.Conn, b []byte, timeout time.Duration) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	_, err := conn.Write(b)
+	return err
+}
+
+func encodeFrame(f frame) ([]byte, error) {
+	b := make([]byte, 4, 4+frameHeaderSize+binary.MaxVarintLen64+len(f.topic)+len(f.payload))
+	b = append(b, byte(f.kind))
+	b = binary.BigEndian.AppendUint64(b, f.seq)
+	b = binary.AppendUvarint(b, uint64(len(f.topic)))
+	b = append(b, f.topic...)
+	b = append(b, f.payload...)
+	if len(b)-4 > maxFrameSize {
+		return nil, fmt.Errorf("frame on %v is %d bytes, more than %d", f.topic, len(b)-4, maxFrameSize)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	return b, nil
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return frame{}, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n < frameHeaderSize-4+1 || n > maxFrameSize {
+		return frame{}, fmt.Errorf("invalid frame length %d", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return frame{}, err
+	}
+	f := frame{kind: frameKind(b[0]), seq: binary.BigEndian.Uint64(b[1:])}
+	topicLen, m := binary.Uvarint(b[9:])
+	if m <= 0 || topicLen > uint64(len(b)-9-m) {
+		return frame{}, errors.New("invalid frame topic")
+	}
+	rest := b[9+m:]
+	f.topic, f.payload = string(rest[:topicLen]), rest[topicLen:]
+	return f, nil
+}
+
+// encodeError encodes the error of an ack frame, falling back to its message if the codec cannot
+// encode the error itself.
+func encodeError(codec Codec, err error) []byte {
+	if err == nil {
+		return nil
+	}
+	if b, encErr := codec.Encode(err); encErr == nil {
+		return b
+	}
+	b, _ := codec.Encode(err.Error())
+	return b
+}
+
+func decodeError(codec Codec, b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	data, err := codec.Decode(b)
+	if err != nil {
+		return fmt.Errorf("could not decode error: %w", err)
+	}
+	switch data := data.(type) {
+	case error:
+		return data
+	case nil:
+		return nil
+	default:
+		return errors.New(fmt.Sprint(data))
+	}
+}
+
+// RemoteOption configures a Server or a RemoteBus.
+type RemoteOption func(*remoteOptions)
+
+type remoteOptions struct {
+	codec        Codec
+	writeTimeout time.Duration
+}
+
+// WithFrameCodec sets the codec encoding the data of events on the wire, GobCodec by default. Both
+// ends of a connection must use the same codec.
+func WithFrameCodec(codec Codec) RemoteOption {
+	return func(o *remoteOptions) {
+		o.codec = codec
+	}
+}
+
+// WithWriteTimeout sets how long writing a frame to a connection may take, 10 seconds by default.
+// A connection whose write times out is closed, so a Server disconnects clients that do not read
+// the events they subscribed to.
+func WithWriteTimeout(timeout time.Duration) RemoteOption {
+	return func(o *remoteOptions) {
+		o.writeTimeout = timeout
+	}
+}
+
+func newRemoteOptions(opts []RemoteOption) remoteOptions {
+	o := remoteOptions{codec: GobCodec{}, writeTimeout: defaultWriteTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Server shares a bus with the RemoteBus clients connected to it. Events published by a client are
+// published on the bus, and events published on the bus, by a client or in the process of the
+// server, are delivered to the clients subscribed to their topic. Events whose data the codec
+// cannot encode are not delivered to clients.
+//
+// Frames are queued for each client and written by a goroutine of its own, so publishers never
+// wait for a client. A client is disconnected once it has 16 MiB of frames queued, or a write
+// times out, see WithWriteTimeout.
+type Server struct {
+	bus          Bus
+	codec        Codec
+	writeTimeout time.Duration
+	sub          Subscription
+	lock         sync.Mutex // guards the fields below
+	conns        map[*serverConn]struct{}
+	ls           []net.Listener
+}
+
+// NewServer returns a server for bus.
+func NewServer(bus Bus, opts ...RemoteOption) (*Server, error) {
+	o := newRemoteOptions(opts)
+	s := &Server{bus: bus, codec: o.codec, writeTimeout: o.writeTimeout, conns: make(map[*serverConn]struct{})}
+	// transactional, so that clients receive the events in the order they were published
+	sub, err := bus.SubscribePatternAsync(multiLevelWildcard, s.forward, true)
+	if err != nil {
+		return nil, err
+	}
+	s.sub = sub
+	return s, nil
+}
+
+// Serve accepts clients on l until l or the server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.lock.Lock()
+	s.ls = append(s.ls, l)
+	s.lock.Unlock()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		conn := &serverConn{
+			server:   s,
+			conn:     c,
+			topics:   make(map[string]int),
+			patterns: make(map[string]int),
+			ready:    make(chan struct{}, 1),
+			done:     make(chan struct{}),
+		}
+		s.lock.Lock()
+		s.conns[conn] = struct{}{}
+		s.lock.Unlock()
+		go conn.serve()
+		go conn.write()
+	}
+}
+
+// Close stops forwarding events, and closes the listeners and the connections of the server.
+func (s *Server) Close() error {
+	s.sub.Unsubscribe()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var errs []error
+	for _, l := range s.ls {
+		errs = append(errs, l.Close())
+	}
+	for conn := range s.conns {
+		errs = append(errs, conn.conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// forward sends an event published on the bus to the clients subscribed to its topic.
+func (s *Server) forward(topic string, data any) {
+	segments := splitTopic(topic)
+	var payload []byte
+	s.lock.Lock()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.lock.Unlock()
+	for _, conn := range conns {
+		if !conn.subscribed(topic, segments) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = s.codec.Encode(data); err != nil {
+				return
+			}
+		}
+		// a client that cannot keep up is disconnected by send
+		_ = conn.send(frame{kind: frameEvent, topic: topic, payload: payload})
+	}
+}
+
+// serverConn is the connection of a client to a Server.
+type serverConn struct {
+	server   *Server
+	conn     net.Conn
+	lock     sync.Mutex // guards the fields below
+	topics   map[string]int
+	patterns map[string]int
+	scope    *patternNode // matches the patterns, nil if there are none
+
+	queueLock sync.Mutex // guards queue and queued
+	queue     [][]byte   // encoded frames waiting for write
+	queued    int        // bytes in queue and being written
+	ready     chan struct{}
+	done      chan struct{} // closed by close
+	closeOnce sync.Once
+}
+
+func (c *serverConn) serve() {
+	defer func() {
+		c.server.lock.Lock()
+		delete(c.server.conns, c)
+		c.server.lock.Unlock()
+		c.close()
+	}()
+	r := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		switch f.kind {
+		case frameSubscribe, frameUnsubscribe:
+			c.lock.Lock()
+			updateInterest(c.topics, f.topic, f.kind == frameSubscribe)
+			c.lock.Unlock()
+		case frameSubscribePattern, frameUnsubscribePattern:
+			c.lock.Lock()
+			updateInterest(c.patterns, f.topic, f.kind == frameSubscribePattern)
+			patterns := make([]string, 0, len(c.patterns))
+			for pattern := range c.patterns {
+				patterns = append(patterns, pattern)
+			}
+			// clients validate patterns before sending them
+			c.scope, _ = newScope(patterns)
+			c.lock.Unlock()
+		case framePublish:
+			var data any
+			if data, err = c.server.codec.Decode(f.payload); err == nil {
+				err = c.server.bus.Publish(f.topic, data)
+			}
+		default:
+			return
+		}
+		if err := c.send(frame{kind: frameAck, seq: f.seq, payload: encodeError(c.server.codec, err)}); err != nil {
+			return
+		}
+	}
+}
+
+func updateInterest(interest map[string]int, key string, add bool) {
+	if add {
+		interest[key]++
+		return
+	}
+	if interest[key]--; interest[key] <= 0 {
+		delete(interest, key)
+	}
+}
+
+func (c *serverConn) subscribed(topic string, segments []string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.topics[topic] > 0 || (c.scope != nil && inScope(c.scope, segments))
+}
+
+// send queues f for write without waiting for the client, and closes the connection if the
+// queue is full.
+func (c *serverConn) send(f frame) error {
+	b, err := encodeFrame(f)
+	if err != nil {
+		return err
+	}
+	c.queueLock.Lock()
+	if c.queued+len(b) > maxQueuedBytes {
+		c.queueLock.Unlock()
+		c.close()
+		return errSlowClient
+	}
+	c.queue = append(c.queue, b)
+	c.queued += len(b)
+	c.queueLock.Unlock()
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// write writes the queued frames to the client in order, until the connection is closed. The
+// connection is closed if a write fails, since part of the frame may have been written.
+func (c *serverConn) write() {
+	for {
+		c.queueLock.Lock()
+		frames := c.queue
+		c.queue = nil
+		c.queueLock.Unlock()
+		for _, b := range frames {
+			if err := writeFrame(c.conn, b, c.server.writeTimeout); err != nil {
+				c.close()
+				return
+			}
+			c.queueLock.Lock()
+			c.queued -= len(b)
+			c.queueLock.Unlock()
+		}
+		if len(frames) > 0 {
+			continue
+		}
+		select {
+		case <-c.ready:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *serverConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// RemoteBus is a Bus shared with other processes through a Server. Handlers subscribed to a
+// RemoteBus receive the events published on the bus of the server, including those published
+// through the RemoteBus itself, and middleware of a RemoteBus runs for the events it delivers
+// to its handlers. Publish returns once the server published the event, with the error of its bus.
+type RemoteBus struct {
+	local     *EventBus
+	codec     Codec
+	conn      net.Conn
+	timeout   time.Duration // of writes
+	writeLock sync.Mutex
+	// serializes the subscribe and unsubscribe frames, so that they reach the server in order
+	interestLock sync.Mutex
+	interest     map[string]int // subscriptions per topic, or per pattern prefixed with a NUL byte
+	lock         sync.Mutex     // guards the fields below
+	seq          uint64
+	pending      map[uint64]chan error
+	events       []Event // received but not delivered yet, see deliver
+	closed       bool
+	ready        chan struct{} // signals events to deliver
+	done         chan struct{}
+}
+
+// Dial connects to a Server listening on address, see net.Dial.
+func Dial(network string, address string, opts ...RemoteOption) (*RemoteBus, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteBus(conn, opts...), nil
+}
+
+// NewRemoteBus returns a RemoteBus talking to a Server over conn.
+func NewRemoteBus(conn net.Conn, opts ...RemoteOption) *RemoteBus {
+	o := newRemoteOptions(opts)
+	r := &RemoteBus{
+		local:    New().(*EventBus),
+		codec:    o.codec,
+		conn:     conn,
+		timeout:  o.writeTimeout,
+		pending:  make(map[uint64]chan error),
+		interest: make(map[string]int),
+		ready:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go r.read()
+	go r.deliver()
+	return r
+}
+
+// read reads the frames from the server. It never blocks on handlers, since they may publish and
+// wait for the ack read here: events are queued without bound for deliver.
+func (r *RemoteBus) read() {
+	defer r.Close()
+	br := bufio.NewReader(r.conn)
+	for {
+		f, err := readFrame(br)
+		if err != nil {
+			return
+		}
+		switch f.kind {
+		case frameAck:
+			r.lock.Lock()
+			ch, ok := r.pending[f.seq]
+			delete(r.pending, f.seq)
+			r.lock.Unlock()
+			if ok {
+				ch <- decodeError(r.codec, f.payload)
+			}
+		case frameEvent:
+			data, err := r.codec.Decode(f.payload)
+			if err != nil {
+				continue
+			}
+			r.lock.Lock()
+			r.events = append(r.events, Event{Topic: f.topic, Data: data})
+			r.lock.Unlock()
+			select {
+			case r.ready <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// deliver publishes the received events to the handlers of this process, in order, until the bus
+// is closed.
+func (r *RemoteBus) deliver() {
+	for {
+		r.lock.Lock()
+		events := r.events
+		r.events = nil
+		r.lock.Unlock()
+		for _, event := range events {
+			_ = r.local.Publish(event.Topic, event.Data)
+		}
+		if len(events) > 0 {
+			continue
+		}
+		select {
+		case <-r.ready:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Done is closed once the connection of the bus is closed.
+func (r *RemoteBus) Done() <-chan struct{} {
+	return r.done
+}
+
+// Close closes the connection of the bus. Pending and later calls to Publish return ErrBusClosed.
+func (r *RemoteBus) Close() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	for seq, ch := range r.pending {
+		delete(r.pending, seq)
+		ch <- ErrBusClosed
+	}
+	r.lock.Unlock()
+	close(r.done)
+	return r.conn.Close()
+}
+
+// send writes f to the server. The bus is closed if the write fails, since part of the frame may
+// have been written.
+func (r *RemoteBus) send(f frame) error {
+	b, err := encodeFrame(f)
+	if err != nil {
+		return err
+	}
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+	if err := writeFrame(r.conn, b, r.timeout); err != nil {
+		r.conn.Close()
+		return fmt.Errorf("%w: %v", ErrBusClosed, err)
+	}
+	return nil
+}
+
+// watch registers interest in the topic or pattern of sub with the server, until sub is done.
+func (r *RemoteBus) watch(sub Subscription, pattern bool, err error) (Subscription, error) {
+	if err != nil {
+		return nil, err
+	}
+	key, subscribe, unsubscribe := sub.Topic(), frameSubscribe, frameUnsubscribe
+	if pattern {
+		key, subscribe, unsubscribe = "\x00"+key, frameSubscribePattern, frameUnsubscribePattern
+	}
+	r.interestLock.Lock()
+	if r.interest[key]++; r.interest[key] == 1 {
+		err = r.request(frame{kind: subscribe, topic: sub.Topic()})
+	}
+	if err != nil {
+		r.interest[key]--
+	}
+	r.interestLock.Unlock()
+	if err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+	go func() {
+		<-sub.Done()
+		r.interestLock.Lock()
+		defer r.interestLock.Unlock()
+		if r.interest[key]--; r.interest[key] == 0 {
+			delete(r.interest, key)
+			_ = r.request(frame{kind: unsubscribe, topic: sub.Topic()})
+		}
+	}()
+	return sub, nil
+}
+
+// Subscribe subscribes to a topic.
+func (r *RemoteBus) Subscribe(topic string, fn func(any), opts ...SubscribeOption) (Subscription, error) {
+	sub, err := r.local.Subscribe(topic, fn, opts...)
+	return r.watch(sub, false, err)
+}
+
+// SubscribeAsync subscribes to a topic with an asynchronous callback, see EventBus.SubscribeAsync.
+func (r *RemoteBus) SubscribeAsync(topic string, fn func(any), transactional bool, opts ...SubscribeOption) (Subscription, error) {
+	sub, err := r.local.SubscribeAsync(topic, fn, transactional, opts...)
+	return r.watch(sub, false, err)
+}
+
+// SubscribeOnce subscribes to a topic once.
+func (r *RemoteBus) SubscribeOnce(topic string, fn func(any), opts ...SubscribeOption) (Subscription, error) {
+	sub, err := r.local.SubscribeOnce(topic, fn, opts...)
+	return r.watch(sub, false, err)
+}
+
+// SubscribeOnceAsync subscribes to a topic once with an asynchronous callback.
+func (r *RemoteBus) SubscribeOnceAsync(topic string, fn func(any), opts ...SubscribeOption) (Subscription, error) {
+	sub, err := r.local.SubscribeOnceAsync(topic, fn, opts...)
+	return r.watch(sub, false, err)
+}
+
+// SubscribePattern subscribes to every topic matching pattern, see EventBus.SubscribePattern.
+func (r *RemoteBus) SubscribePattern(pattern string, fn func(topic string, data any), opts ...SubscribeOption) (Subscription, error) {
+	sub, err := r.local.SubscribePattern(pattern, fn, opts...)
+	return r.watch(sub, true, err)
+}
+
+// SubscribePatternAsync subscribes to every topic matching pattern with an asynchronous callback.
+func (r *RemoteBus) SubscribePatternAsync(pattern string, fn func(topic string, data any), transactional bool, opts ...SubscribeOption) (Subscription, error) {
+	sub, err := r.local.SubscribePatternAsync(pattern, fn, transactional, opts...)
+	return r.watch(sub, true, err)
+}
+
+// Unsubscribe removes callback defined for a topic.
+//
+// Deprecated: use the Unsubscribe method of the Subscription returned by Subscribe instead.
+func (r *RemoteBus) Unsubscribe(topic string, handler func(any)) error {
+	return r.local.Unsubscribe(topic, handler)
+}
+
+// UnsubscribeAll removes every callback defined for a topic.
+func (r *RemoteBus) UnsubscribeAll(topic string) error {
+	return r.local.UnsubscribeAll(topic)
+}
+
+// Publish publishes an event on the bus of the server.
+func (r *RemoteBus) Publish(topic string, data any) error {
+	payload, err := r.codec.Encode(data)
+	if err != nil {
+		return fmt.Errorf("could not encode event on %v: %w", topic, err)
+	}
+	return r.request(frame{kind: framePublish, topic: topic, payload: payload})
+}
+
+// request sends f to the server, and waits for its ack.
+func (r *RemoteBus) request(f frame) error {
+	ack := make(chan error, 1)
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return ErrBusClosed
+	}
+	r.seq++
+	f.seq = r.seq
+	r.pending[f.seq] = ack
+	r.lock.Unlock()
+	if err := r.send(f); err != nil {
+		r.lock.Lock()
+		delete(r.pending, f.seq)
+		r.lock.Unlock()
+		return err
+	}
+	return <-ack
+}
+
+// Use adds middleware run for the events delivered to the handlers of this process.
+func (r *RemoteBus) Use(fn Middleware, opts ...MiddlewareOption) (func(), error) {
+	return r.local.Use(fn, opts...)
+}
+
+// Deprecated: use Use.
+func (r *RemoteBus) AddMiddleware(fn *func(string, any) any) {
+	r.local.AddMiddleware(fn)
+}
+
+// Deprecated: use the function returned by Use.
+func (r *RemoteBus) RemoveMiddleware(fn *func(string, any) any) {
+	r.local.RemoveMiddleware(fn)
+}
+
+// HasCallback returns true if any callback of this process is subscribed to the topic.
+func (r *RemoteBus) HasCallback(topic string) bool {
+	return r.local.HasCallback(topic)
+}
+
+// Topics returns the topics and patterns subscribed to in this process.
+func (r *RemoteBus) Topics() []TopicInfo {
+	return r.local.Topics()
+}
+
+// Middleware returns the middleware chain run in this process.
+func (r *RemoteBus) Middleware() []MiddlewareInfo {
+	return r.local.Middleware()
+}
+
+// WaitAsync waits for the async callbacks of this process to complete.
+func (r *RemoteBus) WaitAsync() {
+	r.local.WaitAsync()
+}
@@ -0,0 +1,241 @@
+package eventbus
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serve starts a server for bus on a Unix socket, and returns a client connected to it.
+func serve(t *testing.T, bus Bus) (*Server, *RemoteBus) {
+	server, err := NewServer(bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := filepath.Join(t.TempDir(), "bus.sock")
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	client, err := Dial("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return server, client
+}
+
+func receive(t *testing.T, ch <-chan any) any {
+	select {
+	case data := <-ch:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return nil
+	}
+}
+
+func TestRemoteBusPublishSubscribe(t *testing.T) {
+	bus := New()
+	_, client := serve(t, bus)
+	_, other := serve(t, bus)
+
+	fromClient := make(chan any, 2)
+	_, _ = bus.Subscribe("client:hello", func(data any) {
+		fromClient <- data
+	})
+	if err := client.Publish("client:hello", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if data := receive(t, fromClient); data != "hi" {
+		t.Errorf("server received %v", data)
+	}
+
+	fromServer := make(chan any, 2)
+	_, _ = client.Subscribe("server:hello", func(data any) {
+		fromServer <- data
+	})
+	patterns := make(chan any, 2)
+	_, _ = other.SubscribePattern("+:hello", func(topic string, data any) {
+		patterns <- topic
+	})
+	if err := bus.Publish("server:hello", 42); err != nil {
+		t.Fatal(err)
+	}
+	if data := receive(t, fromServer); data != 42 {
+		t.Errorf("client received %v", data)
+	}
+	if topic := receive(t, patterns); topic != "server:hello" {
+		t.Errorf("other client received %v", topic)
+	}
+
+	// events published by a client reach every subscriber, including its own
+	if err := client.Publish("server:hello", 43); err != nil {
+		t.Fatal(err)
+	}
+	if data := receive(t, fromServer); data != 43 {
+		t.Errorf("client received %v", data)
+	}
+	if topic := receive(t, patterns); topic != "server:hello" {
+		t.Errorf("other client received %v", topic)
+	}
+}
+
+func TestRemoteBusUnsubscribe(t *testing.T) {
+	bus := New()
+	server, client := serve(t, bus)
+	received := make(chan any, 1)
+	sub, _ := client.Subscribe("topic", func(data any) {
+		received <- data
+	})
+	sub.Unsubscribe()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		server.lock.Lock()
+		subscribed := false
+		for conn := range server.conns {
+			subscribed = subscribed || conn.subscribed("topic", []string{"topic"})
+		}
+		server.lock.Unlock()
+		if !subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server still delivers to the client")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_ = bus.Publish("topic", 1)
+	bus.WaitAsync()
+	client.WaitAsync()
+	if len(received) != 0 {
+		t.Error("unsubscribed handler received an event")
+	}
+}
+
+func TestRemoteBusPublishErrors(t *testing.T) {
+	bus := New()
+	errRejected := errors.New("rejected")
+	_, _ = bus.Use(func(topic string, data any, next Next) error {
+		if data == "reject" {
+			return errRejected
+		}
+		return next(data)
+	})
+	_, client := serve(t, bus)
+	err := client.Publish("topic", "reject")
+	if err == nil || err.Error() != errRejected.Error() {
+		t.Errorf("publish returned %v", err)
+	}
+	if err := client.Publish("topic", "accept"); err != nil {
+		t.Error(err)
+	}
+
+	client.Close()
+	<-client.Done()
+	if err := client.Publish("topic", "accept"); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("closed bus returned %v", err)
+	}
+}
+
+func TestServerDropsStalledClient(t *testing.T) {
+	bus := New()
+	// writes never time out during the test, so the stalled client is dropped for its full queue
+	server, err := NewServer(bus, WithWriteTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	address := filepath.Join(t.TempDir(), "bus.sock")
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+
+	// subscribe, then never read again
+	stalled, err := net.Dial("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	b, _ := encodeFrame(frame{kind: frameSubscribe, seq: 1, topic: "topic"})
+	if err := writeFrame(stalled, b, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readFrame(bufio.NewReader(stalled)); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := Dial("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	received := make(chan any, 1)
+	_, _ = client.Subscribe("topic", func(data any) {
+		received <- data
+	})
+
+	payload := make([]byte, 64<<10)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		start := time.Now()
+		_ = bus.Publish("topic", payload)
+		bus.WaitAsync()
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("publishing waited %v for the stalled client", elapsed)
+		}
+		// the other client keeps up
+		if data := receive(t, received); len(data.([]byte)) != len(payload) {
+			t.Fatalf("client received %d bytes", len(data.([]byte)))
+		}
+		server.lock.Lock()
+		conns := len(server.conns)
+		server.lock.Unlock()
+		if conns == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server still delivers to the stalled client")
+		}
+	}
+}
+
+func TestRemoteBusHandlerPublishes(t *testing.T) {
+	bus := New()
+	_, client := serve(t, bus)
+	const events = 5000
+	echoes := make(chan any, events)
+	_, _ = bus.Subscribe("echo", func(data any) {
+		echoes <- data
+	})
+	// the acks of the handler's events follow the events queued before them
+	published := make(chan any, events)
+	_, _ = client.Subscribe("topic", func(data any) {
+		published <- client.Publish("echo", data)
+	})
+	for i := 0; i < events; i++ {
+		if err := bus.Publish("topic", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < events; i++ {
+		if data := receive(t, echoes); data != i {
+			t.Fatalf("echo %d is %v", i, data)
+		}
+	}
+	// wait for the acks, so the client is not closed under the last Publish
+	for i := 0; i < events; i++ {
+		if err := receive(t, published); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
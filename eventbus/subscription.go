@@ -0,0 +1,91 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+)
+
+// Subscription is a handle on a subscription returned by the Subscribe functions of a Bus.
+type Subscription interface {
+	// Unsubscribe removes the subscription. It is safe to call more than once, but must not be
+	// called from a synchronous handler of the same bus.
+	Unsubscribe()
+	// Topic returns the topic, or the pattern, of the subscription.
+	Topic() string
+	// Done is closed once the subscription ended, because it was unsubscribed, its context was
+	// cancelled, or it was a once subscription that received its event.
+	Done() <-chan struct{}
+}
+
+// SubscribeOption configures a subscription.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	ctx  context.Context
+	pool *pool
+}
+
+// WithContext binds a subscription to ctx: it is unsubscribed once ctx is done.
+func WithContext(ctx context.Context) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.ctx = ctx
+	}
+}
+
+// subscription implements Subscription for a handler of an EventBus.
+type subscription struct {
+	bus     *EventBus
+	topic   string
+	pattern bool
+	handler *eventHandler
+	done    chan struct{}
+	once    sync.Once
+	lock    sync.Mutex  // guards stop
+	stop    func() bool // stops watching the context of the subscription, if any
+}
+
+// bind unsubscribes the subscription once ctx is done.
+func (s *subscription) bind(ctx context.Context) {
+	stop := context.AfterFunc(ctx, s.Unsubscribe)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stop = stop
+}
+
+func (s *subscription) Topic() string {
+	return s.topic
+}
+
+func (s *subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *subscription) Unsubscribe() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	s.bus.lock.Lock()
+	if s.pattern {
+		s.bus.patterns.remove(splitTopic(s.topic), func(h *eventHandler) bool {
+			return h == s.handler
+		})
+	} else {
+		s.bus.removeHandler(s.topic, s.handler)
+	}
+	s.bus.lock.Unlock()
+	s.finish()
+}
+
+// finish marks the subscription as ended once its handler is no longer registered.
+func (s *subscription) finish() {
+	s.once.Do(func() {
+		s.lock.Lock()
+		if s.stop != nil {
+			s.stop()
+		}
+		s.lock.Unlock()
+		close(s.done)
+	})
+}
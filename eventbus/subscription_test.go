@@ -0,0 +1,82 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionUnsubscribe(t *testing.T) {
+	bus := New()
+	calls := 0
+	fn := func(any) { calls++ }
+	first, _ := bus.Subscribe("topic", fn)
+	second, _ := bus.Subscribe("topic", fn)
+	if first.Topic() != "topic" {
+		t.Fail()
+	}
+
+	first.Unsubscribe()
+	first.Unsubscribe()
+	bus.Publish("topic", struct{}{})
+	if calls != 1 {
+		t.Errorf("expected the second subscription only, got %d calls", calls)
+	}
+	select {
+	case <-first.Done():
+	default:
+		t.Error("Done was not closed")
+	}
+	select {
+	case <-second.Done():
+		t.Error("Done was closed for the remaining subscription")
+	default:
+	}
+
+	second.Unsubscribe()
+	if bus.HasCallback("topic") {
+		t.Fail()
+	}
+}
+
+func TestSubscriptionWithContext(t *testing.T) {
+	bus := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, _ := bus.SubscribeAsync("topic", func(any) {}, false, WithContext(ctx))
+	cancel()
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not cancelled with its context")
+	}
+	if bus.HasCallback("topic") {
+		t.Fail()
+	}
+}
+
+func TestSubscriptionOnceDone(t *testing.T) {
+	bus := New()
+	sub, _ := bus.SubscribeOnce("topic", func(any) {})
+	bus.Publish("topic", struct{}{})
+	select {
+	case <-sub.Done():
+	default:
+		t.Error("Done was not closed after the event")
+	}
+}
+
+func TestUnsubscribeAllClosesSubscriptions(t *testing.T) {
+	bus := New()
+	first, _ := bus.Subscribe("topic", func(any) {})
+	second, _ := bus.Subscribe("topic", func(any) {})
+	if bus.UnsubscribeAll("topic") != nil {
+		t.Fail()
+	}
+	for _, sub := range []Subscription{first, second} {
+		select {
+		case <-sub.Done():
+		default:
+			t.Error("Done was not closed")
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"overseer/eventbus"
+	"sync"
+)
+
+// FactoryEnv is what factories build subsystems and middleware with.
+type FactoryEnv struct {
+	Context  context.Context // passed to Factories.Build
+	Bus      eventbus.Bus
+	Overseer *Overseer          // the subsystems are registered once every factory returned
+	Metrics  *PrometheusMetrics // nil unless the config enables bus.metrics
+}
+
+// SubsystemFactory builds the subsystem declared in a Config under the given name. Subsystems whose
+// name is fixed by their implementation reject other names when they are built.
+type SubsystemFactory func(env FactoryEnv, name string, settings Settings) (*BaseSubsystem, error)
+
+// RequestMiddleware is request middleware, see Overseer.UseRequestMiddleware.
+type RequestMiddleware func(methodRequest MethodRequest, next func(MethodRequest) error) error
+
+// MiddlewareFactory builds the request middleware declared in a Config.
+type MiddlewareFactory func(env FactoryEnv, settings Settings) (RequestMiddleware, error)
+
+// Factories is a registry of the factories building the subsystems and middleware of a Config,
+// by their type name.
+type Factories struct {
+	lock       sync.RWMutex // guards subsystems and middleware
+	subsystems map[string]SubsystemFactory
+	middleware map[string]MiddlewareFactory
+}
+
+// NewFactories returns a registry of the subsystem types of this package:
+//
+//	subsystem1, subsystem2  without settings
+//	gateway                 addr, and optionally allowed_origins and topics, see NewGateway,
+//	                        WithAllowedOrigins and WithTopics
+//	admin                   addr, see NewAdmin
+//	metrics                 addr, see NewMetricsServer; requires bus.metrics
+//	process                 command, the program and its arguments, and optionally dir and env,
+//	                        see NewProcessSubsystem
+func NewFactories() *Factories {
+	f := &Factories{
+		subsystems: make(map[string]SubsystemFactory),
+		middleware: make(map[string]MiddlewareFactory),
+	}
+	f.MustRegisterSubsystem("subsystem1", func(env FactoryEnv, name string, settings Settings) (*BaseSubsystem, error) {
+		return NewSubsystem1(env.Context, env.Bus), settings.Decode(&struct{}{})
+	})
+	f.MustRegisterSubsystem("subsystem2", func(env FactoryEnv, name string, settings Settings) (*BaseSubsystem, error) {
+		return NewSubsystem2(env.Context, env.Bus), settings.Decode(&struct{}{})
+	})
+	f.MustRegisterSubsystem("gateway", newGatewayFromSettings)
+	f.MustRegisterSubsystem("admin", func(env FactoryEnv, name string, settings Settings) (*BaseSubsystem, error) {
+		addr, err := decodeAddr(settings)
+		return NewBaseSubsystem(NewAdmin(env.Overseer, addr)), err
+	})
+	f.MustRegisterSubsystem("metrics", func(env FactoryEnv, name string, settings Settings) (*BaseSubsystem, error) {
+		addr, err := decodeAddr(settings)
+		if err == nil && env.Metrics == nil {
+			err = errors.New("metrics are not enabled, see bus.metrics")
+		}
+		return NewBaseSubsystem(NewMetricsServer(env.Metrics, addr)), err
+	})
+	f.MustRegisterSubsystem("process", newProcessFromSettings)
+	return f
+}
+
+func decodeAddr(settings Settings) (string, error) {
+	var s struct {
+		Addr string `yaml:"addr"`
+	}
+	if err := settings.Decode(&s); err != nil {
+		return "", err
+	}
+	if s.Addr == "" {
+		return "", errors.New(`missing setting "addr"`)
+	}
+	return s.Addr, nil
+}
+
+func newGatewayFromSettings(env FactoryEnv, name string, settings Settings) (*BaseSubsystem, error) {
+	var s struct {
+		Addr           string   `yaml:"addr"`
+		AllowedOrigins []string `yaml:"allowed_origins"`
+		Topics         []string `yaml:"topics"`
+	}
+	if err := settings.Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Addr == "" {
+		return nil, errors.New(`missing setting "addr"`)
+	}
+	for _, topic := range s.Topics {
+		if err := eventbus.ValidatePattern(topic); err != nil {
+			return nil, fmt.Errorf("topics: %w", err)
+		}
+	}
+	return NewBaseSubsystem(NewGateway(env.Overseer, s.Addr, WithAllowedOrigins(s.AllowedOrigins...), WithTopics(s.Topics...))), nil
+}
+
+func newProcessFromSettings(env FactoryEnv, name string, settings Settings) (*BaseSubsystem, error) {
+	var s struct {
+		Command []string `yaml:"command"`
+		Dir     string   `yaml:"dir"`
+		Env     []string `yaml:"env"` // KEY=value, added to the environment of the overseer
+	}
+	if err := settings.Decode(&s); err != nil {
+		return nil, err
+	}
+	if len(s.Command) == 0 {
+		return nil, errors.New(`missing setting "command"`)
+	}
+	return NewBaseSubsystem(NewProcessSubsystem(name, func() *exec.Cmd {
+		cmd := exec.Command(s.Command[0], s.Command[1:]...)
+		cmd.Dir = s.Dir
+		cmd.Env = append(os.Environ(), s.Env...)
+		return cmd
+	})), nil
+}
+
+// RegisterSubsystem registers the factory of a subsystem type. It returns an error if the type is
+// already registered.
+func (f *Factories) RegisterSubsystem(typeName string, factory SubsystemFactory) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.subsystems[typeName]; ok {
+		return fmt.Errorf("subsystem type %v is already registered", typeName)
+	}
+	f.subsystems[typeName] = factory
+	return nil
+}
+
+// MustRegisterSubsystem is like RegisterSubsystem but panics if the type cannot be registered.
+func (f *Factories) MustRegisterSubsystem(typeName string, factory SubsystemFactory) {
+	if err := f.RegisterSubsystem(typeName, factory); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterMiddleware registers the factory of a middleware type. It returns an error if the type
+// is already registered.
+func (f *Factories) RegisterMiddleware(typeName string, factory MiddlewareFactory) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.middleware[typeName]; ok {
+		return fmt.Errorf("middleware type %v is already registered", typeName)
+	}
+	f.middleware[typeName] = factory
+	return nil
+}
+
+// MustRegisterMiddleware is like RegisterMiddleware but panics if the type cannot be registered.
+func (f *Factories) MustRegisterMiddleware(typeName string, factory MiddlewareFactory) {
+	if err := f.RegisterMiddleware(typeName, factory); err != nil {
+		panic(err)
+	}
+}
+
+func (f *Factories) subsystemFactory(typeName string) (SubsystemFactory, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	factory, ok := f.subsystems[typeName]
+	return factory, ok
+}
+
+func (f *Factories) middlewareFactory(typeName string) (MiddlewareFactory, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	factory, ok := f.middleware[typeName]
+	return factory, ok
+}
+
+// Build validates config and builds the overseer it declares, with its subsystems registered but
+// not started. If the config is invalid, the error wraps ErrInvalidConfig and lists every problem
+// found, each prefixed with where it is in the config, such as "subsystems[1].depends_on".
+func (f *Factories) Build(ctx context.Context, config *Config) (*Overseer, error) {
+	if errs := config.validate(f); len(errs) > 0 {
+		return nil, invalidConfig(errs)
+	}
+
+	var busOpts []eventbus.Option
+	if pool := config.Bus.WorkerPool; pool != nil {
+		policy, _ := parseOverflowPolicy(pool.Overflow)
+		busOpts = append(busOpts, eventbus.WithWorkerPool(pool.Workers, pool.QueueSize, policy))
+	}
+	env := FactoryEnv{Context: ctx}
+	if config.Bus.Metrics != nil {
+		env.Metrics = NewPrometheusMetrics()
+		busOpts = append(busOpts, eventbus.WithMetrics(env.Metrics, config.Bus.Metrics.Topics...))
+	}
+	env.Bus = eventbus.New(busOpts...)
+	env.Overseer = NewOverseer(env.Bus)
+	if env.Metrics != nil {
+		env.Overseer.SetMetrics(env.Metrics)
+	}
+	if config.Supervisor != nil {
+		spec, _ := config.Supervisor.spec()
+		env.Overseer.Supervise(spec)
+	}
+	cyclePolicy, _ := parseCyclePolicy(config.CyclePolicy)
+	env.Overseer.SetCyclePolicy(cyclePolicy)
+	if config.AccessPolicy != nil {
+		if err := env.Overseer.SetAccessPolicy(config.AccessPolicy); err != nil {
+			return nil, invalidConfig([]error{fmt.Errorf("access_policy: %w", err)})
+		}
+	}
+
+	var errs []error
+	subsystems := make([]*BaseSubsystem, len(config.Subsystems))
+	for i, sc := range config.Subsystems {
+		factory, _ := f.subsystemFactory(sc.Type)
+		bs, err := factory(env, sc.name(), sc.Settings)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("subsystems[%d] (%v).settings: %w", i, sc.name(), err))
+		case bs.Name() != sc.name():
+			errs = append(errs, fmt.Errorf("subsystems[%d].name: subsystems of type %v are named %q, not %q", i, sc.Type, bs.Name(), sc.name()))
+		case sc.Mailbox != nil:
+			WithMailbox(sc.Mailbox.Capacity, sc.Mailbox.Workers)(bs)
+		}
+		subsystems[i] = bs
+	}
+	middleware := make([]RequestMiddleware, len(config.Middleware))
+	for i, mc := range config.Middleware {
+		factory, _ := f.middlewareFactory(mc.Type)
+		m, err := factory(env, mc.Settings)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("middleware[%d] (%v).settings: %w", i, mc.name(), err))
+		}
+		middleware[i] = m
+	}
+	if len(errs) > 0 {
+		return nil, invalidConfig(errs)
+	}
+
+	for i, mc := range config.Middleware {
+		if _, err := env.Overseer.UseRequestMiddleware(middleware[i], eventbus.WithName(mc.name()), eventbus.WithPriority(mc.Priority)); err != nil {
+			errs = append(errs, fmt.Errorf("middleware[%d] (%v): %w", i, mc.name(), err))
+		}
+	}
+	for i, bs := range subsystems {
+		if err := env.Overseer.RegisterSubsystem(bs); err != nil {
+			errs = append(errs, fmt.Errorf("subsystems[%d] (%v): %w", i, bs.Name(), err))
+		}
+	}
+	for i, sc := range config.Subsystems {
+		if len(sc.DependsOn) == 0 {
+			continue
+		}
+		if err := env.Overseer.AddDependency(sc.name(), sc.DependsOn...); err != nil {
+			errs = append(errs, fmt.Errorf("subsystems[%d].depends_on: %w", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, invalidConfig(errs)
+	}
+	return env.Overseer, nil
+}
+
+func invalidConfig(errs []error) error {
+	return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"overseer/eventbus"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// GatewayName is the name of the gateway subsystem, and the caller of the requests it makes.
+const GatewayName = "gateway"
+
+// maxRPCBody bounds the size of a JSON-RPC request read over HTTP.
+const maxRPCBody = 1 << 20
+
+// Bounds of a WebSocket connection to the gateway: the messages waiting to be written to the
+// client, and the requests it may have in flight before the gateway stops reading from it.
+const (
+	wsQueueSize       = 256
+	maxSocketRequests = 64
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// Methods of the gateway itself, only available over WebSocket.
+const (
+	rpcSubscribe   = "bus_subscribe"
+	rpcUnsubscribe = "bus_unsubscribe"
+	rpcEvent       = "bus_event"
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // nil for notifications
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// rpcNotification is sent to WebSocket clients for the events on the topics they subscribed to.
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type rpcEventParams struct {
+	Subscription string `json:"subscription"`
+	Topic        string `json:"topic"`
+	Data         any    `json:"data"`
+}
+
+// Gateway is a subsystem serving the registered methods of every subsystem as JSON-RPC 2.0, over
+// HTTP POST requests and WebSocket connections. A method named ping on subsystem1 is called as
+// subsystem1_ping, with its arguments as positional params or, if it was registered with argument
+// names, as named params. The ID of a JSON-RPC request becomes part of the ID of its MethodRequest.
+// WebSocket clients may also subscribe to topics and patterns of the event bus with bus_subscribe,
+// receiving bus_event notifications until they call bus_unsubscribe. They only receive the events
+// on topics opened to them with WithTopics, so that they cannot read the requests and responses of
+// other callers. Messages to a client are queued and written by a goroutine of its own; a client
+// that does not read them is disconnected once its queue is full.
+//
+// Browsers may only call the gateway from pages of its own origin, or of the origins allowed with
+// WithAllowedOrigins, and POST requests must have the Content-Type application/json. Every request
+// is made with GatewayName as its Caller, so an AccessPolicy cannot tell the clients of the gateway
+// apart: it should allow the gateway only the methods every client may call.
+type Gateway struct {
+	bs       *BaseSubsystem
+	overseer *Overseer
+	http     httpServer
+	origins  map[string]bool // allowed besides the origin of the gateway, see WithAllowedOrigins
+	patterns []string        // of the topics open to WebSocket clients, see WithTopics
+	topics   *eventbus.TopicFilter
+	err      error         // of building topics, returned by OnStart
+	nextID   atomic.Uint64 // numbers requests, so that their IDs are unique on the bus
+
+	lock    sync.Mutex // guards sockets
+	sockets map[*wsConn]struct{}
+}
+
+// GatewayOption configures a Gateway.
+type GatewayOption func(*Gateway)
+
+// WithAllowedOrigins allows browsers to call the gateway from pages of the given origins, such as
+// "https://example.com", besides the origin of the gateway itself. The origin "*" allows any.
+func WithAllowedOrigins(origins ...string) GatewayOption {
+	return func(g *Gateway) {
+		for _, origin := range origins {
+			g.origins[origin] = true
+		}
+	}
+}
+
+// WithTopics opens the topics matching any of patterns, see eventbus.SubscribePattern, to the
+// WebSocket clients of the gateway. Without it, bus_subscribe fails. The gateway fails to start if
+// a pattern is malformed.
+func WithTopics(patterns ...string) GatewayOption {
+	return func(g *Gateway) {
+		g.patterns = append(g.patterns, patterns...)
+	}
+}
+
+// NewGateway returns a gateway to the subsystems of overseer, listening on addr once started. The
+// gateway is also an http.Handler, for serving it from a server of one's own.
+func NewGateway(overseer *Overseer, addr string, opts ...GatewayOption) *Gateway {
+	g := &Gateway{overseer: overseer, http: httpServer{addr: addr}, origins: make(map[string]bool), sockets: make(map[*wsConn]struct{})}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.topics, g.err = eventbus.NewTopicFilter(g.patterns...)
+	return g
+}
+
+func (g *Gateway) Name() string {
+	return GatewayName
+}
+
+func (g *Gateway) SetBaseSubsystem(bs *BaseSubsystem) {
+	g.bs = bs
+}
+
+// OnStart starts listening.
+func (g *Gateway) OnStart() error {
+	if g.err != nil {
+		return fmt.Errorf("invalid topics for gateway clients: %w", g.err)
+	}
+	return g.http.start(g.bs, g)
+}
+
+// OnStop closes the listener and every connection.
+func (g *Gateway) OnStop() error {
+	g.lock.Lock()
+	sockets := g.sockets
+	g.sockets = make(map[*wsConn]struct{})
+	g.lock.Unlock()
+	for socket := range sockets {
+		socket.Close()
+	}
+	return g.http.stop()
+}
+
+// Call serves no methods: the gateway is only reachable over the network.
+func (g *Gateway) Call(ctx context.Context, method string, args ...any) (any, error) {
+	return nil, ErrMethodNotFound
+}
+
+// Addr returns the address the gateway listens on, or nil if it is not running.
+func (g *Gateway) Addr() net.Addr {
+	return g.http.Addr()
+}
+
+// ServeHTTP serves JSON-RPC requests POSTed to any path, and WebSocket upgrades.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !g.allowOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if isWebSocketUpgrade(r) {
+		g.serveWebSocket(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	// browsers send other content types cross-site without asking the server first
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "JSON-RPC requests must have the Content-Type application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRPCBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	reply := g.handleMessage(r.Context(), body, nil)
+	if reply == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(reply)
+}
+
+// allowOrigin reports whether a request may be served: requests without an Origin header do not
+// come from a browser page, and others must come from the origin of the gateway or an allowed one.
+func (g *Gateway) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || g.origins["*"] || g.origins[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// handleMessage answers a JSON-RPC request or batch, and returns nil if there is nothing to
+// answer. socket is the connection the message arrived on, nil for HTTP requests.
+func (g *Gateway) handleMessage(ctx context.Context, message []byte, socket *gatewaySocket) []byte {
+	message = bytes.TrimSpace(message)
+	if len(message) > 0 && message[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(message, &batch); err != nil {
+			return mustMarshal(errorResponse(nil, rpcParseError, "parse error", err))
+		}
+		if len(batch) == 0 {
+			return mustMarshal(errorResponse(nil, rpcInvalidRequest, "empty batch", nil))
+		}
+		responses := make([]*rpcResponse, len(batch))
+		var wg sync.WaitGroup
+		for i, request := range batch {
+			wg.Add(1)
+			go func(i int, request json.RawMessage) {
+				defer wg.Done()
+				responses[i] = g.handleRequest(ctx, request, socket)
+			}(i, request)
+		}
+		wg.Wait()
+		answered := make([]*rpcResponse, 0, len(responses))
+		for _, resp := range responses {
+			if resp != nil {
+				answered = append(answered, resp)
+			}
+		}
+		if len(answered) == 0 {
+			return nil
+		}
+		return mustMarshal(answered)
+	}
+	if resp := g.handleRequest(ctx, message, socket); resp != nil {
+		return mustMarshal(resp)
+	}
+	return nil
+}
+
+// handleRequest answers a single JSON-RPC request, and returns nil for notifications.
+func (g *Gateway) handleRequest(ctx context.Context, message json.RawMessage, socket *gatewaySocket) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(message, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return errorResponse(nil, rpcParseError, "parse error", err)
+		}
+		return errorResponse(nil, rpcInvalidRequest, "invalid request", err)
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, rpcInvalidRequest, "invalid request", nil)
+	}
+	result, rpcErr := g.call(ctx, req, socket)
+	if req.ID == nil {
+		return nil
+	}
+	if rpcErr != nil {
+		return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, rpcServerError, "could not encode result", err)
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: b}
+}
+
+// call serves a JSON-RPC request with a subsystem method or a method of the gateway.
+func (g *Gateway) call(ctx context.Context, req rpcRequest, socket *gatewaySocket) (any, *rpcError) {
+	switch req.Method {
+	case rpcSubscribe, rpcUnsubscribe:
+		if socket == nil {
+			return nil, &rpcError{Code: rpcMethodNotFound, Message: req.Method + " is only available over WebSocket"}
+		}
+		var params []string
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: req.Method + " takes a single string"}
+		}
+		if req.Method == rpcSubscribe {
+			return socket.subscribe(params[0])
+		}
+		return socket.unsubscribe(params[0]), nil
+	}
+
+	subsystem, info, ok := g.resolve(req.Method)
+	if !ok {
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	args, err := rpcArgs(info, req.Params)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	id := strconv.FormatUint(g.nextID.Add(1), 10)
+	if req.ID != nil {
+		id += ":" + string(req.ID)
+	}
+	resp := SubsystemRequest(ctx, g.overseer.eventBus, MethodRequest{
+		Caller:    GatewayName,
+		Subsystem: subsystem,
+		Method:    info.Name,
+		ID:        GatewayName + ":" + id,
+		Data:      args,
+	})
+	if resp.Error != nil {
+		return nil, rpcErrorFor(resp.Error, subsystem, info.Name)
+	}
+	return resp.Data, nil
+}
+
+// resolve finds the registered method a JSON-RPC method name refers to.
+func (g *Gateway) resolve(name string) (string, MethodInfo, bool) {
+	for _, description := range g.overseer.Describe() {
+		for _, info := range description.Methods {
+			if description.Name+"_"+info.Name == name {
+				return description.Name, info, true
+			}
+		}
+	}
+	return "", MethodInfo{}, false
+}
+
+// rpcArgs decodes the params of a JSON-RPC request into the arguments of a method.
+func rpcArgs(info MethodInfo, params json.RawMessage) ([]any, error) {
+	var raw []json.RawMessage
+	params = bytes.TrimSpace(params)
+	switch {
+	case len(params) == 0 || string(params) == "null":
+	case params[0] == '[':
+		if err := json.Unmarshal(params, &raw); err != nil {
+			return nil, err
+		}
+	case params[0] == '{':
+		if len(info.ArgNames) != len(info.Args) {
+			return nil, fmt.Errorf("%v takes positional params only", info.Name)
+		}
+		var named map[string]json.RawMessage
+		if err := json.Unmarshal(params, &named); err != nil {
+			return nil, err
+		}
+		for _, name := range info.ArgNames {
+			param, ok := named[name]
+			if !ok {
+				return nil, fmt.Errorf("missing param %v", name)
+			}
+			raw = append(raw, param)
+			delete(named, name)
+		}
+		for name := range named {
+			return nil, fmt.Errorf("unknown param %v", name)
+		}
+	default:
+		return nil, errors.New("params must be an array or an object")
+	}
+	if len(raw) != len(info.Args) {
+		return nil, fmt.Errorf("%v expects %d params, got %d", info.Name, len(info.Args), len(raw))
+	}
+	args := make([]any, len(raw))
+	for i, t := range info.Args {
+		v := reflect.New(t)
+		if err := json.Unmarshal(raw[i], v.Interface()); err != nil {
+			return nil, fmt.Errorf("param %d of %v: %w", i, info.Name, err)
+		}
+		args[i] = v.Elem().Interface()
+	}
+	return args, nil
+}
+
+// rpcErrorFor maps the error of a method call onto a JSON-RPC error, carrying the MethodError.
+func rpcErrorFor(err error, subsystem string, method string) *rpcError {
+	methodErr := AsMethodError(err, subsystem, method, "")
+	code := rpcServerError
+	switch methodErr.Code {
+	case CodeSubsystemNotFound, CodeMethodNotFound:
+		code = rpcMethodNotFound
+	case CodeInvalidArgs, CodeTypeMismatch:
+		code = rpcInvalidParams
+	}
+	return &rpcError{Code: code, Message: methodErr.Error(), Data: methodErr}
+}
+
+func errorResponse(id json.RawMessage, code int, message string, err error) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	rpcErr := &rpcError{Code: code, Message: message}
+	if err != nil {
+		rpcErr.Data = err.Error()
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: rpcErr}
+}
+
+// mustMarshal encodes the gateway's own responses, which always encode.
+func mustMarshal(v any) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// gatewaySocket is a WebSocket connection to the gateway and its bus subscriptions.
+type gatewaySocket struct {
+	gateway  *Gateway
+	conn     *wsConn
+	out      chan []byte   // messages waiting for write
+	requests chan struct{} // held by the requests being served
+	lock     sync.Mutex    // guards subs and nextSub
+	subs     map[string]func()
+	nextSub  int
+}
+
+func (g *Gateway) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		logging.WithError(err).Warn("could not upgrade gateway connection")
+		return
+	}
+	g.lock.Lock()
+	g.sockets[conn] = struct{}{}
+	g.lock.Unlock()
+	socket := &gatewaySocket{
+		gateway:  g,
+		conn:     conn,
+		out:      make(chan []byte, wsQueueSize),
+		requests: make(chan struct{}, maxSocketRequests),
+		subs:     make(map[string]func()),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go socket.write(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+		socket.unsubscribeAll()
+		g.lock.Lock()
+		delete(g.sockets, conn)
+		g.lock.Unlock()
+		conn.Close()
+	}()
+	for {
+		opcode, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if opcode != wsText {
+			continue
+		}
+		// stop reading from a client with too many requests in flight until one of them is answered
+		socket.requests <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-socket.requests }()
+			if reply := g.handleMessage(ctx, message, socket); reply != nil {
+				socket.send(reply)
+			}
+		}()
+	}
+}
+
+// send queues a message for the client without waiting for it, and closes the connection if
+// the queue is full.
+func (s *gatewaySocket) send(message []byte) {
+	select {
+	case s.out <- message:
+	default:
+		logging.Debug("gateway client does not keep up with its messages, disconnecting")
+		s.conn.Close()
+	}
+}
+
+// write writes the queued messages to the client until ctx is done.
+func (s *gatewaySocket) write(ctx context.Context) {
+	for {
+		select {
+		case message := <-s.out:
+			if err := s.conn.WriteMessage(wsText, message); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe subscribes the socket to a topic or pattern, and returns the ID of the subscription.
+// Only the events on topics opened with WithTopics are delivered.
+func (s *gatewaySocket) subscribe(pattern string) (any, *rpcError) {
+	if len(s.gateway.patterns) == 0 || s.gateway.err != nil {
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: "no topics are open to gateway clients"}
+	}
+	s.lock.Lock()
+	s.nextSub++
+	id := strconv.Itoa(s.nextSub)
+	s.lock.Unlock()
+	// transactional, so that the events reach the client in the order they were published
+	sub, err := s.gateway.overseer.eventBus.SubscribePatternAsync(pattern, func(topic string, data any) {
+		if !s.gateway.topics.Match(topic) {
+			return
+		}
+		b, err := json.Marshal(rpcNotification{
+			JSONRPC: "2.0",
+			Method:  rpcEvent,
+			Params:  rpcEventParams{Subscription: id, Topic: topic, Data: data},
+		})
+		if err != nil {
+			logging.WithField("topic", topic).WithError(err).Debug("could not encode event for gateway client")
+			return
+		}
+		s.send(b)
+	}, true)
+	if err != nil {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	s.lock.Lock()
+	s.subs[id] = sub.Unsubscribe
+	s.lock.Unlock()
+	return id, nil
+}
+
+// unsubscribe ends a subscription of the socket, and reports whether it existed.
+func (s *gatewaySocket) unsubscribe(id string) bool {
+	s.lock.Lock()
+	unsubscribe, ok := s.subs[id]
+	delete(s.subs, id)
+	s.lock.Unlock()
+	if ok {
+		unsubscribe()
+	}
+	return ok
+}
+
+func (s *gatewaySocket) unsubscribeAll() {
+	s.lock.Lock()
+	subs := s.subs
+	s.subs = make(map[string]func())
+	s.lock.Unlock()
+	for _, unsubscribe := range subs {
+		unsubscribe()
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"overseer/eventbus"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startGateway starts a gateway to a subsystem named echo, and returns its base URL.
+func startGateway(t *testing.T, opts ...GatewayOption) (eventbus.Bus, string) {
+	bus := eventbus.New()
+	echo := NewBaseSubsystem(&recordingSubsystem{name: "echo", recorder: &recorder{}})
+	echo.MustRegister("add", "Add adds two numbers.", func(ctx context.Context, a int, b int) (int, error) {
+		return a + b, nil
+	})
+	echo.MustRegister("fail", "", func(ctx context.Context) (any, error) {
+		return nil, errors.New("boom")
+	})
+	echo.registerMethod(MethodInfo{
+		Name:     "greet",
+		Args:     []reflect.Type{reflect.TypeOf("")},
+		ArgNames: []string{"name"},
+		Result:   reflect.TypeOf(""),
+	}, func(ctx context.Context, args ...any) (any, error) {
+		return "hello " + args[0].(string), nil
+	})
+	overseer := NewOverseer(bus, echo)
+	gateway := NewGateway(overseer, "127.0.0.1:0", opts...)
+	require.NoError(t, overseer.RegisterSubsystem(NewBaseSubsystem(gateway)))
+	require.NoError(t, overseer.StartAll(context.Background()))
+	t.Cleanup(func() { overseer.StopAll(context.Background()) })
+	return bus, "http://" + gateway.Addr().String()
+}
+
+func postRPC(t *testing.T, url string, body string) (int, string) {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var b strings.Builder
+	_, err = bufio.NewReader(resp.Body).WriteTo(&b)
+	require.NoError(t, err)
+	return resp.StatusCode, b.String()
+}
+
+func TestGatewayHTTP(t *testing.T) {
+	_, url := startGateway(t)
+
+	for _, tc := range []struct {
+		name string
+		body string
+		want string
+	}{
+		{"positional", `{"jsonrpc":"2.0","id":1,"method":"echo_add","params":[2,3]}`, `{"jsonrpc":"2.0","id":1,"result":5}`},
+		{"named", `{"jsonrpc":"2.0","id":"a","method":"echo_greet","params":{"name":"bob"}}`, `{"jsonrpc":"2.0","id":"a","result":"hello bob"}`},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"echo_nope"}`, `"code":-32601`},
+		{"unknown subsystem", `{"jsonrpc":"2.0","id":1,"method":"nope_add"}`, `"code":-32601`},
+		{"wrong arity", `{"jsonrpc":"2.0","id":1,"method":"echo_add","params":[1]}`, `"code":-32602`},
+		{"wrong type", `{"jsonrpc":"2.0","id":1,"method":"echo_add","params":["1",2]}`, `"code":-32602`},
+		{"named without names", `{"jsonrpc":"2.0","id":1,"method":"echo_add","params":{"a":1}}`, `"code":-32602`},
+		{"domain error", `{"jsonrpc":"2.0","id":1,"method":"echo_fail"}`, `"code":-32000`},
+		{"parse error", `{"jsonrpc":`, `"code":-32700`},
+		{"invalid request", `{"id":1,"method":"echo_add"}`, `"code":-32600`},
+		{"subscribe over http", `{"jsonrpc":"2.0","id":1,"method":"bus_subscribe","params":["x"]}`, `"code":-32601`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := postRPC(t, url, tc.body)
+			require.Equal(t, http.StatusOK, status)
+			require.Contains(t, body, tc.want)
+		})
+	}
+
+	_, body := postRPC(t, url, `{"jsonrpc":"2.0","id":1,"method":"echo_fail"}`)
+	var resp struct {
+		Error struct {
+			Data struct {
+				Code      ErrorCode `json:"code"`
+				Subsystem string    `json:"subsystem"`
+				RequestID string    `json:"request_id"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	require.Equal(t, CodeDomain, resp.Error.Data.Code)
+	require.Equal(t, "echo", resp.Error.Data.Subsystem)
+	require.True(t, strings.HasPrefix(resp.Error.Data.RequestID, GatewayName+":"))
+	require.True(t, strings.HasSuffix(resp.Error.Data.RequestID, ":1"))
+
+	status, _ := postRPC(t, url, `{"jsonrpc":"2.0","method":"echo_add","params":[1,2]}`)
+	require.Equal(t, http.StatusNoContent, status)
+
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestGatewayBatch(t *testing.T) {
+	_, url := startGateway(t)
+
+	_, body := postRPC(t, url, `[
+		{"jsonrpc":"2.0","id":1,"method":"echo_add","params":[1,1]},
+		{"jsonrpc":"2.0","method":"echo_add","params":[1,2]},
+		{"jsonrpc":"2.0","id":2,"method":"echo_nope"},
+		{"jsonrpc":"2.0","id":3,"method":"echo_add","params":[1,3]}
+	]`)
+	var responses []rpcResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &responses))
+	require.Len(t, responses, 3)
+	require.JSONEq(t, "1", string(responses[0].ID))
+	require.JSONEq(t, "2", string(responses[0].Result))
+	require.Equal(t, rpcMethodNotFound, responses[1].Error.Code)
+	require.JSONEq(t, "4", string(responses[2].Result))
+
+	status, _ := postRPC(t, url, `[{"jsonrpc":"2.0","method":"echo_add","params":[1,2]}]`)
+	require.Equal(t, http.StatusNoContent, status)
+
+	_, body = postRPC(t, url, `[]`)
+	require.Contains(t, body, `"code":-32600`)
+}
+
+// dialWebSocket connects to the gateway at url as a WebSocket client.
+func dialWebSocket(t *testing.T, url string) *wsConn {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	var nonce [16]byte
+	_, err = rand.Read(nonce[:])
+	require.NoError(t, err)
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	_, err = fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: gateway\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %v\r\nSec-WebSocket-Version: 13\r\n\r\n", key)
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, websocketAccept(key), resp.Header.Get("Sec-WebSocket-Accept"))
+	return &wsConn{conn: conn, r: r, mask: true}
+}
+
+func readJSON(t *testing.T, conn *wsConn, v any) {
+	require.NoError(t, conn.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	opcode, message, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, byte(wsText), opcode)
+	require.NoError(t, json.Unmarshal(message, v))
+}
+
+func TestGatewayWebSocket(t *testing.T) {
+	bus, url := startGateway(t, WithTopics("orders:*"))
+	conn := dialWebSocket(t, url)
+
+	require.NoError(t, conn.WriteMessage(wsText, []byte(`{"jsonrpc":"2.0","id":1,"method":"echo_add","params":[20,22]}`)))
+	var resp rpcResponse
+	readJSON(t, conn, &resp)
+	require.JSONEq(t, "42", string(resp.Result))
+
+	require.NoError(t, conn.WriteMessage(wsText, []byte(`{"jsonrpc":"2.0","id":2,"method":"bus_subscribe","params":["orders:*"]}`)))
+	resp = rpcResponse{}
+	readJSON(t, conn, &resp)
+	require.Nil(t, resp.Error)
+	var subscription string
+	require.NoError(t, json.Unmarshal(resp.Result, &subscription))
+
+	require.NoError(t, bus.Publish("orders:created", map[string]int{"id": 7}))
+	require.NoError(t, bus.Publish("users:created", "ignored"))
+	require.NoError(t, bus.Publish("orders:paid", map[string]int{"id": 7}))
+	for _, topic := range []string{"orders:created", "orders:paid"} {
+		var event struct {
+			Method string         `json:"method"`
+			Params rpcEventParams `json:"params"`
+		}
+		readJSON(t, conn, &event)
+		require.Equal(t, rpcEvent, event.Method)
+		require.Equal(t, subscription, event.Params.Subscription)
+		require.Equal(t, topic, event.Params.Topic)
+		require.Equal(t, map[string]any{"id": float64(7)}, event.Params.Data)
+	}
+
+	require.NoError(t, conn.WriteMessage(wsText, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":3,"method":"bus_unsubscribe","params":[%q]}`, subscription))))
+	resp = rpcResponse{}
+	readJSON(t, conn, &resp)
+	require.JSONEq(t, "true", string(resp.Result))
+
+	require.NoError(t, bus.Publish("orders:created", 8))
+	require.NoError(t, conn.WriteMessage(wsText, []byte(`{"jsonrpc":"2.0","id":4,"method":"echo_add","params":[1,1]}`)))
+	resp = rpcResponse{}
+	readJSON(t, conn, &resp)
+	require.JSONEq(t, "4", string(resp.ID))
+}
+
+func TestGatewayCrossSiteRequests(t *testing.T) {
+	_, url := startGateway(t)
+	body := `{"jsonrpc":"2.0","id":1,"method":"echo_add","params":[1,2]}`
+
+	for _, tc := range []struct {
+		name        string
+		method      string
+		contentType string
+		origin      string
+		upgrade     bool
+		want        int
+	}{
+		{"json", http.MethodPost, "application/json; charset=utf-8", "", false, http.StatusOK},
+		{"form", http.MethodPost, "application/x-www-form-urlencoded", "", false, http.StatusUnsupportedMediaType},
+		{"text", http.MethodPost, "text/plain", "", false, http.StatusUnsupportedMediaType},
+		{"same origin", http.MethodPost, "application/json", url, false, http.StatusOK},
+		{"foreign origin", http.MethodPost, "application/json", "https://evil.example", false, http.StatusForbidden},
+		{"foreign websocket", http.MethodGet, "", "https://evil.example", true, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, url, strings.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.upgrade {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+				req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+				req.Header.Set("Sec-WebSocket-Version", "13")
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tc.want, resp.StatusCode)
+		})
+	}
+
+	gateway := NewGateway(nil, "", WithAllowedOrigins("https://app.example"))
+	for origin, allowed := range map[string]bool{"https://app.example": true, "https://evil.example": false} {
+		req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:8545", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		require.Equal(t, allowed, gateway.allowOrigin(req), origin)
+	}
+}
+
+func TestGatewayWebSocketTopics(t *testing.T) {
+	bus, url := startGateway(t)
+	conn := dialWebSocket(t, url)
+	require.NoError(t, conn.WriteMessage(wsText, []byte(`{"jsonrpc":"2.0","id":1,"method":"bus_subscribe","params":["#"]}`)))
+	var resp rpcResponse
+	readJSON(t, conn, &resp)
+	require.NotNil(t, resp.Error)
+
+	bus, url = startGateway(t, WithTopics("orders:*"))
+	conn = dialWebSocket(t, url)
+	require.NoError(t, conn.WriteMessage(wsText, []byte(`{"jsonrpc":"2.0","id":1,"method":"bus_subscribe","params":["#"]}`)))
+	resp = rpcResponse{}
+	readJSON(t, conn, &resp)
+	require.Nil(t, resp.Error)
+
+	// the responses to other callers are not delivered
+	require.Equal(t, "echo", SubsystemMethod(bus, "test", "echo", "ping").Data)
+	require.NoError(t, bus.Publish("orders:created", 7))
+	var event struct {
+		Params rpcEventParams `json:"params"`
+	}
+	readJSON(t, conn, &event)
+	require.Equal(t, "orders:created", event.Params.Topic)
+}
+
+func TestGatewayStalledWebSocket(t *testing.T) {
+	bus, url := startGateway(t, WithTopics("orders:*"))
+	conn := dialWebSocket(t, url)
+	require.NoError(t, conn.WriteMessage(wsText, []byte(`{"jsonrpc":"2.0","id":1,"method":"bus_subscribe","params":["orders:*"]}`)))
+	var resp rpcResponse
+	readJSON(t, conn, &resp)
+	require.Nil(t, resp.Error)
+
+	// the client stops reading, which must not hold up publishers
+	payload := strings.Repeat("x", 64<<10)
+	for i := 0; i < 2*wsQueueSize; i++ {
+		start := time.Now()
+		require.NoError(t, bus.Publish("orders:created", payload))
+		bus.WaitAsync()
+		require.Less(t, time.Since(start), time.Second)
+	}
+	// the gateway disconnected the client once its queue was full
+	require.NoError(t, conn.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			require.False(t, errors.As(err, &netErr) && netErr.Timeout(), "client was not disconnected")
+			break
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// readHeaderTimeout bounds how long a client may take to send the headers of a request.
+const readHeaderTimeout = 10 * time.Second
+
+// httpServer serves the handler of a subsystem on a listening address while the subsystem runs.
+type httpServer struct {
+	addr     string
+	lock     sync.Mutex // guards server and listener
+	server   *http.Server
+	listener net.Listener
+}
+
+// start starts listening, and fails bs if serving stops other than by stop.
+func (s *httpServer) start(bs *BaseSubsystem, handler http.Handler) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+	s.lock.Lock()
+	s.server, s.listener = server, listener
+	s.lock.Unlock()
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			bs.Fail(err)
+		}
+	}()
+	logging.WithFields(logging.Fields{"Subsystem": bs.Name(), "addr": listener.Addr()}).Info("listening")
+	return nil
+}
+
+// stop closes the listener and every connection.
+func (s *httpServer) stop() error {
+	s.lock.Lock()
+	server := s.server
+	s.server, s.listener = nil, nil
+	s.lock.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Close()
+}
+
+// Addr returns the address listened on, or nil if the server is not running.
+func (s *httpServer) Addr() net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
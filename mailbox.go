@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// errMailboxClosed is returned when a message or signal is routed to a subsystem that stopped.
+var errMailboxClosed = errors.New("subsystem mailbox is closed")
+
+// errSignalPending is returned when a method call closing a call cycle is routed to a subsystem
+// with a signal pending: the signal waits for the call that started the cycle, which waits for the
+// call queued behind the signal.
+var errSignalPending = errors.New("subsystem has a signal pending")
+
+// maxConcurrentCalls bounds the goroutines running the method calls of a subsystem without
+// WithMailbox. Further calls wait in the mailbox until one of them returned.
+const maxConcurrentCalls = 1024
+
+// mailboxConfig configures the mailbox of each run of a subsystem, see WithMailbox.
+type mailboxConfig struct {
+	capacity int // of pending method calls, 0 if unbounded
+	workers  int // 0 runs every method call in a goroutine of its own
+}
+
+// WithMailbox serves the method calls of the subsystem from a mailbox holding at most capacity
+// pending calls, or any number if capacity is 0, which workers goroutines process in order. With a
+// single worker, calls run one at a time in the order they were routed, so the implementation may
+// keep state without locks, but must not wait for calls to itself. Calls routed to a full mailbox
+// fail with ErrMailboxFull.
+//
+// Without WithMailbox, the mailbox is unbounded and every call runs in a goroutine of its own, at
+// most 1024 at a time.
+func WithMailbox(capacity int, workers int) SubsystemOption {
+	return func(bs *BaseSubsystem) {
+		bs.mailboxConfig = mailboxConfig{capacity: max(capacity, 0), workers: max(workers, 1)}
+	}
+}
+
+// envelope is an entry in a subsystem's mailbox: either a method call or a signal.
+type envelope struct {
+	// run executes a method call; reject is called instead if the mailbox closes first.
+	run    func()
+	reject func(err error)
+	// cycle marks a method call closing a call cycle, which is rejected while a signal is pending.
+	cycle bool
+
+	// signal is delivered to the subsystem, and the result of OnSignal is sent on ack.
+	signal Signal
+	ctx    context.Context
+	ack    chan<- error
+}
+
+// mailbox is the queue of envelopes routed to a running subsystem.
+type mailbox struct {
+	mailboxConfig
+	lock    sync.Mutex
+	items   []envelope
+	calls   int           // method calls in items
+	signals int           // signals pushed and not delivered yet
+	slots   chan struct{} // held by the calls running in goroutines of their own, if workers is 0
+	closed  bool
+	ready   chan struct{}
+
+	// order is held by a worker from taking an envelope until it entered the barrier, so that
+	// envelopes enter the barrier in the order they were queued.
+	order sync.Mutex
+}
+
+func newMailbox(config mailboxConfig) *mailbox {
+	m := &mailbox{mailboxConfig: config, ready: make(chan struct{}, 1)}
+	if config.workers == 0 {
+		m.slots = make(chan struct{}, maxConcurrentCalls)
+	}
+	return m
+}
+
+// push queues env. Signals are always accepted, method calls only while the mailbox has capacity.
+func (m *mailbox) push(env envelope) error {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return errMailboxClosed
+	}
+	if env.signal != nil {
+		m.signals++
+	} else {
+		if m.capacity > 0 && m.calls >= m.capacity {
+			m.lock.Unlock()
+			return ErrMailboxFull
+		}
+		if env.cycle && m.signals > 0 {
+			m.lock.Unlock()
+			return errSignalPending
+		}
+		m.calls++
+	}
+	m.items = append(m.items, env)
+	m.lock.Unlock()
+	m.wake()
+	return nil
+}
+
+// pop blocks until an envelope is available, and returns false once the mailbox is closed.
+func (m *mailbox) pop() (envelope, bool) {
+	for {
+		m.lock.Lock()
+		if m.closed {
+			m.lock.Unlock()
+			return envelope{}, false
+		}
+		if len(m.items) > 0 {
+			env := m.items[0]
+			m.items[0] = envelope{}
+			m.items = m.items[1:]
+			if env.signal == nil {
+				m.calls--
+			}
+			m.lock.Unlock()
+			return env, true
+		}
+		m.lock.Unlock()
+		<-m.ready
+	}
+}
+
+// close closes the mailbox and rejects the envelopes that were not dispatched yet.
+func (m *mailbox) close() {
+	m.lock.Lock()
+	m.closed = true
+	pending := m.items
+	m.items = nil
+	m.calls = 0
+	for _, env := range pending {
+		if env.signal != nil {
+			m.signals--
+		}
+	}
+	m.lock.Unlock()
+	m.wake()
+	for _, env := range pending {
+		if env.signal != nil {
+			env.ack <- errMailboxClosed
+		} else if env.reject != nil {
+			env.reject(errMailboxClosed)
+		}
+	}
+}
+
+func (m *mailbox) wake() {
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+}
+
+// openMailbox creates the mailbox for a run of the subsystem and starts dispatching from it.
+func (bs *BaseSubsystem) openMailbox() {
+	m := newMailbox(bs.mailboxConfig)
+	bs.lock.Lock()
+	bs.mailbox = m
+	bs.lock.Unlock()
+	for i := 0; i < max(m.workers, 1); i++ {
+		go bs.dispatch(m)
+	}
+}
+
+// closeMailbox closes the mailbox of the current run, if any.
+func (bs *BaseSubsystem) closeMailbox() {
+	bs.lock.Lock()
+	m := bs.mailbox
+	bs.mailbox = nil
+	bs.lock.Unlock()
+	if m != nil {
+		m.close()
+	}
+}
+
+// enqueue routes an envelope to the subsystem.
+func (bs *BaseSubsystem) enqueue(env envelope) error {
+	bs.lock.Lock()
+	m := bs.mailbox
+	bs.lock.Unlock()
+	if m == nil {
+		return errMailboxClosed
+	}
+	return m.push(env)
+}
+
+// dispatch delivers the envelopes of a mailbox in order. Method calls may run concurrently with
+// each other, but a signal is only delivered once every call dispatched before it has returned, and
+// calls dispatched after it wait until it has been handled. Calls run on the workers of the mailbox,
+// or in goroutines of their own, at most maxConcurrentCalls, if it has none.
+func (bs *BaseSubsystem) dispatch(m *mailbox) {
+	for {
+		m.order.Lock()
+		env, ok := m.pop()
+		if !ok {
+			m.order.Unlock()
+			return
+		}
+		if env.signal != nil {
+			bs.barrier.Lock()
+			m.order.Unlock()
+			err := bs.deliverSignal(env.ctx, env.signal)
+			bs.barrier.Unlock()
+			m.lock.Lock()
+			m.signals--
+			m.lock.Unlock()
+			env.ack <- err
+			continue
+		}
+		bs.barrier.RLock()
+		m.order.Unlock()
+		if m.workers == 0 {
+			m.slots <- struct{}{}
+			go func() {
+				defer func() { <-m.slots }()
+				defer bs.barrier.RUnlock()
+				env.run()
+			}()
+			continue
+		}
+		env.run()
+		bs.barrier.RUnlock()
+	}
+}
+
+func (bs *BaseSubsystem) deliverSignal(ctx context.Context, signal Signal) (err error) {
+	handler, ok := bs.impl.(SignalHandler)
+	if !ok {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logging.WithFields(logging.Fields{
+				"bsname": bs.name,
+				"signal": signal,
+				"error":  r,
+			}).Error("panicked during OnSignal")
+			err = fmt.Errorf("panicked during OnSignal: %v", r)
+			bs.Fail(err)
+		}
+	}()
+	return handler.OnSignal(ctx, signal)
+}
+
+// servesOneAtATime reports whether the subsystem runs its method calls one at a time, see
+// WithMailbox.
+func (bs *BaseSubsystem) servesOneAtATime() bool {
+	return bs.mailboxConfig.workers == 1
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"overseer/eventbus"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailboxProcessesCallsInOrder(t *testing.T) {
+	bus := eventbus.New()
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "actor", recorder: &recorder{}}, WithMailbox(0, 1))
+	// no locks: with a single worker, calls never overlap
+	var received []int
+	running := 0
+	bs.MustRegister("append", "", func(ctx context.Context, i int) (int, error) {
+		running++
+		defer func() { running-- }()
+		if running > 1 {
+			return 0, fmt.Errorf("%d calls running", running)
+		}
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+		received = append(received, i)
+		return i, nil
+	})
+	overseer := NewOverseer(bus, bs)
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	const calls = 20
+	responses := make([]<-chan interface{}, calls)
+	for i := range responses {
+		id := fmt.Sprintf("request-%d", i)
+		ch, _, err := AwaitTopic(context.Background(), bus, id)
+		require.NoError(t, err)
+		responses[i] = ch
+		require.NoError(t, bus.Publish("method", MethodRequest{Caller: "test", Subsystem: "actor", Method: "append", ID: id, Data: []any{i}}))
+	}
+	for i, ch := range responses {
+		resp := (<-ch).(MethodResponse)
+		require.NoError(t, resp.Error)
+		require.Equal(t, i, resp.Data)
+	}
+
+	expected := make([]int, calls)
+	for i := range expected {
+		expected[i] = i
+	}
+	require.Equal(t, expected, received)
+}
+
+func TestMailboxCapacity(t *testing.T) {
+	bus := eventbus.New()
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "actor", recorder: &recorder{}}, WithMailbox(1, 1))
+	bs.MustRegister("block", "", func(ctx context.Context) (any, error) {
+		entered <- struct{}{}
+		<-release
+		return nil, nil
+	})
+	overseer := NewOverseer(bus, bs)
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	first := make(chan MethodResponse, 1)
+	go func() {
+		first <- SubsystemMethod(bus, "test", "actor", "block")
+	}()
+	<-entered
+	second := make(chan MethodResponse, 1)
+	go func() {
+		second <- SubsystemMethod(bus, "test", "actor", "block")
+	}()
+	require.Eventually(t, func() bool {
+		bs.lock.Lock()
+		m := bs.mailbox
+		bs.lock.Unlock()
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		return m.calls == 1
+	}, time.Second, time.Millisecond)
+	resp := SubsystemMethod(bus, "test", "actor", "block")
+	require.ErrorIs(t, resp.Error, ErrMailboxFull)
+
+	close(release)
+	require.NoError(t, (<-first).Error)
+	require.NoError(t, (<-second).Error)
+}
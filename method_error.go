@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorCode classifies a MethodError.
+type ErrorCode string
+
+const (
+	// CodeUnknown is used for errors decoded without a code.
+	CodeUnknown ErrorCode = "unknown"
+
+	// CodeSubsystemNotFound means no subsystem is registered under the requested name.
+	CodeSubsystemNotFound ErrorCode = "subsystem_not_found"
+
+	// CodeSubsystemNotRunning means the requested subsystem is registered but not running.
+	CodeSubsystemNotRunning ErrorCode = "subsystem_not_running"
+
+	// CodeMethodNotFound means the subsystem does not serve the requested method.
+	CodeMethodNotFound ErrorCode = "method_not_found"
+
+	// CodePermissionDenied means the access policy of the overseer does not allow the caller to
+	// call the method.
+	CodePermissionDenied ErrorCode = "permission_denied"
+
+	// CodeMailboxFull means the mailbox of the subsystem has no room for the request.
+	CodeMailboxFull ErrorCode = "mailbox_full"
+
+	// CodeCallCycle means the request was made while the requested subsystem is serving a call
+	// waiting for it, directly or through other subsystems.
+	CodeCallCycle ErrorCode = "call_cycle"
+
+	// CodeInvalidArgs means the arguments do not match the parameters of the method.
+	CodeInvalidArgs ErrorCode = "invalid_args"
+
+	// CodeTypeMismatch means the caller and the callee of a typed method disagree on a type.
+	CodeTypeMismatch ErrorCode = "type_mismatch"
+
+	// CodePanicked means the method panicked.
+	CodePanicked ErrorCode = "panicked"
+
+	// CodeTimeout means the call did not complete before the caller's deadline.
+	CodeTimeout ErrorCode = "timeout"
+
+	// CodeCancelled means the caller cancelled the call.
+	CodeCancelled ErrorCode = "cancelled"
+
+	// CodeDomain means the method itself returned an error.
+	CodeDomain ErrorCode = "domain"
+)
+
+// MethodError is the error of a MethodResponse. It records where a call failed and why, wraps
+// the underlying cause, and survives JSON and binary encoding when responses cross process
+// boundaries. errors.Is matches a MethodError against the sentinel of its code, so
+//
+//	errors.Is(err, ErrSubsystemNotRunning)
+//
+// holds for any error of that code, also after decoding.
+type MethodError struct {
+	Code      ErrorCode
+	Message   string
+	Subsystem string
+	Method    string
+	RequestID string
+	Cause     error
+}
+
+// Sentinel errors, one per ErrorCode, to be matched with errors.Is.
+var (
+	ErrSubsystemNotFound   = &MethodError{Code: CodeSubsystemNotFound, Message: "subsystem not found"}
+	ErrSubsystemNotRunning = &MethodError{Code: CodeSubsystemNotRunning, Message: "subsystem not running"}
+	ErrMethodNotFound      = &MethodError{Code: CodeMethodNotFound, Message: "method not found"}
+	ErrPermissionDenied    = &MethodError{Code: CodePermissionDenied, Message: "permission denied"}
+	ErrMailboxFull         = &MethodError{Code: CodeMailboxFull, Message: "mailbox full"}
+	ErrCallCycle           = &MethodError{Code: CodeCallCycle, Message: "call cycle"}
+	ErrInvalidArgs         = &MethodError{Code: CodeInvalidArgs, Message: "invalid args"}
+	ErrTypeMismatch        = &MethodError{Code: CodeTypeMismatch, Message: "type mismatch"}
+	ErrPanicked            = &MethodError{Code: CodePanicked, Message: "panicked"}
+	ErrMethodTimeout       = &MethodError{Code: CodeTimeout, Message: "method call timed out"}
+	ErrMethodCancelled     = &MethodError{Code: CodeCancelled, Message: "method call cancelled"}
+	ErrDomain              = &MethodError{Code: CodeDomain, Message: "method failed"}
+)
+
+var sentinels = []*MethodError{
+	ErrSubsystemNotFound,
+	ErrSubsystemNotRunning,
+	ErrMethodNotFound,
+	ErrPermissionDenied,
+	ErrMailboxFull,
+	ErrCallCycle,
+	ErrInvalidArgs,
+	ErrTypeMismatch,
+	ErrPanicked,
+	ErrMethodTimeout,
+	ErrMethodCancelled,
+	ErrDomain,
+}
+
+// Error describes the failed call. A MethodError without a message only classifies its cause,
+// and reads like the cause.
+func (e *MethodError) Error() string {
+	if e.Message == "" && e.Cause != nil {
+		return e.Cause.Error()
+	}
+	var parts []string
+	if e.Subsystem != "" || e.Method != "" {
+		parts = append(parts, e.Subsystem+"."+e.Method)
+	}
+	if e.Message != "" {
+		parts = append(parts, e.Message)
+	}
+	if e.Cause != nil {
+		parts = append(parts, e.Cause.Error())
+	}
+	if len(parts) == 0 {
+		return string(e.Code)
+	}
+	return strings.Join(parts, ": ")
+}
+
+func (e *MethodError) Unwrap() error {
+	return e.Cause
+}
+
+// Is reports whether target is the sentinel of the code of e.
+func (e *MethodError) Is(target error) bool {
+	t, ok := target.(*MethodError)
+	return ok && t.Code == e.Code && isSentinel(t)
+}
+
+func isSentinel(e *MethodError) bool {
+	for _, sentinel := range sentinels {
+		if e == sentinel {
+			return true
+		}
+	}
+	return false
+}
+
+// methodErrorJSON is the encoded form of a MethodError. A cause that is not a MethodError is
+// encoded as a MethodError carrying its message and the code it matches.
+type methodErrorJSON struct {
+	Code      ErrorCode        `json:"code"`
+	Message   string           `json:"message,omitempty"`
+	Subsystem string           `json:"subsystem,omitempty"`
+	Method    string           `json:"method,omitempty"`
+	RequestID string           `json:"request_id,omitempty"`
+	Cause     *methodErrorJSON `json:"cause,omitempty"`
+}
+
+func toMethodErrorJSON(err error) *methodErrorJSON {
+	if err == nil {
+		return nil
+	}
+	var e *MethodError
+	if !errors.As(err, &e) || e != err {
+		return &methodErrorJSON{Code: codeOf(err), Message: err.Error()}
+	}
+	if isSentinel(e) {
+		return &methodErrorJSON{Code: e.Code, Message: e.Message}
+	}
+	return &methodErrorJSON{
+		Code:      e.Code,
+		Message:   e.Message,
+		Subsystem: e.Subsystem,
+		Method:    e.Method,
+		RequestID: e.RequestID,
+		Cause:     toMethodErrorJSON(e.Cause),
+	}
+}
+
+func (j *methodErrorJSON) methodError() *MethodError {
+	if j == nil {
+		return nil
+	}
+	code := j.Code
+	if code == "" {
+		code = CodeUnknown
+	}
+	e := &MethodError{
+		Code:      code,
+		Message:   j.Message,
+		Subsystem: j.Subsystem,
+		Method:    j.Method,
+		RequestID: j.RequestID,
+	}
+	if cause := j.Cause.methodError(); cause != nil {
+		e.Cause = cause
+	}
+	return e
+}
+
+func (e *MethodError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(toMethodErrorJSON(e))
+}
+
+func (e *MethodError) UnmarshalJSON(data []byte) error {
+	var j methodErrorJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*e = *j.methodError()
+	return nil
+}
+
+// MarshalBinary encodes the error for encoding/gob and other binary codecs.
+func (e *MethodError) MarshalBinary() ([]byte, error) {
+	return e.MarshalJSON()
+}
+
+func (e *MethodError) UnmarshalBinary(data []byte) error {
+	return e.UnmarshalJSON(data)
+}
+
+// codeOf returns the code of the first sentinel err matches, or CodeDomain.
+func codeOf(err error) ErrorCode {
+	for _, sentinel := range sentinels {
+		if errors.Is(err, sentinel) {
+			return sentinel.Code
+		}
+	}
+	return CodeDomain
+}
+
+// AsMethodError converts err into a *MethodError describing a failed call of method on subsystem.
+// A *MethodError is returned as is, with missing call details filled in; any other error becomes
+// the cause of a new MethodError whose code is derived from the sentinels err matches, or
+// CodeDomain if it matches none.
+func AsMethodError(err error, subsystem string, method string, requestID string) *MethodError {
+	if err == nil {
+		return nil
+	}
+	var e *MethodError
+	if errors.As(err, &e) && e == err && !isSentinel(e) {
+		copied := *e
+		if copied.Subsystem == "" {
+			copied.Subsystem = subsystem
+		}
+		if copied.Method == "" {
+			copied.Method = method
+		}
+		if copied.RequestID == "" {
+			copied.RequestID = requestID
+		}
+		return &copied
+	}
+	return &MethodError{
+		Code:      codeOf(err),
+		Subsystem: subsystem,
+		Method:    method,
+		RequestID: requestID,
+		Cause:     err,
+	}
+}
+
+// newMethodError returns a MethodError of the code of sentinel for a call described by req.
+func newMethodError(sentinel *MethodError, req MethodRequest, format string, args ...any) *MethodError {
+	message := sentinel.Message
+	if format != "" {
+		message = fmt.Sprintf(format, args...)
+	}
+	return &MethodError{
+		Code:      sentinel.Code,
+		Message:   message,
+		Subsystem: req.Subsystem,
+		Method:    req.Method,
+		RequestID: req.ID,
+	}
+}
+
+func init() {
+	// lets encoding/gob carry a *MethodError in the error field of a MethodResponse
+	gob.Register(&MethodError{})
+	// and the messages of the overseer across an eventbus.RemoteBus
+	gob.Register(MethodRequest{})
+	gob.Register(MethodResponse{})
+	gob.Register(MethodCancel{})
+	gob.Register(StateTransition{})
+	gob.Register(AuditEvent{})
+	gob.Register(SupervisorEvent{})
+	gob.Register(TracedEvent{})
+}
+
+// methodResponseJSON is the encoded form of a MethodResponse.
+type methodResponseJSON struct {
+	Request MethodRequest `json:"request"`
+	Error   *MethodError  `json:"error,omitempty"`
+	Data    interface{}   `json:"data,omitempty"`
+}
+
+// MarshalJSON encodes the error of the response as a MethodError.
+func (r MethodResponse) MarshalJSON() ([]byte, error) {
+	resp := methodResponseJSON{Request: r.Request, Data: r.Data}
+	if r.Error != nil {
+		resp.Error = AsMethodError(r.Error, r.Request.Subsystem, r.Request.Method, r.Request.ID)
+	}
+	return json.Marshal(resp)
+}
+
+func (r *MethodResponse) UnmarshalJSON(data []byte) error {
+	var resp methodResponseJSON
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	r.Request = resp.Request
+	r.Data = resp.Data
+	r.Error = nil
+	if resp.Error != nil {
+		r.Error = resp.Error
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"overseer/eventbus"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethodErrorCodes(t *testing.T) {
+	bus := eventbus.New()
+	errNegative := errors.New("negative")
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "math", recorder: &recorder{}})
+	bs.MustRegister("sqrt", "", func(ctx context.Context, x int) (int, error) {
+		if x < 0 {
+			return 0, errNegative
+		}
+		return x, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	overseer := NewOverseer(bus, bs, NewSubsystem1(ctx, bus))
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	for _, tc := range []struct {
+		name      string
+		subsystem string
+		method    string
+		args      []any
+		sentinel  *MethodError
+	}{
+		{"method not found", "subsystem1", "missing", nil, ErrMethodNotFound},
+		{"invalid args", "math", "sqrt", []any{"4"}, ErrInvalidArgs},
+		{"domain", "math", "sqrt", []any{-4}, ErrDomain},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := SubsystemMethod(bus, "test", tc.subsystem, tc.method, tc.args...)
+			require.ErrorIs(t, resp.Error, tc.sentinel)
+			var methodErr *MethodError
+			require.True(t, errors.As(resp.Error, &methodErr))
+			require.Equal(t, tc.sentinel.Code, methodErr.Code)
+			require.Equal(t, tc.subsystem, methodErr.Subsystem)
+			require.Equal(t, tc.method, methodErr.Method)
+			require.Equal(t, resp.Request.ID, methodErr.RequestID)
+		})
+	}
+
+	resp := SubsystemMethod(bus, "test", "math", "sqrt", -4)
+	require.ErrorIs(t, resp.Error, errNegative)
+	require.EqualError(t, resp.Error, "negative")
+
+	resp = SubsystemMethod(bus, "test", "math", "panic")
+	require.ErrorIs(t, resp.Error, ErrPanicked)
+	require.NoError(t, bs.WaitFor(context.Background(), FailedState))
+}
+
+func TestMethodErrorEncoding(t *testing.T) {
+	err := &MethodError{
+		Code:      CodeSubsystemNotRunning,
+		Message:   "subsystem math is not running",
+		Subsystem: "math",
+		Method:    "sqrt",
+		RequestID: "1f",
+		Cause:     errMailboxClosed,
+	}
+
+	data, marshalErr := json.Marshal(MethodResponse{Request: MethodRequest{ID: "1f"}, Error: err})
+	require.NoError(t, marshalErr)
+	var resp MethodResponse
+	require.NoError(t, json.Unmarshal(data, &resp))
+	require.ErrorIs(t, resp.Error, ErrSubsystemNotRunning)
+	require.EqualError(t, resp.Error, err.Error())
+	var decoded *MethodError
+	require.True(t, errors.As(resp.Error, &decoded))
+	require.Equal(t, "math", decoded.Subsystem)
+	require.Equal(t, "1f", decoded.RequestID)
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(MethodResponse{Error: AsMethodError(ErrInvalidArgs, "math", "sqrt", "20")}))
+	resp = MethodResponse{}
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&resp))
+	require.ErrorIs(t, resp.Error, ErrInvalidArgs)
+	require.EqualError(t, resp.Error, "invalid args")
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// MethodInfo describes a method registered on a subsystem.
+type MethodInfo struct {
+	Name        string
+	Args        []reflect.Type
+	ArgNames    []string // optional, parallel to Args
+	Result      reflect.Type
+	Description string
+}
+
+// MarshalJSON renders the argument and result types by name.
+func (m MethodInfo) MarshalJSON() ([]byte, error) {
+	type arg struct {
+		Name string `json:"name,omitempty"`
+		Type string `json:"type"`
+	}
+	args := make([]arg, len(m.Args))
+	for i, t := range m.Args {
+		args[i].Type = t.String()
+		if i < len(m.ArgNames) {
+			args[i].Name = m.ArgNames[i]
+		}
+	}
+	result := ""
+	if m.Result != nil {
+		result = m.Result.String()
+	}
+	return json.Marshal(struct {
+		Name        string `json:"name"`
+		Args        []arg  `json:"args"`
+		Result      string `json:"result"`
+		Description string `json:"description,omitempty"`
+	}{m.Name, args, result, m.Description})
+}
+
+// SubsystemDescription describes a registered subsystem and the methods registered on it.
+type SubsystemDescription struct {
+	Name    string         `json:"name"`
+	State   SubsystemState `json:"state"`
+	Methods []MethodInfo   `json:"methods"`
+}
+
+// registeredMethod is an entry of the method registry of a BaseSubsystem.
+type registeredMethod struct {
+	info    MethodInfo
+	handler methodHandler
+}
+
+// Register registers fn to serve method on the subsystem. fn must be a function that takes a
+// context.Context followed by the arguments of the method, and returns the result and an error:
+//
+//	bs.Register("ping", "Ping replies with pong.", func(ctx context.Context, message string) (string, error) {
+//		return "pong", nil
+//	})
+//
+// Registered methods are listed by Methods and Overseer.Describe, and take precedence over the
+// methods served by Subsystem.Call.
+func (bs *BaseSubsystem) Register(method string, description string, fn any) error {
+	v := reflect.ValueOf(fn)
+	if !v.IsValid() || v.Kind() != reflect.Func {
+		return fmt.Errorf("method %v: expected a function, got %T", method, fn)
+	}
+	t := v.Type()
+	if t.IsVariadic() || t.NumIn() < 1 || t.In(0) != contextType || t.NumOut() != 2 || t.Out(1) != errorType {
+		return fmt.Errorf("method %v: expected func(context.Context, ...) (T, error), got %v", method, t)
+	}
+
+	info := MethodInfo{Name: method, Result: t.Out(0), Description: description}
+	for i := 1; i < t.NumIn(); i++ {
+		info.Args = append(info.Args, t.In(i))
+	}
+	bs.registerMethod(info, func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != len(info.Args) {
+			return nil, fmt.Errorf("%w: %v expects %d args, got %d", ErrInvalidArgs, method, len(info.Args), len(args))
+		}
+		in := make([]reflect.Value, 0, len(args)+1)
+		if ctx == nil {
+			in = append(in, reflect.Zero(contextType))
+		} else {
+			in = append(in, reflect.ValueOf(ctx))
+		}
+		for i, arg := range args {
+			value, ok := argValue(arg, info.Args[i])
+			if !ok {
+				return nil, fmt.Errorf("%w: argument %d of %v must be %v, got %T", ErrInvalidArgs, i, method, info.Args[i], arg)
+			}
+			in = append(in, value)
+		}
+		out := v.Call(in)
+		err, _ := out[1].Interface().(error)
+		return out[0].Interface(), err
+	})
+	return nil
+}
+
+// MustRegister is Register for methods that are known to be valid. It panics on error.
+func (bs *BaseSubsystem) MustRegister(method string, description string, fn any) {
+	if err := bs.Register(method, description, fn); err != nil {
+		panic(err)
+	}
+}
+
+// registerMethod adds a method to the registry, replacing any previous method of the same name.
+func (bs *BaseSubsystem) registerMethod(info MethodInfo, handler methodHandler) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	bs.methods[info.Name] = registeredMethod{info: info, handler: handler}
+}
+
+// lookupMethod returns the handler of a registered method.
+func (bs *BaseSubsystem) lookupMethod(method string) (methodHandler, bool) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	m, ok := bs.methods[method]
+	return m.handler, ok
+}
+
+// Method returns the description of a registered method.
+func (bs *BaseSubsystem) Method(method string) (MethodInfo, bool) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	m, ok := bs.methods[method]
+	return m.info, ok
+}
+
+// Methods returns the methods registered on the subsystem, sorted by name.
+func (bs *BaseSubsystem) Methods() []MethodInfo {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	methods := make([]MethodInfo, 0, len(bs.methods))
+	for _, m := range bs.methods {
+		methods = append(methods, m.info)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].Name < methods[j].Name
+	})
+	return methods
+}
+
+// Describe lists every registered subsystem with its state and registered methods, sorted by name.
+func (s *Overseer) Describe() []SubsystemDescription {
+	s.lock.RLock()
+	descriptions := make([]SubsystemDescription, 0, len(s.Subsystems))
+	for name, bs := range s.Subsystems {
+		descriptions = append(descriptions, SubsystemDescription{Name: name, State: bs.State(), Methods: bs.Methods()})
+	}
+	s.lock.RUnlock()
+	sort.Slice(descriptions, func(i, j int) bool {
+		return descriptions[i].Name < descriptions[j].Name
+	})
+	return descriptions
+}
+
+// argValue converts a method argument to a value of type t, if it is assignable to it.
+func argValue(arg any, t reflect.Type) (reflect.Value, bool) {
+	if arg == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(t), true
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	v := reflect.ValueOf(arg)
+	if !v.Type().AssignableTo(t) {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
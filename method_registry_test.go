@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"overseer/eventbus"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterReflection(t *testing.T) {
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "math", recorder: &recorder{}})
+	require.NoError(t, bs.Register("add", "Add adds two numbers.", func(ctx context.Context, a int, b int) (int, error) {
+		return a + b, nil
+	}))
+	require.NoError(t, bs.Register("length", "", func(ctx context.Context, values []int) (int, error) {
+		return len(values), nil
+	}))
+
+	result, err := bs.Call(context.Background(), "add", 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, 3, result)
+
+	result, err = bs.Call(context.Background(), "length", nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, result)
+
+	_, err = bs.Call(context.Background(), "add", 1)
+	require.ErrorIs(t, err, ErrInvalidArgs)
+	_, err = bs.Call(context.Background(), "add", 1, "2")
+	require.ErrorIs(t, err, ErrInvalidArgs)
+
+	info, ok := bs.Method("add")
+	require.True(t, ok)
+	require.Equal(t, []reflect.Type{reflect.TypeOf(0), reflect.TypeOf(0)}, info.Args)
+	require.Equal(t, reflect.TypeOf(0), info.Result)
+	require.Equal(t, "Add adds two numbers.", info.Description)
+}
+
+func TestRegisterRejectsInvalidFunctions(t *testing.T) {
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "math", recorder: &recorder{}})
+	for name, fn := range map[string]any{
+		"not a function":  42,
+		"nil":             nil,
+		"missing context": func(a int) (int, error) { return a, nil },
+		"missing error":   func(ctx context.Context) int { return 0 },
+		"variadic":        func(ctx context.Context, a ...int) (int, error) { return 0, nil },
+	} {
+		require.Error(t, bs.Register("m", "", fn), name)
+	}
+	require.Empty(t, bs.Methods())
+}
+
+func TestOverseerDescribe(t *testing.T) {
+	bus := eventbus.New()
+	ctx := context.Background()
+	overseer := NewOverseer(bus, NewSubsystem1(ctx, bus), NewSubsystem2(ctx, bus))
+
+	descriptions := overseer.Describe()
+	require.Len(t, descriptions, 2)
+	require.Equal(t, "subsystem1", descriptions[0].Name)
+	require.Equal(t, IdleState, descriptions[0].State)
+	require.Len(t, descriptions[0].Methods, 1)
+	require.Equal(t, "ping", descriptions[0].Methods[0].Name)
+	require.Equal(t, `Ping replies with "pong".`, descriptions[0].Methods[0].Description)
+
+	var names []string
+	for _, method := range descriptions[1].Methods {
+		names = append(names, method.Name)
+	}
+	require.Equal(t, []string{"ping", "ping_subsystem1", "process_active_leaves_update"}, names)
+
+	encoded, err := json.Marshal(descriptions[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"name": "subsystem1",
+		"state": "idle",
+		"methods": [{
+			"name": "ping",
+			"args": [{"name": "message", "type": "string"}],
+			"result": "string",
+			"description": "Ping replies with \"pong\"."
+		}]
+	}`, string(encoded))
+}
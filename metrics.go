@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// MetricsName is the name of the subsystem serving metrics, see NewMetricsServer.
+const MetricsName = "metrics"
+
+// MethodMetrics receives measurements of the method calls an overseer routes, see
+// Overseer.SetMetrics. Its methods are called concurrently, so they must be safe for concurrent
+// use and cheap.
+type MethodMetrics interface {
+	// MethodCalled records a call served by a subsystem, or rejected before it could be served, and
+	// the error it failed with, nil if it succeeded. The duration of rejected calls is zero.
+	MethodCalled(subsystem string, method string, duration time.Duration, err error)
+	// MethodPanicked counts a call that panicked, and was recovered by the overseer.
+	MethodPanicked(subsystem string, method string)
+	// RouteRetried counts a retry of the lookup of a subsystem that was not registered or running
+	// when a request for it arrived.
+	RouteRetried(subsystem string)
+}
+
+// noMetrics discards measurements.
+type noMetrics struct{}
+
+func (noMetrics) MethodCalled(string, string, time.Duration, error) {}
+func (noMetrics) MethodPanicked(string, string)                     {}
+func (noMetrics) RouteRetried(string)                               {}
+
+// SetMetrics reports the method calls the overseer routes to m, or to nobody if m is nil. The
+// event bus is instrumented separately, see eventbus.WithMetrics.
+func (s *Overseer) SetMetrics(m MethodMetrics) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.metrics = m
+}
+
+// methodMetrics returns the metrics set with SetMetrics.
+func (s *Overseer) methodMetrics() MethodMetrics {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.metrics == nil {
+		return noMetrics{}
+	}
+	return s.metrics
+}
+
+// MetricsServer is a subsystem serving metrics over HTTP at /metrics, for example those of a
+// PrometheusMetrics.
+type MetricsServer struct {
+	bs      *BaseSubsystem
+	handler http.Handler
+	http    httpServer
+}
+
+// NewMetricsServer returns a subsystem serving handler at /metrics on addr once started.
+func NewMetricsServer(handler http.Handler, addr string) *MetricsServer {
+	return &MetricsServer{handler: handler, http: httpServer{addr: addr}}
+}
+
+func (m *MetricsServer) Name() string {
+	return MetricsName
+}
+
+func (m *MetricsServer) SetBaseSubsystem(bs *BaseSubsystem) {
+	m.bs = bs
+}
+
+// OnStart starts listening.
+func (m *MetricsServer) OnStart() error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.handler)
+	return m.http.start(m.bs, mux)
+}
+
+// OnStop closes the listener and every connection.
+func (m *MetricsServer) OnStop() error {
+	return m.http.stop()
+}
+
+// Call serves no methods: metrics are only served over HTTP.
+func (m *MetricsServer) Call(ctx context.Context, method string, args ...any) (any, error) {
+	return nil, ErrMethodNotFound
+}
+
+// Addr returns the address metrics are served on, or nil if the server is not running.
+func (m *MetricsServer) Addr() net.Addr {
+	return m.http.Addr()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"overseer/eventbus"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMiddlewareErrors(t *testing.T) {
+	bus := eventbus.New()
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "store", recorder: &recorder{}})
+	bs.MustRegister("echo", "", func(ctx context.Context, s string) (string, error) {
+		return s, nil
+	})
+	overseer := NewOverseer(bus, bs)
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	errQuota := errors.New("quota exceeded")
+	remove, err := overseer.UseRequestMiddleware(func(methodRequest MethodRequest, next func(MethodRequest) error) error {
+		switch methodRequest.Caller {
+		case "greedy":
+			return errQuota
+		case "guest":
+			return ErrPermissionDenied
+		}
+		methodRequest.Data = []any{"rewritten"}
+		return next(methodRequest)
+	})
+	require.NoError(t, err)
+
+	resp := SubsystemMethod(bus, "test", "store", "echo", "hello")
+	require.NoError(t, resp.Error)
+	require.Equal(t, "rewritten", resp.Data)
+
+	resp = SubsystemMethod(bus, "greedy", "store", "echo", "hello")
+	require.ErrorIs(t, resp.Error, errQuota)
+	var methodErr *MethodError
+	require.True(t, errors.As(resp.Error, &methodErr))
+	require.Equal(t, CodeDomain, methodErr.Code)
+	require.Equal(t, "store", methodErr.Subsystem)
+
+	resp = SubsystemMethod(bus, "guest", "store", "echo", "hello")
+	require.ErrorIs(t, resp.Error, ErrPermissionDenied)
+
+	remove()
+	resp = SubsystemMethod(bus, "greedy", "store", "echo", "hello")
+	require.NoError(t, resp.Error)
+	require.Equal(t, "hello", resp.Data)
+}
+
+func TestResponseMiddlewareErrors(t *testing.T) {
+	bus := eventbus.New()
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "store", recorder: &recorder{}})
+	bs.MustRegister("secret", "", func(ctx context.Context) (string, error) {
+		return "s3cr3t", nil
+	})
+	overseer := NewOverseer(bus, bs)
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	errRedacted := errors.New("redacted")
+	_, err := bus.Use(func(topic string, data any, next eventbus.Next) error {
+		if resp, ok := data.(MethodResponse); ok && resp.Data == "s3cr3t" {
+			return errRedacted
+		}
+		return next(data)
+	})
+	require.NoError(t, err)
+
+	resp := SubsystemMethod(bus, "test", "store", "secret")
+	require.ErrorIs(t, resp.Error, errRedacted)
+	require.Nil(t, resp.Data)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// otlpServiceName is the service.name resource attribute of exported spans.
+const otlpServiceName = "overseer"
+
+// otlpQueueSize bounds the spans an OTLPFileExporter holds before they are written.
+const otlpQueueSize = 4096
+
+// OTLP span kind and status codes, see opentelemetry-proto.
+const (
+	otlpSpanKindServer  = 2
+	otlpStatusCodeUnset = 0
+	otlpStatusCodeError = 2
+)
+
+// OTLPFileExporter is a SpanExporter appending spans to a file in the OTLP JSON format: every line
+// holds an ExportTraceServiceRequest with a single span, as written by the file exporter of the
+// OpenTelemetry Collector, so the file can be loaded into tools reading OTLP for offline viewing.
+// Spans are queued and written by a goroutine of the exporter, so exporting them does not hold up
+// the calls they describe.
+type OTLPFileExporter struct {
+	spans  chan Span
+	lock   sync.RWMutex // guards closed, so that no span is queued once spans is closed
+	closed bool
+	done   chan struct{} // closed once the writer flushed and closed the file
+	err    error         // of flushing and closing the file, set before done is closed
+}
+
+// NewOTLPFileExporter returns an exporter appending spans to the file at path, which is created if
+// it does not exist.
+func NewOTLPFileExporter(path string) (*OTLPFileExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	e := &OTLPFileExporter{spans: make(chan Span, otlpQueueSize), done: make(chan struct{})}
+	go e.write(file)
+	return e, nil
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+func otlpAttribute(key string, value string) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	kv.Value.StringValue = value
+	return kv
+}
+
+// toOTLP converts span to the OTLP JSON encoding of a trace export request.
+func toOTLP(span Span) otlpTraces {
+	keys := make([]string, 0, len(span.Attributes))
+	for key := range span.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attributes := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		attributes = append(attributes, otlpAttribute(key, span.Attributes[key]))
+	}
+	status := otlpStatus{Code: otlpStatusCodeUnset}
+	if span.Err != nil {
+		status = otlpStatus{Code: otlpStatusCodeError, Message: span.Err.Error()}
+	}
+
+	var scope otlpScopeSpans
+	scope.Scope.Name = otlpServiceName
+	scope.Spans = []otlpSpan{{
+		TraceID:           span.TraceID,
+		SpanID:            span.SpanID,
+		ParentSpanID:      span.ParentSpanID,
+		Name:              span.Name,
+		Kind:              otlpSpanKindServer,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		Attributes:        attributes,
+		Status:            status,
+	}}
+	var resource otlpResourceSpans
+	resource.Resource.Attributes = []otlpKeyValue{otlpAttribute("service.name", otlpServiceName)}
+	resource.ScopeSpans = []otlpScopeSpans{scope}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{resource}}
+}
+
+// ExportSpan queues span to be appended to the file. Spans that do not fit in the queue or cannot
+// be written are logged and dropped.
+func (e *OTLPFileExporter) ExportSpan(span Span) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.spans <- span:
+	default:
+		logging.WithField("SpanID", span.SpanID).Warn("span queue is full, dropping span")
+	}
+}
+
+// write appends the queued spans to file, flushing whenever the queue runs empty, until the
+// exporter is closed.
+func (e *OTLPFileExporter) write(file *os.File) {
+	defer close(e.done)
+	w := bufio.NewWriter(file)
+	for span := range e.spans {
+		line, err := json.Marshal(toOTLP(span))
+		if err != nil {
+			logging.WithField("SpanID", span.SpanID).WithError(err).Warn("could not encode span")
+			continue
+		}
+		line = append(line, '\n')
+		if _, err := w.Write(line); err != nil {
+			logging.WithField("SpanID", span.SpanID).WithError(err).Warn("could not export span")
+			continue
+		}
+		if len(e.spans) == 0 {
+			if err := w.Flush(); err != nil {
+				logging.WithError(err).Warn("could not export spans")
+			}
+		}
+	}
+	e.err = errors.Join(w.Flush(), file.Close())
+}
+
+// Close writes the queued spans and closes the file. Spans exported afterwards are dropped.
+func (e *OTLPFileExporter) Close() error {
+	e.lock.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.spans)
+	}
+	e.lock.Unlock()
+	<-e.done
+	return e.err
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"math/big"
 	"overseer/eventbus"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/avast/retry-go"
 	logging "github.com/sirupsen/logrus"
@@ -14,20 +19,43 @@ import (
 
 const SECP256k1GeneratorOrder = "0xFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141"
 
+// MethodCancelTopic is the topic on which callers announce that they abandoned a method request.
+const MethodCancelTopic = "method:cancel"
+
+// cancelMarkerTTL bounds how long a cancellation waits for a request that never reached the overseer.
+const cancelMarkerTTL = time.Minute
+
+// maxRouteRetries bounds the requests for subsystems that are not running yet, for which the
+// overseer keeps retrying in a goroutine each. Requests beyond it fail right away.
+const maxRouteRetries = 1024
+
 type Overseer struct {
 	eventBus      eventbus.Bus
 	middlewareMap sync.Map
+	inflight      sync.Map     // request ID -> *inflightRequest, or the cancellation cause if the caller gave up first
+	routeRetries  atomic.Int64 // requests retrying to resolve their subsystem, at most maxRouteRetries
+	lock          sync.RWMutex // guards Subsystems, dependencies, supervisor, policy, metrics, spanExporter and cyclePolicy
+	dependencies  map[string][]string
+	supervisor    *Supervisor
+	policy        *AccessPolicy
+	metrics       MethodMetrics
+	spanExporter  SpanExporter
+	cyclePolicy   CyclePolicy
 	Subsystems    map[string]*BaseSubsystem
 }
 
 func NewOverseer(eventBus eventbus.Bus, baseSubsystems ...*BaseSubsystem) *Overseer {
 	overseer := &Overseer{
-		Subsystems: make(map[string]*BaseSubsystem),
+		dependencies: make(map[string][]string),
+		Subsystems:   make(map[string]*BaseSubsystem),
 	}
 	overseer.SetEventBus(eventBus)
 	overseer.SetupMethodRouting()
+	overseer.SetupMethodCancellation()
 	for _, baseSubsystem := range baseSubsystems {
-		overseer.RegisterSubsystem(baseSubsystem)
+		if err := overseer.RegisterSubsystem(baseSubsystem); err != nil {
+			logging.WithField("Subsystem", baseSubsystem.Name()).WithError(err).Error("could not register subsystem")
+		}
 	}
 	return overseer
 }
@@ -68,6 +96,21 @@ func (s *Overseer) AddResponseMiddleware(middleware *func(methodResponse MethodR
 	s.eventBus.AddMiddleware(&responseMiddleware)
 }
 
+// UseRequestMiddleware adds middleware for method requests to the event bus, and returns a function
+// removing it again. The middleware passes a request, or a modified one, on with next, or rejects
+// it by returning an error, which the caller receives as the error of its MethodResponse.
+func (s *Overseer) UseRequestMiddleware(middleware func(methodRequest MethodRequest, next func(MethodRequest) error) error, opts ...eventbus.MiddlewareOption) (func(), error) {
+	return s.eventBus.Use(func(topic string, data any, next eventbus.Next) error {
+		methodRequest, ok := data.(MethodRequest)
+		if !ok {
+			return next(data)
+		}
+		return middleware(methodRequest, func(methodRequest MethodRequest) error {
+			return next(methodRequest)
+		})
+	}, append(opts, eventbus.WithTopics("method"))...)
+}
+
 func (s *Overseer) RemoveRequestMiddleware(middleware *func(methodRequest MethodRequest) MethodRequest) {
 	requestMiddleware, ok := s.middlewareMap.Load(middleware)
 	if !ok {
@@ -90,99 +133,412 @@ func (s *Overseer) SetEventBus(e eventbus.Bus) {
 	s.eventBus = e
 }
 
-func (s *Overseer) RegisterSubsystem(bs *BaseSubsystem) {
+// EventBus returns the event bus the overseer routes method requests on.
+func (s *Overseer) EventBus() eventbus.Bus {
+	return s.eventBus
+}
+
+// RegisterSubsystem registers a subsystem with the overseer. If the subsystem implements
+// DependentSubsystem its dependencies are recorded as well, and the registration is rejected if
+// they would introduce a dependency cycle. Every state transition of a registered subsystem is
+// published on the "<subsystem>:state" topic.
+func (s *Overseer) RegisterSubsystem(bs *BaseSubsystem) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if dependent, ok := bs.impl.(DependentSubsystem); ok {
+		if err := s.addDependencies(bs.Name(), dependent.Dependencies()...); err != nil {
+			return err
+		}
+	}
+	bs.setFailureHandler(s.handleFailure)
+	bs.OnTransition(func(transition StateTransition) {
+		s.eventBus.Publish(fmt.Sprintf("%v:%v", transition.Subsystem, StateEvent), transition)
+	})
 	s.Subsystems[bs.Name()] = bs
+	return nil
+}
+
+// subsystem returns the registered subsystem with the given name.
+func (s *Overseer) subsystem(name string) (*BaseSubsystem, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	bs, ok := s.Subsystems[name]
+	return bs, ok
 }
 
 type MethodRequest struct {
-	Caller    string
-	Subsystem string
-	Method    string
-	ID        string
-	Data      []interface{}
+	Caller       string
+	Subsystem    string
+	Method       string
+	ID           string
+	Deadline     time.Time // zero if the caller has no deadline
+	TraceID      string    // the trace the call is part of, see SpanContext
+	SpanID       string    // the span of the call
+	ParentSpanID string    // the span the call was made in, empty for the root of a trace
+	ParentID     string    // the request served by the call that made this one, if any
+	Chain        []string  // the subsystems serving the calls this one was made by, outermost first
+	Data         []interface{}
+}
+
+// MethodCancel is published on MethodCancelTopic when a caller stops waiting for a request.
+type MethodCancel struct {
+	ID  string
+	Err error
 }
 
 func (s *Overseer) SetupMethodRouting() {
-	err := s.eventBus.SubscribeAsync("method", func(data interface{}) {
+	// Transactional, so that requests reach the mailbox of a subsystem in the order they were
+	// published, and on a blocking pool of its own, so that the overflow policy of the bus never
+	// drops a request.
+	_, err := s.eventBus.SubscribeAsync("method", func(data interface{}) {
 		methodRequest, ok := data.(MethodRequest)
 		if !ok {
 			logging.Error("could not parse data for query")
 			return
 		}
+		methodRequest = s.attributeCaller(methodRequest)
 
-		var baseSubsystem *BaseSubsystem
-		err := retry.Do(func() error {
-			bs, ok := s.Subsystems[methodRequest.Subsystem]
-			if !ok {
-				logging.WithField("Subsystem", methodRequest.Subsystem).Error("could not find subsystem")
-				return fmt.Errorf("could not find subsystem %v", methodRequest.Subsystem)
-			}
-			if !bs.IsRunning() {
-				logging.WithFields(logging.Fields{
-					"Subsystem": methodRequest.Subsystem,
-					"data":      data,
-				}).Error("Subsystem is not running")
-				return fmt.Errorf("subsystem %v is not running", methodRequest.Subsystem)
+		if !s.authorize(methodRequest) {
+			logging.WithFields(logging.Fields{
+				"Caller":    methodRequest.Caller,
+				"Subsystem": methodRequest.Subsystem,
+				"Method":    methodRequest.Method,
+			}).Warn("method request denied by access policy")
+			err := newMethodError(ErrPermissionDenied, methodRequest, "%v may not call %v.%v", methodRequest.Caller, methodRequest.Subsystem, methodRequest.Method)
+			s.callDone(methodRequest, time.Time{}, err)
+			s.respond(MethodResponse{
+				Request: methodRequest,
+				Error:   err,
+				Data:    nil,
+			})
+			return
+		}
+
+		baseSubsystem, err := s.resolve(methodRequest)
+		if err == nil {
+			s.dispatchRequest(baseSubsystem, methodRequest)
+			return
+		}
+		if s.routeRetries.Add(1) > maxRouteRetries {
+			s.routeRetries.Add(-1)
+			s.callDone(methodRequest, time.Time{}, err)
+			s.respond(MethodResponse{
+				Request: methodRequest,
+				Error:   err,
+				Data:    nil,
+			})
+			return
+		}
+		// the subsystem may be registered or started shortly, so retry without holding up other requests
+		go func() {
+			defer s.routeRetries.Add(-1)
+			var baseSubsystem *BaseSubsystem
+			err := retry.Do(func() (err error) {
+				baseSubsystem, err = s.resolve(methodRequest)
+				return err
+			}, retry.LastErrorOnly(true), retry.OnRetry(func(uint, error) {
+				s.methodMetrics().RouteRetried(methodRequest.Subsystem)
+			}))
+			if err != nil {
+				s.callDone(methodRequest, time.Time{}, err)
+				s.respond(MethodResponse{
+					Request: methodRequest,
+					Error:   err,
+					Data:    nil,
+				})
+				return
 			}
-			baseSubsystem = bs
-			return nil
+			s.dispatchRequest(baseSubsystem, methodRequest)
+		}()
+	}, true, eventbus.WithSubscriptionPool(1, 1, eventbus.OverflowBlock))
+	if err != nil {
+		logging.WithError(err).Error("could not subscribe async")
+	}
+}
+
+// resolve returns the running subsystem a request is addressed to.
+func (s *Overseer) resolve(methodRequest MethodRequest) (*BaseSubsystem, error) {
+	bs, ok := s.subsystem(methodRequest.Subsystem)
+	if !ok {
+		logging.WithFields(logging.Fields{
+			"Caller":    methodRequest.Caller,
+			"Subsystem": methodRequest.Subsystem,
+		}).Error("could not find subsystem")
+		return nil, newMethodError(ErrSubsystemNotFound, methodRequest, "could not find subsystem %v", methodRequest.Subsystem)
+	}
+	if !bs.IsRunning() {
+		logging.WithFields(logging.Fields{
+			"Caller":    methodRequest.Caller,
+			"Subsystem": methodRequest.Subsystem,
+			"data":      methodRequest,
+		}).Error("Subsystem is not running")
+		return nil, newMethodError(ErrSubsystemNotRunning, methodRequest, "subsystem %v is not running", methodRequest.Subsystem)
+	}
+	return bs, nil
+}
+
+// dispatchRequest queues a request on the mailbox of the subsystem it is addressed to, and
+// publishes the response once the subsystem served it.
+func (s *Overseer) dispatchRequest(baseSubsystem *BaseSubsystem, methodRequest MethodRequest) {
+	if err := s.checkCycle(baseSubsystem, methodRequest); err != nil {
+		s.callDone(methodRequest, time.Time{}, err)
+		s.respond(MethodResponse{
+			Request: methodRequest,
+			Error:   err,
+			Data:    nil,
 		})
-		if err != nil {
-			s.eventBus.Publish(methodRequest.ID, MethodResponse{
-				Error: err,
-				Data:  nil,
-			})
-		} else {
-			go func() {
-				defer func() {
-					if err := recover(); err != nil {
-						logging.WithFields(logging.Fields{
-							"Caller": methodRequest.Caller,
-							"Method": methodRequest.Method,
-							"data":   data,
-							"error":  err,
-						}).Error("panicked during baseSubsystem.Call")
-						resp := MethodResponse{
-							Error: fmt.Errorf("%v", err),
-							Data:  nil,
-						}
-						s.eventBus.Publish(methodRequest.ID, resp)
-					}
-				}()
-				data, err := baseSubsystem.Call(methodRequest.Method, methodRequest.Data...)
+		return
+	}
+	ctx, done, ok := s.beginRequest(methodRequest)
+	if !ok {
+		logging.WithField("ID", methodRequest.ID).Debug("method request cancelled before dispatch")
+		return
+	}
+	call := func() {
+		defer done()
+		start := time.Now()
+		s.markRunning(methodRequest.ID)
+		defer func() {
+			if err := recover(); err != nil {
+				s.methodMetrics().MethodPanicked(methodRequest.Subsystem, methodRequest.Method)
+				logging.WithFields(logging.Fields{
+					"Caller":  methodRequest.Caller,
+					"Method":  methodRequest.Method,
+					"TraceID": methodRequest.TraceID,
+					"SpanID":  methodRequest.SpanID,
+					"data":    methodRequest.Data,
+					"error":   err,
+				}).Error("panicked during baseSubsystem.Call")
 				resp := MethodResponse{
 					Request: methodRequest,
-					Error:   err,
-					Data:    data,
+					Error:   newMethodError(ErrPanicked, methodRequest, "panicked: %v", err),
+					Data:    nil,
 				}
-				s.eventBus.Publish(methodRequest.ID, resp)
-			}()
+				s.callDone(methodRequest, start, resp.Error)
+				s.respond(resp)
+				baseSubsystem.Fail(fmt.Errorf("panicked during call to %v: %v", methodRequest.Method, err))
+			}
+		}()
+		data, err := baseSubsystem.Call(ctx, methodRequest.Method, methodRequest.Data...)
+		if err != nil && ctx.Err() != nil {
+			// report calls that gave up on their context the same way as the caller would
+			methodErr := newMethodError(contextError(ctx.Err()), methodRequest, "")
+			methodErr.Cause = err
+			err = methodErr
+		} else if err != nil {
+			err = AsMethodError(err, methodRequest.Subsystem, methodRequest.Method, methodRequest.ID)
+		}
+		s.callDone(methodRequest, start, err)
+		resp := MethodResponse{
+			Request: methodRequest,
+			Error:   err,
+			Data:    data,
 		}
-	}, false)
+		s.respond(resp)
+	}
+	reject := func(err error) {
+		done()
+		var methodErr *MethodError
+		if errors.Is(err, ErrMailboxFull) {
+			methodErr = newMethodError(ErrMailboxFull, methodRequest, "mailbox of subsystem %v is full", methodRequest.Subsystem)
+		} else if errors.Is(err, errSignalPending) {
+			methodErr = newMethodError(ErrCallCycle, methodRequest, "call cycle would deadlock: %v has a signal pending", methodRequest.Subsystem)
+		} else {
+			methodErr = newMethodError(ErrSubsystemNotRunning, methodRequest, "subsystem %v is not running", methodRequest.Subsystem)
+			methodErr.Cause = err
+		}
+		s.callDone(methodRequest, time.Time{}, methodErr)
+		s.respond(MethodResponse{
+			Request: methodRequest,
+			Error:   methodErr,
+			Data:    nil,
+		})
+	}
+	cycle := slices.Contains(methodRequest.Chain, methodRequest.Subsystem)
+	if err := baseSubsystem.enqueue(envelope{run: call, reject: reject, cycle: cycle}); err != nil {
+		reject(err)
+	}
+}
+
+// callDone reports a request served since start, or rejected if start is zero, to the metrics and
+// the span exporter of the overseer.
+func (s *Overseer) callDone(methodRequest MethodRequest, start time.Time, err error) {
+	var duration time.Duration
+	if !start.IsZero() {
+		duration = time.Since(start)
+	}
+	s.methodMetrics().MethodCalled(methodRequest.Subsystem, methodRequest.Method, duration, err)
+	s.exportSpan(methodRequest, start, err)
+}
+
+// respond publishes resp to the caller awaiting it. If middleware rejects the response, the caller
+// receives the error instead.
+func (s *Overseer) respond(resp MethodResponse) {
+	methodRequest := resp.Request
+	err := s.eventBus.Publish(methodRequest.ID, resp)
+	if err == nil {
+		return
+	}
+	logging.WithField("ID", methodRequest.ID).WithError(err).Warn("method response rejected")
+	err = s.eventBus.Publish(methodRequest.ID, MethodResponse{
+		Request: methodRequest,
+		Error:   AsMethodError(err, methodRequest.Subsystem, methodRequest.Method, methodRequest.ID),
+		Data:    nil,
+	})
 	if err != nil {
-		logging.WithError(err).Error("could not subscribe async")
+		logging.WithField("ID", methodRequest.ID).WithError(err).Error("could not publish method response")
+	}
+}
+
+// SetupMethodCancellation cancels the context of in-flight requests whose callers gave up on them.
+// The handler does not block, so it runs synchronously, where no worker pool can drop the event.
+func (s *Overseer) SetupMethodCancellation() {
+	_, err := s.eventBus.Subscribe(MethodCancelTopic, func(data interface{}) {
+		methodCancel, ok := data.(MethodCancel)
+		if !ok {
+			logging.Error("could not parse data for method cancellation")
+			return
+		}
+		cause := methodCancel.Err
+		if cause == nil {
+			cause = ErrMethodCancelled
+		}
+		// The cancellation may overtake the request itself, in which case the marker
+		// stops beginRequest from dispatching it at all.
+		entry, loaded := s.inflight.LoadOrStore(methodCancel.ID, cause)
+		if !loaded {
+			time.AfterFunc(cancelMarkerTTL, func() {
+				s.inflight.CompareAndDelete(methodCancel.ID, cause)
+			})
+			return
+		}
+		if inflight, ok := entry.(*inflightRequest); ok {
+			inflight.cancel(cause)
+		}
+	})
+	if err != nil {
+		logging.WithError(err).Error("could not subscribe")
 	}
 }
 
+// beginRequest derives the context handed to Subsystem.Call for a request and records it as
+// in-flight. The context carries the request, see RequestFromContext. It returns false if the
+// caller already cancelled the request.
+func (s *Overseer) beginRequest(methodRequest MethodRequest) (context.Context, func(), bool) {
+	ctx, cancel := context.WithCancelCause(withRequest(context.Background(), methodRequest))
+	if !methodRequest.Deadline.IsZero() {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadline(ctx, methodRequest.Deadline)
+		cancelParent := cancel
+		cancel = func(cause error) {
+			cancelParent(cause)
+			cancelDeadline()
+		}
+	}
+	inflight := &inflightRequest{request: methodRequest, started: time.Now(), cancel: cancel}
+	if _, loaded := s.inflight.LoadOrStore(methodRequest.ID, inflight); loaded {
+		s.inflight.Delete(methodRequest.ID)
+		cancel(ErrMethodCancelled)
+		return nil, nil, false
+	}
+	return ctx, func() {
+		s.inflight.Delete(methodRequest.ID)
+		cancel(nil)
+	}, true
+}
+
+// inflightRequest is a request dispatched to a subsystem that has not been answered yet.
+type inflightRequest struct {
+	request MethodRequest
+	started time.Time
+	running atomic.Bool // whether the subsystem took the request from its mailbox
+	cancel  context.CancelCauseFunc
+}
+
+// markRunning records that the subsystem started serving the request with the given ID.
+func (s *Overseer) markRunning(id string) {
+	if entry, ok := s.inflight.Load(id); ok {
+		if inflight, ok := entry.(*inflightRequest); ok {
+			inflight.running.Store(true)
+		}
+	}
+}
+
+// InflightRequest describes a method request a subsystem is serving.
+type InflightRequest struct {
+	ID        string    `json:"id"`
+	Caller    string    `json:"caller"`
+	Subsystem string    `json:"subsystem"`
+	Method    string    `json:"method"`
+	Started   time.Time `json:"started"`
+	Deadline  time.Time `json:"deadline,omitempty"`  // zero if the caller has no deadline
+	ParentID  string    `json:"parent_id,omitempty"` // the request served by the call that made this one
+	Running   bool      `json:"running"`             // false while queued in the mailbox of the subsystem
+}
+
+// Inflight returns the method requests dispatched to subsystems and not answered yet, oldest first.
+func (s *Overseer) Inflight() []InflightRequest {
+	requests := make([]InflightRequest, 0)
+	s.inflight.Range(func(_, entry any) bool {
+		if inflight, ok := entry.(*inflightRequest); ok {
+			req := inflight.request
+			requests = append(requests, InflightRequest{
+				ID:        req.ID,
+				Caller:    req.Caller,
+				Subsystem: req.Subsystem,
+				Method:    req.Method,
+				Started:   inflight.started,
+				Deadline:  req.Deadline,
+				ParentID:  req.ParentID,
+				Running:   inflight.running.Load(),
+			})
+		}
+		return true
+	})
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Started.Before(requests[j].Started)
+	})
+	return requests
+}
+
 type MethodResponse struct {
 	Request MethodRequest
 	Error   error
 	Data    interface{}
 }
 
-func AwaitTopic(eventBus eventbus.Bus, topic string) <-chan interface{} {
-	responseCh := make(chan interface{})
-	err := eventBus.SubscribeOnceAsync(topic, func(res interface{}) {
+// AwaitTopic returns a channel receiving the first event published on topic. The subscription
+// ends with that event or once ctx is done, and may be ended earlier through the returned handle.
+func AwaitTopic(ctx context.Context, eventBus eventbus.Bus, topic string) (<-chan interface{}, eventbus.Subscription, error) {
+	// Buffered so that the handler never blocks, which lets it run synchronously, where no worker
+	// pool can drop the response.
+	responseCh := make(chan interface{}, 1)
+	sub, err := eventBus.SubscribeOnce(topic, func(res interface{}) {
 		responseCh <- res
 		close(responseCh)
-	})
+	}, eventbus.WithContext(ctx))
 	if err != nil {
-		logging.WithError(err).Error("could not subscribe async")
+		return nil, nil, err
 	}
-	return responseCh
+	return responseCh, sub, nil
 }
 
 func SubsystemMethod(eventBus eventbus.Bus, caller string, subsystem string, method string, data ...interface{}) MethodResponse {
+	return SubsystemMethodCtx(context.Background(), eventBus, caller, subsystem, method, data...)
+}
+
+// SubsystemMethodCtx calls a method on a subsystem and waits for the response until ctx is done.
+// The deadline of ctx is forwarded to the callee, and cancelling ctx cancels the context passed
+// to Subsystem.Call. A failed call returns a *MethodError, and an abandoned call one matching
+// ErrMethodTimeout or ErrMethodCancelled.
+func SubsystemMethodCtx(ctx context.Context, eventBus eventbus.Bus, caller string, subsystem string, method string, data ...interface{}) MethodResponse {
+	if err := ctx.Err(); err != nil {
+		return MethodResponse{
+			Error: newMethodError(contextError(err), MethodRequest{Subsystem: subsystem, Method: method}, ""),
+			Data:  nil,
+		}
+	}
+
 	generatorOrder := new(big.Int)
 	_, ok := generatorOrder.SetString(SECP256k1GeneratorOrder, 0)
 	if !ok {
@@ -199,16 +555,63 @@ func SubsystemMethod(eventBus eventbus.Bus, caller string, subsystem string, met
 			Data:  nil,
 		}
 	}
-	nonceStr := nonce.Text(16)
-	responseCh := AwaitTopic(eventBus, nonceStr)
-	eventBus.Publish("method", MethodRequest{
+	return SubsystemRequest(ctx, eventBus, MethodRequest{
 		Caller:    caller,
 		Subsystem: subsystem,
 		Method:    method,
-		ID:        nonceStr,
+		ID:        nonce.Text(16),
 		Data:      data,
 	})
-	methodResponseInter := <-responseCh
+}
+
+// SubsystemRequest publishes a prepared method request and waits for its response until ctx is
+// done, like SubsystemMethodCtx. The ID of the request names the topic of its response, so it
+// must be unique among the requests in flight on the bus. If the request has no deadline, it gets
+// the deadline of ctx, and if it has no span, a child of the span of ctx, see SpanFromContext. Made
+// with the ctx of a call, it joins the chain of that call, see Overseer.SetCyclePolicy.
+func SubsystemRequest(ctx context.Context, eventBus eventbus.Bus, methodRequest MethodRequest) MethodResponse {
+	if err := ctx.Err(); err != nil {
+		return MethodResponse{
+			Request: methodRequest,
+			Error:   newMethodError(contextError(err), methodRequest, ""),
+			Data:    nil,
+		}
+	}
+	methodRequest = startSpan(ctx, methodRequest)
+	methodRequest = joinChain(ctx, methodRequest)
+	responseCh, sub, err := AwaitTopic(ctx, eventBus, methodRequest.ID)
+	if err != nil {
+		return MethodResponse{
+			Request: methodRequest,
+			Error:   fmt.Errorf("could not await response: %w", err),
+			Data:    nil,
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && methodRequest.Deadline.IsZero() {
+		methodRequest.Deadline = deadline
+	}
+	if err := eventBus.Publish("method", methodRequest); err != nil {
+		sub.Unsubscribe()
+		return MethodResponse{
+			Request: methodRequest,
+			Error:   AsMethodError(err, methodRequest.Subsystem, methodRequest.Method, methodRequest.ID),
+			Data:    nil,
+		}
+	}
+
+	var methodResponseInter interface{}
+	select {
+	case methodResponseInter = <-responseCh:
+	case <-ctx.Done():
+		err := contextError(ctx.Err())
+		sub.Unsubscribe()
+		eventBus.Publish(MethodCancelTopic, MethodCancel{ID: methodRequest.ID, Err: err})
+		return MethodResponse{
+			Request: methodRequest,
+			Error:   newMethodError(err, methodRequest, ""),
+			Data:    nil,
+		}
+	}
 	methodResponse, ok := methodResponseInter.(MethodResponse)
 	if !ok {
 		return MethodResponse{
@@ -219,6 +622,14 @@ func SubsystemMethod(eventBus eventbus.Bus, caller string, subsystem string, met
 	return methodResponse
 }
 
+// contextError maps a context error onto ErrMethodTimeout or ErrMethodCancelled.
+func contextError(err error) *MethodError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrMethodTimeout
+	}
+	return ErrMethodCancelled
+}
+
 func EmptyHandler(name string) func() {
 	return func() {
 		logging.WithField("name", name).Error("handler was not initialized")
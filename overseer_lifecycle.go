@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// ErrDependencyCycle is returned when declared dependencies would form a cycle.
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// AddDependency declares that the subsystem name depends on the subsystems in dependsOn, so that
+// StartAll starts them first and StopAll stops them last. The dependencies do not have to be
+// registered yet, but they must be by the time StartAll is called.
+func (s *Overseer) AddDependency(name string, dependsOn ...string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addDependencies(name, dependsOn...)
+}
+
+// addDependencies records dependencies unless they introduce a cycle. s.lock must be held.
+func (s *Overseer) addDependencies(name string, dependsOn ...string) error {
+	previous := s.dependencies[name]
+	merged := append([]string(nil), previous...)
+	for _, dependency := range dependsOn {
+		if !slices.Contains(merged, dependency) {
+			merged = append(merged, dependency)
+		}
+	}
+	s.dependencies[name] = merged
+	if cycle := s.findCycle(name); cycle != nil {
+		s.dependencies[name] = previous
+		if previous == nil {
+			delete(s.dependencies, name)
+		}
+		return fmt.Errorf("%w: %v", ErrDependencyCycle, strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// findCycle returns the dependency path leading from name back to itself, if there is one.
+func (s *Overseer) findCycle(name string) []string {
+	visited := make(map[string]bool)
+	var visit func(current string, path []string) []string
+	visit = func(current string, path []string) []string {
+		path = append(path, current)
+		for _, dependency := range s.dependencies[current] {
+			if dependency == name {
+				return append(path, dependency)
+			}
+			if visited[dependency] {
+				continue
+			}
+			visited[dependency] = true
+			if cycle := visit(dependency, path); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return visit(name, nil)
+}
+
+// startOrder returns the registered subsystems sorted so that every subsystem comes after its
+// dependencies. Subsystems without an ordering constraint between them are sorted by name.
+func (s *Overseer) startOrder() ([]*BaseSubsystem, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	pending := make(map[string]int, len(s.Subsystems))
+	dependents := make(map[string][]string)
+	for name := range s.Subsystems {
+		for _, dependency := range s.dependencies[name] {
+			if _, ok := s.Subsystems[dependency]; !ok {
+				return nil, fmt.Errorf("subsystem %v depends on unregistered subsystem %v", name, dependency)
+			}
+			dependents[dependency] = append(dependents[dependency], name)
+		}
+		pending[name] = len(s.dependencies[name])
+	}
+
+	var ready []string
+	for name, count := range pending {
+		if count == 0 {
+			ready = append(ready, name)
+		}
+	}
+	order := make([]*BaseSubsystem, 0, len(s.Subsystems))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, s.Subsystems[name])
+		for _, dependent := range dependents[name] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(order) != len(s.Subsystems) {
+		// unreachable as long as cycles are rejected on registration
+		return nil, ErrDependencyCycle
+	}
+	return order, nil
+}
+
+// StartAll starts every registered subsystem that is not running yet, dependencies first, also if it
+// was stopped before, for example by StopAll. If a
+// subsystem fails to start, the subsystems started by this call are stopped again in reverse order
+// and the start error is returned together with any error encountered during the rollback.
+func (s *Overseer) StartAll(ctx context.Context) error {
+	order, err := s.startOrder()
+	if err != nil {
+		return err
+	}
+
+	var started []*BaseSubsystem
+	for _, bs := range order {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if bs.IsRunning() {
+			continue
+		}
+		ok, startErr := startOrRestart(bs)
+		if startErr == nil && !ok {
+			startErr = fmt.Errorf("subsystem is %v", bs.State())
+		}
+		if startErr != nil {
+			err = fmt.Errorf("could not start subsystem %v: %w", bs.Name(), startErr)
+			break
+		}
+		started = append(started, bs)
+	}
+	if err == nil {
+		return nil
+	}
+
+	errs := []error{err}
+	for i := len(started) - 1; i >= 0; i-- {
+		logging.WithField("Subsystem", started[i].Name()).Info("rolling back subsystem start")
+		if _, stopErr := started[i].stop(); stopErr != nil {
+			errs = append(errs, fmt.Errorf("could not stop subsystem %v: %w", started[i].Name(), stopErr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StopAll stops every running subsystem in the reverse of the start order, so that a subsystem is
+// stopped before the subsystems it depends on. Restarts scheduled by the supervisor are abandoned,
+// and Conclude is broadcast before the first subsystem is stopped. It returns the errors reported by
+// OnSignal and OnStop, joined.
+func (s *Overseer) StopAll(ctx context.Context) error {
+	order, err := s.startOrder()
+	if err != nil {
+		return err
+	}
+	s.lock.RLock()
+	supervisor := s.supervisor
+	s.lock.RUnlock()
+	if supervisor != nil {
+		supervisor.cancelPending()
+	}
+
+	var errs []error
+	if err := s.BroadcastSignal(ctx, Conclude{}); err != nil {
+		errs = append(errs, err)
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		bs := order[i]
+		if !bs.IsRunning() {
+			continue
+		}
+		if _, err := bs.stop(); err != nil {
+			errs = append(errs, fmt.Errorf("could not stop subsystem %v: %w", bs.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StartSubsystem starts the registered subsystem name unless it is running, also if it was stopped
+// before. Unlike StartAll, it does not start the subsystems it depends on.
+func (s *Overseer) StartSubsystem(name string) error {
+	bs, ok := s.subsystem(name)
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrSubsystemNotFound, name)
+	}
+	switch bs.State() {
+	case StartingState, RunningState:
+		return nil
+	}
+	started, err := startOrRestart(bs)
+	if err == nil && !started {
+		err = fmt.Errorf("subsystem is %v", bs.State())
+	}
+	if err != nil {
+		return fmt.Errorf("could not start subsystem %v: %w", name, err)
+	}
+	return nil
+}
+
+// startOrRestart starts bs, which a BaseSubsystem only does from IdleState, so a stopped subsystem
+// is restarted instead.
+func startOrRestart(bs *BaseSubsystem) (bool, error) {
+	if bs.State() == StoppedState {
+		return bs.restart()
+	}
+	return bs.Start()
+}
+
+// StopSubsystem stops the registered subsystem name, and returns the error reported by its OnStop.
+// Unlike StopAll, it does not stop the subsystems depending on it.
+func (s *Overseer) StopSubsystem(name string) error {
+	bs, ok := s.subsystem(name)
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrSubsystemNotFound, name)
+	}
+	if _, err := bs.stop(); err != nil {
+		return fmt.Errorf("could not stop subsystem %v: %w", name, err)
+	}
+	return nil
+}
+
+// RestartSubsystem stops the registered subsystem name, unless it is stopped already, and starts it
+// again.
+func (s *Overseer) RestartSubsystem(name string) error {
+	bs, ok := s.subsystem(name)
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrSubsystemNotFound, name)
+	}
+	if _, err := bs.restart(); err != nil {
+		return fmt.Errorf("could not restart subsystem %v: %w", name, err)
+	}
+	return nil
+}
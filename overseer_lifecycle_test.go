@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"overseer/eventbus"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recorder collects lifecycle calls of several test subsystems in order.
+type recorder struct {
+	sync.Mutex
+	calls []string
+}
+
+func (r *recorder) record(call string) {
+	r.Lock()
+	defer r.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) Calls() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+// recordingSubsystem records OnStart and OnStop calls and fails OnStart if startErr is set.
+type recordingSubsystem struct {
+	bs       *BaseSubsystem
+	name     string
+	deps     []string
+	startErr error
+	recorder *recorder
+}
+
+func (r *recordingSubsystem) Name() string {
+	return r.name
+}
+
+func (r *recordingSubsystem) Dependencies() []string {
+	return r.deps
+}
+
+func (r *recordingSubsystem) OnStart() error {
+	if r.startErr != nil {
+		return r.startErr
+	}
+	r.recorder.record("start:" + r.name)
+	return nil
+}
+
+func (r *recordingSubsystem) OnStop() error {
+	r.recorder.record("stop:" + r.name)
+	return nil
+}
+
+func (r *recordingSubsystem) Call(ctx context.Context, method string, args ...any) (any, error) {
+	if method == "panic" {
+		panic("recordingSubsystem panicked")
+	}
+	return r.name, nil
+}
+
+func (r *recordingSubsystem) SetBaseSubsystem(bs *BaseSubsystem) {
+	r.bs = bs
+}
+
+func TestStartAllDependencyOrder(t *testing.T) {
+	rec := &recorder{}
+	overseer := NewOverseer(eventbus.New(),
+		NewBaseSubsystem(&recordingSubsystem{name: "c", deps: []string{"b"}, recorder: rec}),
+		NewBaseSubsystem(&recordingSubsystem{name: "a", deps: []string{"b"}, recorder: rec}),
+		NewBaseSubsystem(&recordingSubsystem{name: "b", recorder: rec}),
+	)
+
+	require.NoError(t, overseer.StartAll(context.Background()))
+	require.NoError(t, overseer.StopAll(context.Background()))
+	require.NoError(t, overseer.StartAll(context.Background()))
+	require.NoError(t, overseer.StopAll(context.Background()))
+	require.Equal(t, []string{
+		"start:b", "start:a", "start:c",
+		"stop:c", "stop:a", "stop:b",
+		"start:b", "start:a", "start:c",
+		"stop:c", "stop:a", "stop:b",
+	}, rec.Calls())
+}
+
+func TestStartAllRollback(t *testing.T) {
+	rec := &recorder{}
+	startErr := errors.New("boom")
+	overseer := NewOverseer(eventbus.New(),
+		NewBaseSubsystem(&recordingSubsystem{name: "a", recorder: rec}),
+		NewBaseSubsystem(&recordingSubsystem{name: "b", deps: []string{"a"}, recorder: rec}),
+		NewBaseSubsystem(&recordingSubsystem{name: "c", deps: []string{"b"}, startErr: startErr, recorder: rec}),
+	)
+
+	err := overseer.StartAll(context.Background())
+	require.ErrorIs(t, err, startErr)
+	require.Equal(t, []string{"start:a", "start:b", "stop:b", "stop:a"}, rec.Calls())
+	for _, bs := range overseer.Subsystems {
+		require.False(t, bs.IsRunning())
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	rec := &recorder{}
+	overseer := NewOverseer(eventbus.New(),
+		NewBaseSubsystem(&recordingSubsystem{name: "a", deps: []string{"b"}, recorder: rec}),
+		NewBaseSubsystem(&recordingSubsystem{name: "b", recorder: rec}),
+	)
+
+	err := overseer.AddDependency("b", "a")
+	require.ErrorIs(t, err, ErrDependencyCycle)
+
+	err = overseer.RegisterSubsystem(NewBaseSubsystem(&recordingSubsystem{name: "c", deps: []string{"c"}, recorder: rec}))
+	require.ErrorIs(t, err, ErrDependencyCycle)
+	require.NotContains(t, overseer.Subsystems, "c")
+
+	require.NoError(t, overseer.StartAll(context.Background()))
+}
+
+func TestStartAllMissingDependency(t *testing.T) {
+	overseer := NewOverseer(eventbus.New(),
+		NewBaseSubsystem(&recordingSubsystem{name: "a", deps: []string{"missing"}, recorder: &recorder{}}),
+	)
+	require.Error(t, overseer.StartAll(context.Background()))
+}
+
+func TestStartStopSubsystem(t *testing.T) {
+	rec := &recorder{}
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "a", recorder: rec})
+	overseer := NewOverseer(eventbus.New(), bs)
+
+	require.NoError(t, overseer.StartSubsystem("a"))
+	require.NoError(t, overseer.StartSubsystem("a"))
+	require.NoError(t, overseer.StopSubsystem("a"))
+	require.Equal(t, StoppedState, bs.State())
+	require.NoError(t, overseer.StartSubsystem("a"))
+	require.True(t, bs.IsRunning())
+	require.NoError(t, overseer.RestartSubsystem("a"))
+	require.True(t, bs.IsRunning())
+	require.Equal(t, []string{"start:a", "stop:a", "start:a", "stop:a", "start:a"}, rec.Calls())
+
+	require.ErrorIs(t, overseer.StartSubsystem("missing"), ErrSubsystemNotFound)
+	require.ErrorIs(t, overseer.StopSubsystem("missing"), ErrSubsystemNotFound)
+	require.ErrorIs(t, overseer.RestartSubsystem("missing"), ErrSubsystemNotFound)
+}
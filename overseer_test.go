@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"overseer/eventbus"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSubsystem blocks every call until the caller's context is done.
+type blockingSubsystem struct {
+	bs        *BaseSubsystem
+	cancelled chan error
+}
+
+func (b *blockingSubsystem) Name() string {
+	return "blocking"
+}
+
+func (b *blockingSubsystem) OnStart() error {
+	return nil
+}
+
+func (b *blockingSubsystem) OnStop() error {
+	return nil
+}
+
+func (b *blockingSubsystem) Call(ctx context.Context, method string, args ...any) (any, error) {
+	<-ctx.Done()
+	b.cancelled <- context.Cause(ctx)
+	return nil, ctx.Err()
+}
+
+func (b *blockingSubsystem) SetBaseSubsystem(bs *BaseSubsystem) {
+	b.bs = bs
+}
+
+func TestSubsystemMethodCtxTimeout(t *testing.T) {
+	bus := eventbus.New()
+	blocking := &blockingSubsystem{cancelled: make(chan error, 1)}
+	bs := NewBaseSubsystem(blocking)
+	NewOverseer(bus, bs)
+	_, err := bs.Start()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp := SubsystemMethodCtx(ctx, bus, "test", "blocking", "wait")
+	require.ErrorIs(t, resp.Error, ErrMethodTimeout)
+
+	var methodErr *MethodError
+	require.True(t, errors.As(resp.Error, &methodErr))
+	require.Equal(t, CodeTimeout, methodErr.Code)
+	require.Equal(t, "blocking", methodErr.Subsystem)
+	require.False(t, bus.HasCallback(methodErr.RequestID), "response topic should be unsubscribed")
+
+	select {
+	case <-blocking.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("callee context was not cancelled")
+	}
+}
+
+func TestSubsystemMethodCtxCancel(t *testing.T) {
+	bus := eventbus.New()
+	blocking := &blockingSubsystem{cancelled: make(chan error, 1)}
+	bs := NewBaseSubsystem(blocking)
+	NewOverseer(bus, bs)
+	_, err := bs.Start()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	resp := SubsystemMethodCtx(ctx, bus, "test", "blocking", "wait")
+	require.ErrorIs(t, resp.Error, ErrMethodCancelled)
+
+	select {
+	case cause := <-blocking.cancelled:
+		require.ErrorIs(t, cause, ErrMethodCancelled)
+	case <-time.After(time.Second):
+		t.Fatal("callee context was not cancelled")
+	}
+}
+
+func TestSubsystemMethodOnWorkerPool(t *testing.T) {
+	// requests and responses must get through whatever the overflow policy of the bus
+	for _, policy := range []eventbus.OverflowPolicy{eventbus.OverflowBlock, eventbus.OverflowDropNewest, eventbus.OverflowDropOldest, eventbus.OverflowError} {
+		t.Run(policy.String(), func(t *testing.T) {
+			bus := eventbus.New(eventbus.WithWorkerPool(1, 1, policy))
+			overseer := NewOverseer(bus, NewBaseSubsystem(&recordingSubsystem{name: "a", recorder: &recorder{}}))
+			require.NoError(t, overseer.StartAll(context.Background()))
+			defer overseer.StopAll(context.Background())
+
+			// occupy the worker and the queue of the bus
+			busy, release := make(chan struct{}, 2), make(chan struct{})
+			defer close(release)
+			_, err := bus.SubscribeAsync("busy", func(any) {
+				busy <- struct{}{}
+				<-release
+			}, false)
+			require.NoError(t, err)
+			require.NoError(t, bus.Publish("busy", 1))
+			<-busy
+			require.NoError(t, bus.Publish("busy", 2))
+
+			var wg sync.WaitGroup
+			for i := 0; i < 32; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					resp := SubsystemMethodCtx(ctx, bus, "test", "a", "ping")
+					require.NoError(t, resp.Error)
+					require.Equal(t, "a", resp.Data)
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestSubsystemMethodAcrossProcesses(t *testing.T) {
+	server, err := eventbus.NewServer(eventbus.New())
+	require.NoError(t, err)
+	address := filepath.Join(t.TempDir(), "bus.sock")
+	l, err := net.Listen("unix", address)
+	require.NoError(t, err)
+	go server.Serve(l)
+	defer server.Close()
+
+	// the subsystem and its caller each talk to the bus through a connection of their own, as
+	// they would from separate processes
+	subsystemBus, err := eventbus.Dial("unix", address)
+	require.NoError(t, err)
+	defer subsystemBus.Close()
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "isolated", recorder: &recorder{}})
+	bs.MustRegister("fail", "", func(ctx context.Context) (any, error) {
+		return nil, ErrInvalidArgs
+	})
+	overseer := NewOverseer(subsystemBus, bs)
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	callerBus, err := eventbus.Dial("unix", address)
+	require.NoError(t, err)
+	defer callerBus.Close()
+	resp := SubsystemMethod(callerBus, "test", "isolated", "ping")
+	require.NoError(t, resp.Error)
+	require.Equal(t, "isolated", resp.Data)
+
+	resp = SubsystemMethod(callerBus, "test", "isolated", "fail")
+	require.ErrorIs(t, resp.Error, ErrInvalidArgs)
+	var methodErr *MethodError
+	require.True(t, errors.As(resp.Error, &methodErr))
+	require.Equal(t, "isolated", methodErr.Subsystem)
+}
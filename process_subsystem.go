@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// processStopTimeout bounds how long OnStop waits for a child process to exit after its stdin was
+// closed before killing it.
+const processStopTimeout = 5 * time.Second
+
+// processMessage is sent to a child process serving a subsystem: a method request, or the
+// cancellation of one.
+type processMessage struct {
+	Request *MethodRequest
+	Cancel  *MethodCancel
+}
+
+// ProcessSubsystem is a Subsystem running in a child process, which serves it with ServeSubsystem.
+// Method calls are written to the stdin of the process and the responses read from its stdout,
+// encoded with encoding/gob, so method arguments and results of other than the basic types must
+// be registered with gob.Register in both processes. If the process exits while the subsystem is
+// running, the subsystem fails, so that a supervisor can restart it in a new process.
+type ProcessSubsystem struct {
+	name    string
+	command func() *exec.Cmd
+	base    *BaseSubsystem
+	nextID  atomic.Uint64 // numbers the calls made without a MethodRequest
+
+	lock sync.Mutex // guards run
+	run  *processRun
+}
+
+// processRun is a child process started by a ProcessSubsystem.
+type processRun struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	writeLock sync.Mutex // guards enc
+	enc       *gob.Encoder
+	lock      sync.Mutex // guards pending and stopping
+	pending   map[string]chan MethodResponse
+	stopping  bool
+	exited    chan struct{}
+	err       error // why the process exited, set before exited is closed
+}
+
+// NewProcessSubsystem returns a subsystem named name served by the process command returns. The
+// command is called for every start of the subsystem; the process must not write to its stdout
+// other than through ServeSubsystem, and inherits the stderr of the overseer unless the command
+// sets one.
+func NewProcessSubsystem(name string, command func() *exec.Cmd) *ProcessSubsystem {
+	return &ProcessSubsystem{name: name, command: command}
+}
+
+func (p *ProcessSubsystem) Name() string {
+	return p.name
+}
+
+func (p *ProcessSubsystem) SetBaseSubsystem(bs *BaseSubsystem) {
+	p.base = bs
+}
+
+// OnStart starts the process.
+func (p *ProcessSubsystem) OnStart() error {
+	cmd := p.command()
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start process of subsystem %v: %w", p.name, err)
+	}
+	run := &processRun{
+		cmd:     cmd,
+		stdin:   stdin,
+		enc:     gob.NewEncoder(stdin),
+		pending: make(map[string]chan MethodResponse),
+		exited:  make(chan struct{}),
+	}
+	p.lock.Lock()
+	p.run = run
+	p.lock.Unlock()
+	logging.WithFields(logging.Fields{"Subsystem": p.name, "pid": cmd.Process.Pid}).Info("started subsystem process")
+	go p.read(run, stdout)
+	return nil
+}
+
+// read delivers the responses of the process until it exits, and fails the subsystem if it was
+// not asked to stop. A response that cannot be read leaves the rest of stdout unreadable, so the
+// process is killed, failing the calls in progress with the error.
+func (p *ProcessSubsystem) read(run *processRun, stdout io.Reader) {
+	dec := gob.NewDecoder(stdout)
+	var readErr error
+	for {
+		var resp MethodResponse
+		if err := dec.Decode(&resp); err != nil {
+			if !errors.Is(err, io.EOF) {
+				readErr = fmt.Errorf("could not read response: %w", err)
+				_ = run.cmd.Process.Kill()
+			}
+			break
+		}
+		run.lock.Lock()
+		ch, ok := run.pending[resp.Request.ID]
+		delete(run.pending, resp.Request.ID)
+		run.lock.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+	// Wait closes stdout, so it must only be called once reading it is done
+	err := run.cmd.Wait()
+	switch {
+	case readErr != nil:
+		err = readErr
+	case err == nil:
+		err = errors.New("exited")
+	}
+	run.err = fmt.Errorf("process %d of subsystem %v: %w", run.cmd.Process.Pid, p.name, err)
+	run.lock.Lock()
+	stopping := run.stopping
+	run.lock.Unlock()
+	close(run.exited)
+	if !stopping {
+		p.base.Fail(run.err)
+	}
+}
+
+// OnStop closes the stdin of the process, so that ServeSubsystem returns, and waits for the
+// process to exit, killing it if it does not exit in time.
+func (p *ProcessSubsystem) OnStop() error {
+	p.lock.Lock()
+	run := p.run
+	p.run = nil
+	p.lock.Unlock()
+	if run == nil {
+		return nil
+	}
+	run.lock.Lock()
+	run.stopping = true
+	run.lock.Unlock()
+	_ = run.stdin.Close()
+	select {
+	case <-run.exited:
+		return nil
+	case <-time.After(processStopTimeout):
+	}
+	logging.WithField("Subsystem", p.name).Warn("killing subsystem process that did not exit")
+	if err := run.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	<-run.exited
+	return nil
+}
+
+// Call sends a method request to the process and waits for its response. The request keeps the
+// ID, caller and deadline of the MethodRequest in ctx, if any.
+func (p *ProcessSubsystem) Call(ctx context.Context, method string, args ...any) (any, error) {
+	p.lock.Lock()
+	run := p.run
+	p.lock.Unlock()
+	if run == nil {
+		return nil, fmt.Errorf("%w: process of subsystem %v is not running", ErrSubsystemNotRunning, p.name)
+	}
+	req, ok := RequestFromContext(ctx)
+	if !ok {
+		req = MethodRequest{Subsystem: p.name, ID: fmt.Sprintf("%v-%d", p.name, p.nextID.Add(1))}
+		if deadline, ok := ctx.Deadline(); ok {
+			req.Deadline = deadline
+		}
+	}
+	req.Method, req.Data = method, args
+
+	ch := make(chan MethodResponse, 1)
+	run.lock.Lock()
+	run.pending[req.ID] = ch
+	run.lock.Unlock()
+	defer func() {
+		run.lock.Lock()
+		delete(run.pending, req.ID)
+		run.lock.Unlock()
+	}()
+	if err := run.send(processMessage{Request: &req}); err != nil {
+		return nil, fmt.Errorf("could not send request to process of subsystem %v: %w", p.name, err)
+	}
+	select {
+	case resp := <-ch:
+		return resp.Data, resp.Error
+	case <-ctx.Done():
+		_ = run.send(processMessage{Cancel: &MethodCancel{ID: req.ID, Err: contextError(ctx.Err())}})
+		return nil, context.Cause(ctx)
+	case <-run.exited:
+		return nil, fmt.Errorf("%w: %w", ErrSubsystemNotRunning, run.err)
+	}
+}
+
+func (run *processRun) send(msg processMessage) error {
+	run.writeLock.Lock()
+	defer run.writeLock.Unlock()
+	return run.enc.Encode(msg)
+}
+
+// ServeSubsystem serves bs to the parent process that started this process as a
+// ProcessSubsystem, over stdin and stdout. It starts bs, and once stdin is closed, waits for the
+// calls in progress, stops bs and returns. Nothing else may write to stdout while it runs.
+func ServeSubsystem(bs *BaseSubsystem) error {
+	return serveSubsystem(bs, os.Stdin, os.Stdout)
+}
+
+func serveSubsystem(bs *BaseSubsystem, r io.Reader, w io.Writer) error {
+	if _, err := bs.Start(); err != nil {
+		return err
+	}
+	defer bs.Stop()
+
+	dec := gob.NewDecoder(r)
+	enc := gob.NewEncoder(w)
+	var writeLock sync.Mutex
+	var inflight sync.Map // request ID -> context.CancelCauseFunc
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		var msg processMessage
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("could not read request: %w", err)
+		}
+		if msg.Cancel != nil {
+			if cancel, ok := inflight.Load(msg.Cancel.ID); ok {
+				cancel.(context.CancelCauseFunc)(msg.Cancel.Err)
+			}
+			continue
+		}
+		if msg.Request == nil {
+			continue
+		}
+		req := *msg.Request
+		ctx, cancel := context.WithCancelCause(withRequest(context.Background(), req))
+		cancelDeadline := func() {}
+		if !req.Deadline.IsZero() {
+			ctx, cancelDeadline = context.WithDeadlineCause(ctx, req.Deadline, ErrMethodTimeout)
+		}
+		inflight.Store(req.ID, cancel)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer inflight.Delete(req.ID)
+			defer cancel(nil)
+			defer cancelDeadline()
+			data, err := bs.Call(ctx, req.Method, req.Data...)
+			if err != nil {
+				err = AsMethodError(err, req.Subsystem, req.Method, req.ID)
+			}
+			// the arguments are of no use to the parent
+			req.Data = nil
+			writeLock.Lock()
+			defer writeLock.Unlock()
+			if encErr := enc.Encode(MethodResponse{Request: req, Error: err, Data: data}); encErr != nil {
+				_ = enc.Encode(MethodResponse{
+					Request: req,
+					Error:   newMethodError(ErrTypeMismatch, req, "could not encode result of type %T: %v", data, encErr),
+				})
+			}
+		}()
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"os/exec"
+	"overseer/eventbus"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// childResult is registered with gob in the child process only, so the parent cannot decode it.
+type childResult struct {
+	N int
+}
+
+// TestHelperProcess is not a test: it serves a subsystem when the tests of ProcessSubsystem run
+// the test binary as a child process.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("OVERSEER_HELPER_PROCESS") != "1" {
+		return
+	}
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "child", recorder: &recorder{}})
+	bs.MustRegister("pid", "", func(ctx context.Context) (int, error) {
+		return os.Getpid(), nil
+	})
+	bs.MustRegister("caller", "", func(ctx context.Context) (string, error) {
+		caller, _ := CallerFromContext(ctx)
+		return caller, nil
+	})
+	bs.MustRegister("exit", "", func(ctx context.Context, code int) (any, error) {
+		os.Exit(code)
+		return nil, nil
+	})
+	bs.MustRegister("wait", "", func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, context.Cause(ctx)
+	})
+	gob.Register(childResult{})
+	bs.MustRegister("unregistered", "", func(ctx context.Context) (any, error) {
+		return childResult{N: 1}, nil
+	})
+	if err := ServeSubsystem(bs); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func helperProcess() *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "OVERSEER_HELPER_PROCESS=1")
+	return cmd
+}
+
+func TestProcessSubsystem(t *testing.T) {
+	bus := eventbus.New()
+	bs := NewBaseSubsystem(NewProcessSubsystem("isolated", helperProcess))
+	overseer := NewOverseer(bus, bs)
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	resp := SubsystemMethod(bus, "test", "isolated", "ping")
+	require.NoError(t, resp.Error)
+	require.Equal(t, "child", resp.Data)
+
+	resp = SubsystemMethod(bus, "test", "isolated", "pid")
+	require.NoError(t, resp.Error)
+	require.NotEqual(t, os.Getpid(), resp.Data)
+
+	resp = SubsystemMethod(bus, "alice", "isolated", "caller")
+	require.NoError(t, resp.Error)
+	require.Equal(t, "alice", resp.Data)
+
+	resp = SubsystemMethod(bus, "test", "isolated", "pid", "unexpected")
+	require.ErrorIs(t, resp.Error, ErrInvalidArgs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp = SubsystemMethodCtx(ctx, bus, "test", "isolated", "wait")
+	require.ErrorIs(t, resp.Error, ErrMethodTimeout)
+
+	require.NoError(t, overseer.StopAll(context.Background()))
+	require.Equal(t, StoppedState, bs.State())
+}
+
+func TestProcessSubsystemRestart(t *testing.T) {
+	bus := eventbus.New()
+	bs := NewBaseSubsystem(NewProcessSubsystem("isolated", helperProcess))
+	overseer := NewOverseer(bus, bs)
+	spec := DefaultSupervisorSpec
+	spec.MinBackoff = time.Millisecond
+	overseer.Supervise(spec)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+
+	resp := SubsystemMethod(bus, "test", "isolated", "pid")
+	require.NoError(t, resp.Error)
+	pid := resp.Data
+
+	restarted := awaitEvent(t, bus, "isolated:restart")
+	resp = SubsystemMethod(bus, "test", "isolated", "exit", 3)
+	require.ErrorIs(t, resp.Error, ErrSubsystemNotRunning)
+	require.Contains(t, resp.Error.Error(), "exit status 3")
+
+	select {
+	case event := <-restarted:
+		require.Contains(t, event.(SupervisorEvent).Err.Error(), "exit status 3")
+	case <-time.After(5 * time.Second):
+		t.Fatal("subsystem process was not restarted")
+	}
+	resp = SubsystemMethod(bus, "test", "isolated", "pid")
+	require.NoError(t, resp.Error)
+	require.NotEqual(t, pid, resp.Data)
+}
+
+func TestProcessSubsystemUnreadableResponse(t *testing.T) {
+	bus := eventbus.New()
+	bs := NewBaseSubsystem(NewProcessSubsystem("isolated", helperProcess))
+	overseer := NewOverseer(bus, bs)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+	failed := make(chan struct{})
+	bs.OnTransition(func(transition StateTransition) {
+		if transition.To == FailedState {
+			close(failed)
+		}
+	})
+
+	waiting := make(chan MethodResponse, 1)
+	go func() {
+		waiting <- SubsystemMethod(bus, "test", "isolated", "wait")
+	}()
+	resp := SubsystemMethod(bus, "test", "isolated", "unregistered")
+	require.ErrorIs(t, resp.Error, ErrSubsystemNotRunning)
+	require.Contains(t, resp.Error.Error(), "could not read response")
+	select {
+	case resp := <-waiting:
+		require.ErrorIs(t, resp.Error, ErrSubsystemNotRunning)
+	case <-time.After(5 * time.Second):
+		t.Fatal("call in progress did not fail")
+	}
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subsystem did not fail")
+	}
+}
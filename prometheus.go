@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets of the latency histograms.
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics collects the metrics of an event bus and an overseer, and serves them in the
+// Prometheus text exposition format. It implements eventbus.Metrics and MethodMetrics:
+//
+//	metrics := NewPrometheusMetrics()
+//	bus := eventbus.New(eventbus.WithMetrics(metrics, "method", "subsystem*:#"))
+//	overseer := NewOverseer(bus, ...)
+//	overseer.SetMetrics(metrics)
+//	overseer.RegisterSubsystem(NewBaseSubsystem(NewMetricsServer(metrics, "127.0.0.1:9100")))
+type PrometheusMetrics struct {
+	lock           sync.Mutex // guards the series of every family
+	families       []*metricFamily
+	published      *metricFamily
+	handlerLatency *metricFamily
+	queueDepth     *metricFamily
+	calls          *metricFamily
+	callLatency    *metricFamily
+	panics         *metricFamily
+	retries        *metricFamily
+}
+
+type metricFamily struct {
+	name   string
+	help   string
+	kind   string // counter, gauge or histogram
+	labels []string
+	series map[string]*metricSeries // by the rendered labels
+}
+
+type metricSeries struct {
+	labels  string   // rendered, e.g. {topic="method"}
+	value   float64  // of counters and gauges
+	buckets []uint64 // of histograms, the observations per bucket of latencyBuckets
+	sum     float64
+	count   uint64
+}
+
+// NewPrometheusMetrics returns metrics without observations.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	p := &PrometheusMetrics{}
+	p.published = p.family("eventbus_events_published_total", "Events published, by topic.", "counter", "topic")
+	p.handlerLatency = p.family("eventbus_handler_duration_seconds", "Time handlers took to handle an event, by topic.", "histogram", "topic", "mode")
+	p.queueDepth = p.family("eventbus_async_queue_depth", "Async handler invocations waiting to run.", "gauge")
+	p.queueDepth.get()
+	p.calls = p.family("overseer_method_calls_total", "Method calls, by subsystem, method and error code.", "counter", "subsystem", "method", "code")
+	p.callLatency = p.family("overseer_method_duration_seconds", "Time subsystems took to serve method calls.", "histogram", "subsystem", "method")
+	p.panics = p.family("overseer_method_panics_total", "Method calls that panicked.", "counter", "subsystem", "method")
+	p.retries = p.family("overseer_route_retries_total", "Retries of the lookup of a subsystem a request is addressed to.", "counter", "subsystem")
+	return p
+}
+
+func (p *PrometheusMetrics) family(name string, help string, kind string, labels ...string) *metricFamily {
+	f := &metricFamily{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*metricSeries)}
+	p.families = append(p.families, f)
+	return f
+}
+
+// get returns the series of f with the given label values. The caller holds p.lock.
+func (f *metricFamily) get(values ...string) *metricSeries {
+	var b strings.Builder
+	if len(values) > 0 {
+		b.WriteByte('{')
+		for i, value := range values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(f.labels[i])
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(value))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	labels := b.String()
+	series, ok := f.series[labels]
+	if !ok {
+		series = &metricSeries{labels: labels}
+		if f.kind == "histogram" {
+			series.buckets = make([]uint64, len(latencyBuckets))
+		}
+		f.series[labels] = series
+	}
+	return series
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func (s *metricSeries) observe(d time.Duration) {
+	seconds := d.Seconds()
+	if i := sort.SearchFloat64s(latencyBuckets, seconds); i < len(s.buckets) {
+		s.buckets[i]++
+	}
+	s.sum += seconds
+	s.count++
+}
+
+// EventPublished implements eventbus.Metrics.
+func (p *PrometheusMetrics) EventPublished(topic string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.published.get(topic).value++
+}
+
+// HandlerDone implements eventbus.Metrics.
+func (p *PrometheusMetrics) HandlerDone(topic string, async bool, duration time.Duration) {
+	mode := "sync"
+	if async {
+		mode = "async"
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.handlerLatency.get(topic, mode).observe(duration)
+}
+
+// AsyncQueueDepth implements eventbus.Metrics.
+func (p *PrometheusMetrics) AsyncQueueDepth(depth int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.queueDepth.get().value = float64(depth)
+}
+
+// MethodCalled implements MethodMetrics. Calls are counted by the code of their MethodError, or
+// as "ok" if they succeeded.
+func (p *PrometheusMetrics) MethodCalled(subsystem string, method string, duration time.Duration, err error) {
+	code := "ok"
+	if err != nil {
+		code = string(AsMethodError(err, subsystem, method, "").Code)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.calls.get(subsystem, method, code).value++
+	if duration > 0 {
+		p.callLatency.get(subsystem, method).observe(duration)
+	}
+}
+
+// MethodPanicked implements MethodMetrics.
+func (p *PrometheusMetrics) MethodPanicked(subsystem string, method string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.panics.get(subsystem, method).value++
+}
+
+// RouteRetried implements MethodMetrics.
+func (p *PrometheusMetrics) RouteRetried(subsystem string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.retries.get(subsystem).value++
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf := bufio.NewWriter(w)
+	p.write(buf)
+	_ = buf.Flush()
+}
+
+func (p *PrometheusMetrics) write(w *bufio.Writer) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, f := range p.families {
+		w.WriteString("# HELP " + f.name + " " + f.help + "\n")
+		w.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			series := f.series[key]
+			if f.kind != "histogram" {
+				w.WriteString(f.name + series.labels + " " + formatFloat(series.value) + "\n")
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range latencyBuckets {
+				cumulative += series.buckets[i]
+				w.WriteString(f.name + "_bucket" + withLabel(series.labels, "le", formatFloat(bound)) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+			}
+			w.WriteString(f.name + "_bucket" + withLabel(series.labels, "le", "+Inf") + " " + strconv.FormatUint(series.count, 10) + "\n")
+			w.WriteString(f.name + "_sum" + series.labels + " " + formatFloat(series.sum) + "\n")
+			w.WriteString(f.name + "_count" + series.labels + " " + strconv.FormatUint(series.count, 10) + "\n")
+		}
+	}
+}
+
+// withLabel adds a label to rendered labels.
+func withLabel(labels string, name string, value string) string {
+	label := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return labels[:len(labels)-1] + "," + label + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"overseer/eventbus"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	metrics := NewPrometheusMetrics()
+	bus := eventbus.New(eventbus.WithMetrics(metrics, "method"))
+	echo := NewBaseSubsystem(&recordingSubsystem{name: "echo", recorder: &recorder{}})
+	late := NewBaseSubsystem(&recordingSubsystem{name: "late", recorder: &recorder{}})
+	server := NewMetricsServer(metrics, "127.0.0.1:0")
+	overseer := NewOverseer(bus, echo, late, NewBaseSubsystem(server))
+	overseer.SetMetrics(metrics)
+	require.NoError(t, overseer.StartSubsystem("echo"))
+	require.NoError(t, overseer.StartSubsystem(MetricsName))
+	defer overseer.StopAll(context.Background())
+
+	require.NoError(t, SubsystemMethod(bus, "test", "echo", "ping").Error)
+	require.NoError(t, SubsystemMethod(bus, "test", "echo", "ping").Error)
+	require.ErrorIs(t, SubsystemMethod(bus, "test", "echo", "panic").Error, ErrPanicked)
+
+	time.AfterFunc(50*time.Millisecond, func() { late.Start() })
+	require.NoError(t, SubsystemMethod(bus, "test", "late", "ping").Error)
+
+	resp, err := http.Get("http://" + server.Addr().String() + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	body := string(b)
+
+	for _, line := range []string{
+		"# TYPE eventbus_events_published_total counter",
+		`eventbus_events_published_total{topic="method"} 4`,
+		`eventbus_handler_duration_seconds_count{topic="method",mode="async"} 4`,
+		"# TYPE eventbus_async_queue_depth gauge",
+		`overseer_method_calls_total{subsystem="echo",method="ping",code="ok"} 2`,
+		`overseer_method_calls_total{subsystem="echo",method="panic",code="panicked"} 1`,
+		`overseer_method_calls_total{subsystem="late",method="ping",code="ok"} 1`,
+		`overseer_method_duration_seconds_bucket{subsystem="echo",method="ping",le="+Inf"} 2`,
+		`overseer_method_panics_total{subsystem="echo",method="panic"} 1`,
+	} {
+		require.Contains(t, body, line+"\n")
+	}
+	require.Regexp(t, `eventbus_events_published_total\{topic="_other"\} \d+`, body)
+	require.Regexp(t, `overseer_route_retries_total\{subsystem="late"\} [1-9]`, body)
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	metrics := NewPrometheusMetrics()
+	metrics.EventPublished("a\"b\\c\nd")
+	metrics.HandlerDone("topic", false, 2*time.Millisecond)
+	metrics.HandlerDone("topic", false, time.Minute)
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	require.Contains(t, body, `eventbus_events_published_total{topic="a\"b\\c\nd"} 1`+"\n")
+	require.Contains(t, body, `eventbus_handler_duration_seconds_bucket{topic="topic",mode="sync",le="0.001"} 0`+"\n")
+	require.Contains(t, body, `eventbus_handler_duration_seconds_bucket{topic="topic",mode="sync",le="0.005"} 1`+"\n")
+	require.Contains(t, body, `eventbus_handler_duration_seconds_bucket{topic="topic",mode="sync",le="10"} 1`+"\n")
+	require.Contains(t, body, `eventbus_handler_duration_seconds_bucket{topic="topic",mode="sync",le="+Inf"} 2`+"\n")
+	require.Contains(t, body, `eventbus_handler_duration_seconds_sum{topic="topic",mode="sync"} 60.002`+"\n")
+	require.Contains(t, body, "eventbus_async_queue_depth 0\n")
+}
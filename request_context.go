@@ -0,0 +1,31 @@
+package main
+
+import "context"
+
+type requestContextKey struct{}
+
+// withRequest returns a copy of ctx carrying the request it serves.
+func withRequest(ctx context.Context, methodRequest MethodRequest) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, methodRequest)
+}
+
+// RequestFromContext returns the request served by the ctx handed to Subsystem.Call or a
+// registered method.
+func RequestFromContext(ctx context.Context) (MethodRequest, bool) {
+	if ctx == nil {
+		return MethodRequest{}, false
+	}
+	methodRequest, ok := ctx.Value(requestContextKey{}).(MethodRequest)
+	return methodRequest, ok
+}
+
+// CallerFromContext returns the caller of the request served by ctx: the subsystem serving the
+// call that made the request with its ctx, or else the caller passed to SubsystemMethod or set as
+// the owner of a SubsystemLibrary.
+func CallerFromContext(ctx context.Context) (string, bool) {
+	methodRequest, ok := RequestFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return methodRequest.Caller, true
+}
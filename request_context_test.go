@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"overseer/eventbus"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallerFromContext(t *testing.T) {
+	bus := eventbus.New()
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "whoami", recorder: &recorder{}})
+	bs.MustRegister("caller", "", func(ctx context.Context) (string, error) {
+		caller, ok := CallerFromContext(ctx)
+		require.True(t, ok)
+		return caller, nil
+	})
+	overseer := NewOverseer(bus, bs)
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	resp := SubsystemMethod(bus, "alice", "whoami", "caller")
+	require.NoError(t, resp.Error)
+	require.Equal(t, "alice", resp.Data)
+
+	_, ok := CallerFromContext(context.Background())
+	require.False(t, ok)
+}
+
+func TestSubsystemLibraryCallerIdentity(t *testing.T) {
+	bus := eventbus.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	overseer := NewOverseer(bus, NewSubsystem1(ctx, bus), NewSubsystem2(ctx, bus))
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	var lock sync.Mutex
+	var calls []string
+	_, err := bus.Subscribe("method", func(data any) {
+		methodRequest := data.(MethodRequest)
+		lock.Lock()
+		calls = append(calls, methodRequest.Caller+"->"+methodRequest.Subsystem)
+		lock.Unlock()
+	})
+	require.NoError(t, err)
+
+	lib := NewSubsystemLibrary(bus, "test")
+	require.Equal(t, "test", lib.Subsystem1Methods().GetOwner())
+	_, err = lib.Subsystem2Methods().PingSubsystem1("hello")
+	require.NoError(t, err)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(t, []string{"test->subsystem2", "subsystem2->subsystem1"}, calls)
+}
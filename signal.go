@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// Signal is a notification broadcast by the overseer to every running subsystem. Signals travel on
+// their own channel rather than as MethodRequests, but are ordered with respect to the method calls
+// routed to each subsystem.
+type Signal interface {
+	// SignalName returns a short name of the signal for logging.
+	SignalName() string
+}
+
+// SignalHandler is implemented by subsystems that want to receive signals.
+type SignalHandler interface {
+	// OnSignal handles a signal. The broadcast waits until it returns.
+	OnSignal(ctx context.Context, signal Signal) error
+}
+
+// ActiveLeavesUpdate announces changes to the set of active leaves.
+type ActiveLeavesUpdate struct {
+	Activated   []string // hashes of the leaves that became active
+	Deactivated []string // hashes of the leaves that are no longer active
+}
+
+func (ActiveLeavesUpdate) SignalName() string {
+	return "active_leaves_update"
+}
+
+// BlockFinalized announces that a block has been finalized.
+type BlockFinalized struct {
+	Hash   string
+	Number uint64
+}
+
+func (BlockFinalized) SignalName() string {
+	return "block_finalized"
+}
+
+// Conclude tells subsystems to wind down. It is broadcast by StopAll before any subsystem is stopped.
+type Conclude struct{}
+
+func (Conclude) SignalName() string {
+	return "conclude"
+}
+
+// BroadcastSignal delivers signal to every running subsystem and waits until all of them have
+// acknowledged it or ctx is done. Each subsystem receives the signal only after the method calls
+// routed to it earlier have returned, and method calls routed to it later wait until it has handled
+// the signal. The errors returned by OnSignal are joined.
+func (s *Overseer) BroadcastSignal(ctx context.Context, signal Signal) error {
+	s.lock.RLock()
+	subsystems := make([]*BaseSubsystem, 0, len(s.Subsystems))
+	for _, bs := range s.Subsystems {
+		subsystems = append(subsystems, bs)
+	}
+	s.lock.RUnlock()
+
+	acks := make(map[string]chan error)
+	for _, bs := range subsystems {
+		if !bs.IsRunning() {
+			continue
+		}
+		ack := make(chan error, 1)
+		if err := bs.enqueue(envelope{signal: signal, ctx: ctx, ack: ack}); err != nil {
+			// stopped since the check above
+			continue
+		}
+		acks[bs.Name()] = ack
+	}
+
+	var errs []error
+	for name, ack := range acks {
+		select {
+		case err := <-ack:
+			if err != nil && !errors.Is(err, errMailboxClosed) {
+				errs = append(errs, fmt.Errorf("subsystem %v: %w", name, err))
+			}
+		case <-ctx.Done():
+			logging.WithField("signal", signal.SignalName()).WithField("Subsystem", name).Warn("signal not acknowledged")
+			return errors.Join(append(errs, fmt.Errorf("subsystem %v did not acknowledge %v: %w", name, signal.SignalName(), ctx.Err()))...)
+		}
+	}
+	return errors.Join(errs...)
+}
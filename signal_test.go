@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"overseer/eventbus"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// signalSubsystem records calls and signals. Calls to "block" and signals wait for release.
+type signalSubsystem struct {
+	bs        *BaseSubsystem
+	name      string
+	recorder  *recorder
+	entered   chan string
+	release   chan struct{}
+	signalErr error
+}
+
+func newSignalSubsystem(name string) *signalSubsystem {
+	return &signalSubsystem{
+		name:     name,
+		recorder: &recorder{},
+		entered:  make(chan string, 10),
+		release:  make(chan struct{}),
+	}
+}
+
+func (s *signalSubsystem) Name() string {
+	return s.name
+}
+
+func (s *signalSubsystem) OnStart() error {
+	return nil
+}
+
+func (s *signalSubsystem) OnStop() error {
+	return nil
+}
+
+func (s *signalSubsystem) Call(ctx context.Context, method string, args ...any) (any, error) {
+	s.entered <- "call:" + method
+	if method == "block" {
+		<-s.release
+	}
+	s.recorder.record("call:" + method)
+	return nil, nil
+}
+
+func (s *signalSubsystem) OnSignal(ctx context.Context, signal Signal) error {
+	s.entered <- "signal:" + signal.SignalName()
+	if _, ok := signal.(BlockFinalized); ok {
+		<-s.release
+	}
+	s.recorder.record("signal:" + signal.SignalName())
+	return s.signalErr
+}
+
+func (s *signalSubsystem) SetBaseSubsystem(bs *BaseSubsystem) {
+	s.bs = bs
+}
+
+func TestBroadcastSignalReachesRunningSubsystems(t *testing.T) {
+	a, b, stopped := newSignalSubsystem("a"), newSignalSubsystem("b"), newSignalSubsystem("stopped")
+	b.signalErr = errors.New("b failed")
+	overseer := NewOverseer(eventbus.New(), NewBaseSubsystem(a), NewBaseSubsystem(b), NewBaseSubsystem(stopped))
+	require.NoError(t, overseer.StartAll(context.Background()))
+	overseer.Subsystems["stopped"].Stop()
+
+	err := overseer.BroadcastSignal(context.Background(), ActiveLeavesUpdate{Activated: []string{"0x01"}})
+	require.ErrorIs(t, err, b.signalErr)
+	require.Equal(t, []string{"signal:active_leaves_update"}, a.recorder.Calls())
+	require.Equal(t, []string{"signal:active_leaves_update"}, b.recorder.Calls())
+	require.Empty(t, stopped.recorder.Calls())
+}
+
+func TestBroadcastSignalWaitsForEarlierCalls(t *testing.T) {
+	bus := eventbus.New()
+	a := newSignalSubsystem("a")
+	overseer := NewOverseer(bus, NewBaseSubsystem(a))
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	go SubsystemMethod(bus, "test", "a", "block")
+	require.Equal(t, "call:block", <-a.entered)
+
+	broadcast := make(chan error, 1)
+	go func() {
+		broadcast <- overseer.BroadcastSignal(context.Background(), Conclude{})
+	}()
+	select {
+	case <-a.entered:
+		t.Fatal("signal delivered while an earlier call was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(a.release)
+	require.NoError(t, <-broadcast)
+	require.Equal(t, []string{"call:block", "signal:conclude"}, a.recorder.Calls())
+}
+
+func TestCallsWaitForEarlierSignals(t *testing.T) {
+	bus := eventbus.New()
+	a := newSignalSubsystem("a")
+	overseer := NewOverseer(bus, NewBaseSubsystem(a))
+	require.NoError(t, overseer.StartAll(context.Background()))
+
+	broadcast := make(chan error, 1)
+	go func() {
+		broadcast <- overseer.BroadcastSignal(context.Background(), BlockFinalized{Hash: "0x01", Number: 1})
+	}()
+	require.Equal(t, "signal:block_finalized", <-a.entered)
+
+	called := make(chan MethodResponse, 1)
+	go func() {
+		called <- SubsystemMethod(bus, "test", "a", "ping")
+	}()
+	select {
+	case <-a.entered:
+		t.Fatal("call dispatched while an earlier signal was being handled")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(a.release)
+	require.NoError(t, <-broadcast)
+	require.NoError(t, (<-called).Error)
+	require.Equal(t, []string{"signal:block_finalized", "call:ping"}, a.recorder.Calls())
+}
+
+func TestBroadcastSignalTimeout(t *testing.T) {
+	a := newSignalSubsystem("a")
+	overseer := NewOverseer(eventbus.New(), NewBaseSubsystem(a))
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer close(a.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := overseer.BroadcastSignal(ctx, BlockFinalized{Hash: "0x01", Number: 1})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
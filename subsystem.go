@@ -1,7 +1,9 @@
 package main
 
 import (
-	"sync/atomic"
+	"context"
+	"sync"
+	"time"
 
 	logging "github.com/sirupsen/logrus"
 )
@@ -17,6 +19,16 @@ const (
 
 	// StopEvent is the event that is published when a subsystem is stopped.
 	StopEvent Event = "stop"
+
+	// RestartEvent is the event that is published when the supervisor restarts a subsystem.
+	RestartEvent Event = "restart"
+
+	// GiveUpEvent is the event that is published when the supervisor stops restarting a subsystem.
+	GiveUpEvent Event = "give_up"
+
+	// StateEvent is the event that is published with a StateTransition whenever the state of a
+	// registered subsystem changes.
+	StateEvent Event = "state"
 )
 
 // Subsystem is an interface that is implemented by a subsystem.
@@ -24,29 +36,61 @@ type Subsystem interface {
 	Name() string
 	OnStart() error
 	OnStop() error
-	Call(method string, args ...any) (result any, err error)
+	// Call invokes a method on the subsystem. ctx is cancelled when the caller gives up on the
+	// request or its deadline passes.
+	Call(ctx context.Context, method string, args ...any) (result any, err error)
 	SetBaseSubsystem(*BaseSubsystem)
 }
 
-// BaseSubsystem provides the guarantees that a Subsystem can only be started and stopped once.
+// DependentSubsystem is implemented by subsystems that must be started after other subsystems.
+type DependentSubsystem interface {
+	// Dependencies returns the names of the subsystems this subsystem depends on.
+	Dependencies() []string
+}
+
+// BaseSubsystem drives a Subsystem through its lifecycle. It guarantees that OnStart and OnStop
+// are only called for valid state transitions, so a subsystem is started and stopped at most once
+// per run. Only the supervisor may move a stopped subsystem into another run.
 type BaseSubsystem struct {
-	name    string
-	start   uint32 // atomic
-	started uint32 // atomic
-	stopped uint32 // atomic
-	quit    chan struct{}
+	name string
+
+	lock      sync.Mutex // guards state, quit, observers, onFailure, mailbox and methods
+	state     SubsystemState
+	quit      chan struct{}
+	observers map[int]func(StateTransition)
+	nextID    int
+	onFailure func(bs *BaseSubsystem, err error)
+	mailbox   *mailbox // nil unless the subsystem is running, failed or stopping
+	mailboxConfig
+	methods map[string]registeredMethod
+
+	// barrier orders signals with respect to method calls, see dispatch.
+	barrier sync.RWMutex
+
+	// notifyLock is taken before lock is released after a transition, so that observers see
+	// transitions in the order they happened.
+	notifyLock sync.Mutex
 
 	// The "subclass" of BaseSubsystem
 	impl Subsystem
 }
 
+// SubsystemOption configures a BaseSubsystem.
+type SubsystemOption func(*BaseSubsystem)
+
 // NewBaseSubsystem returns a BaseSubsystem that wraps an implementation of Subsystem and handles
 // starting and stopping.
-func NewBaseSubsystem(impl Subsystem) *BaseSubsystem {
+func NewBaseSubsystem(impl Subsystem, opts ...SubsystemOption) *BaseSubsystem {
 	bs := &BaseSubsystem{
-		name: impl.Name(),
-		quit: make(chan struct{}),
-		impl: impl,
+		name:      impl.Name(),
+		state:     IdleState,
+		quit:      make(chan struct{}),
+		observers: make(map[int]func(StateTransition)),
+		methods:   make(map[string]registeredMethod),
+		impl:      impl,
+	}
+	for _, opt := range opts {
+		opt(bs)
 	}
 	bs.impl.SetBaseSubsystem(bs)
 	return bs
@@ -57,53 +101,186 @@ func (bs *BaseSubsystem) Name() string {
 	return bs.impl.Name()
 }
 
-// Call calls a method on the subsystem.
-func (bs *BaseSubsystem) Call(method string, args ...any) (any, error) {
-	return bs.impl.Call(method, args...)
+// Call calls a method on the subsystem. Methods in the method registry take precedence over the
+// methods served by Subsystem.Call.
+func (bs *BaseSubsystem) Call(ctx context.Context, method string, args ...any) (any, error) {
+	if handler, ok := bs.lookupMethod(method); ok {
+		return handler(ctx, args...)
+	}
+	return bs.impl.Call(ctx, method, args...)
+}
+
+// State returns the current state of the subsystem.
+func (bs *BaseSubsystem) State() SubsystemState {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	return bs.state
+}
+
+// transition moves the subsystem to state to and notifies the observers. It returns the previous
+// state, and an *InvalidTransitionError if the current state does not allow the transition.
+func (bs *BaseSubsystem) transition(to SubsystemState) (SubsystemState, error) {
+	bs.lock.Lock()
+	from := bs.state
+	if !from.CanTransition(to) {
+		bs.lock.Unlock()
+		return from, &InvalidTransitionError{Subsystem: bs.name, From: from, To: to}
+	}
+	bs.state = to
+	switch to {
+	case StoppedState:
+		close(bs.quit)
+	case RestartingState:
+		bs.quit = make(chan struct{})
+	}
+	observers := make([]func(StateTransition), 0, len(bs.observers))
+	for id := 0; id < bs.nextID; id++ {
+		if observer, ok := bs.observers[id]; ok {
+			observers = append(observers, observer)
+		}
+	}
+	bs.notifyLock.Lock()
+	bs.lock.Unlock()
+	defer bs.notifyLock.Unlock()
+
+	logging.WithFields(logging.Fields{
+		"bsname": bs.name,
+		"from":   from,
+		"to":     to,
+	}).Debug("subsystem state transition")
+	transition := StateTransition{Subsystem: bs.name, From: from, To: to, Time: time.Now()}
+	for _, observer := range observers {
+		observer(transition)
+	}
+	return from, nil
+}
+
+// OnTransition registers fn to be called with every state transition of the subsystem, in the
+// order the transitions happen, and returns a function that unregisters it. fn is called from the
+// goroutine making the transition and must not change the state of the subsystem itself.
+func (bs *BaseSubsystem) OnTransition(fn func(StateTransition)) (remove func()) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	id := bs.nextID
+	bs.nextID++
+	bs.observers[id] = fn
+	return func() {
+		bs.lock.Lock()
+		defer bs.lock.Unlock()
+		delete(bs.observers, id)
+	}
+}
+
+// WaitFor blocks until the subsystem is in state, or enters it, and returns ctx.Err() if ctx is
+// done first. Transient states such as StartingState are observed even if they are left quickly.
+func (bs *BaseSubsystem) WaitFor(ctx context.Context, state SubsystemState) error {
+	reached := make(chan struct{})
+	var once sync.Once
+	remove := bs.OnTransition(func(transition StateTransition) {
+		if transition.To == state {
+			once.Do(func() { close(reached) })
+		}
+	})
+	defer remove()
+	if bs.State() == state {
+		return nil
+	}
+	select {
+	case <-reached:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// Start starts the subsystem.
+// Start starts the subsystem. It returns false without an error if the subsystem is already
+// starting or running, or has been stopped.
 func (bs *BaseSubsystem) Start() (bool, error) {
-	if atomic.CompareAndSwapUint32(&bs.start, 0, 1) {
-		if atomic.LoadUint32(&bs.stopped) == 1 {
+	from, err := bs.transition(StartingState)
+	if err != nil {
+		switch from {
+		case StoppingState, StoppedState:
 			logging.WithField("bsname", bs.name).Info("not starting basesubsystem -- already stopped")
-			return false, nil
-		} else {
-			logging.WithField("bsname", bs.name).Info("starting subsystem")
-		}
-		err := bs.impl.OnStart()
-		if err != nil {
-			// revert flag
-			atomic.StoreUint32(&bs.start, 0)
-			return false, err
+		default:
+			logging.WithField("bsname", bs.name).WithField("state", from).Debug("not starting basesubsystem -- already started")
 		}
-		atomic.StoreUint32(&bs.started, 1)
-		return true, err
-	} else {
-		logging.WithField("bsname", bs.name).Debug("not starting basesubsystem -- already stopped")
 		return false, nil
 	}
+
+	logging.WithField("bsname", bs.name).Info("starting subsystem")
+	if err := bs.impl.OnStart(); err != nil {
+		_, _ = bs.transition(FailedState)
+		return false, err
+	}
+	bs.openMailbox()
+	if _, err := bs.transition(RunningState); err != nil {
+		bs.closeMailbox()
+		return false, err
+	}
+	return true, nil
 }
 
 // Stop stops the subsystem.
 func (bs *BaseSubsystem) Stop() bool {
-	if atomic.CompareAndSwapUint32(&bs.stopped, 0, 1) {
-		logging.WithField("bsname", bs.name).Info("stopping subsystem")
-		err := bs.impl.OnStop()
-		if err != nil {
-			logging.WithField("bsname", bs.impl.Name()).WithError(err).Error("could not stop basesubsystem")
-		}
-		close(bs.quit)
-		return true
-	} else {
+	stopped, _ := bs.stop()
+	return stopped
+}
+
+// stop stops the subsystem and returns the error reported by OnStop, if any.
+func (bs *BaseSubsystem) stop() (bool, error) {
+	if _, err := bs.transition(StoppingState); err != nil {
 		logging.WithField("bsname", bs.name).Debug("stopping subsystem (ignoring: already stopped)")
-		return false
+		return false, nil
+	}
+	logging.WithField("bsname", bs.name).Info("stopping subsystem")
+	err := bs.impl.OnStop()
+	if err != nil {
+		logging.WithField("bsname", bs.impl.Name()).WithError(err).Error("could not stop basesubsystem")
+	}
+	_, _ = bs.transition(StoppedState)
+	bs.closeMailbox()
+	return true, err
+}
+
+// restart stops the subsystem if it is running or failed and starts it again.
+func (bs *BaseSubsystem) restart() (bool, error) {
+	_, stopErr := bs.stop()
+	if stopErr != nil {
+		logging.WithField("bsname", bs.name).WithError(stopErr).Warn("restarting subsystem despite stop error")
+	}
+	if _, err := bs.transition(RestartingState); err != nil {
+		return false, err
 	}
+	return bs.Start()
+}
+
+// Fail reports that the running subsystem crashed and moves it to FailedState. If the subsystem is
+// registered with a supervised overseer, the supervisor decides whether and how to restart it.
+func (bs *BaseSubsystem) Fail(err error) {
+	from, transitionErr := bs.transition(FailedState)
+	if transitionErr != nil && from != FailedState {
+		logging.WithField("bsname", bs.name).WithField("state", from).WithError(err).Warn("ignoring failure of subsystem that is not running")
+		return
+	}
+	logging.WithField("bsname", bs.name).WithError(err).Error("subsystem failed")
+	bs.lock.Lock()
+	onFailure := bs.onFailure
+	bs.lock.Unlock()
+	if onFailure != nil {
+		onFailure(bs, err)
+	}
+}
+
+// setFailureHandler sets the function notified by Fail.
+func (bs *BaseSubsystem) setFailureHandler(onFailure func(bs *BaseSubsystem, err error)) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	bs.onFailure = onFailure
 }
 
 // IsRunning returns true if the subsystem is running.
 func (bs *BaseSubsystem) IsRunning() bool {
-	return atomic.LoadUint32(&bs.started) == 1 && atomic.LoadUint32(&bs.stopped) == 0
+	return bs.State() == RunningState
 }
 
 // SetSubsystem sets the implementation of the subsystem.
@@ -118,5 +295,8 @@ func (bs *BaseSubsystem) String() string {
 
 // Wait blocks until the subsystem is stopped.
 func (bs *BaseSubsystem) Wait() {
-	<-bs.quit
+	bs.lock.Lock()
+	quit := bs.quit
+	bs.lock.Unlock()
+	<-quit
 }
@@ -2,16 +2,26 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	logging "github.com/sirupsen/logrus"
 	"overseer/eventbus"
 )
 
+//go:generate go run ./cmd/subsystemgen -type Subsystem1API -output subsystem1_gen.go
+
+// Subsystem1API lists the methods subsystem1 serves to other subsystems.
+//
+//overseer:subsystem subsystem1
+type Subsystem1API interface {
+	// Ping replies with "pong".
+	Ping(ctx context.Context, message string) (string, error)
+}
+
 type Subsystem1 struct {
 	bs               *BaseSubsystem
 	cancel           context.CancelFunc
 	ctx              context.Context
+	parentCtx        context.Context
 	eventBus         eventbus.Bus
 	subsystemLibrary SubsystemLibrary
 }
@@ -21,8 +31,13 @@ func (t *Subsystem1) Name() string {
 }
 
 func (t *Subsystem1) OnStart() error {
+	if t.ctx.Err() != nil {
+		// restarted by the supervisor after OnStop cancelled the previous run
+		t.ctx, t.cancel = context.WithCancel(t.parentCtx)
+	}
+	ctx := t.ctx
 	go func() {
-		select {}
+		<-ctx.Done()
 	}()
 	t.eventBus.Publish(fmt.Sprintf("subsystem1:%v", StartEvent), nil)
 	logging.Info("subsystem1 started")
@@ -35,15 +50,19 @@ func (t *Subsystem1) OnStop() error {
 	return nil
 }
 
-func (t *Subsystem1) Call(method string, args ...interface{}) (interface{}, error) {
-	switch method {
-	case "ping":
-		logging.WithField("args", args).Info("subsystem1 ping called")
-		return "pong", nil
+// Call serves the methods that are not in the method registry. All methods of Subsystem1 are
+// registered by registerSubsystem1API.
+func (t *Subsystem1) Call(ctx context.Context, method string, args ...interface{}) (interface{}, error) {
+	return nil, ErrMethodNotFound
+}
 
-	default:
-		return nil, errors.New("method not found")
-	}
+func (t *Subsystem1) Ping(ctx context.Context, message string) (string, error) {
+	caller, _ := CallerFromContext(ctx)
+	logging.WithFields(TraceFields(ctx)).WithFields(logging.Fields{
+		"caller":  caller,
+		"message": message,
+	}).Info("subsystem1 ping called")
+	return "pong", nil
 }
 
 func (t *Subsystem1) SetBaseSubsystem(bs *BaseSubsystem) {
@@ -51,12 +70,16 @@ func (t *Subsystem1) SetBaseSubsystem(bs *BaseSubsystem) {
 }
 
 func NewSubsystem1(ctx context.Context, eventBus eventbus.Bus) *BaseSubsystem {
-	ctx, cancel := context.WithCancel(context.WithValue(ctx, "subsystem", "subsystem1"))
+	parentCtx := context.WithValue(ctx, "subsystem", "subsystem1")
+	ctx, cancel := context.WithCancel(parentCtx)
 	subsystem1 := Subsystem1{
-		cancel:   cancel,
-		ctx:      ctx,
-		eventBus: eventBus,
+		cancel:    cancel,
+		ctx:       ctx,
+		parentCtx: parentCtx,
+		eventBus:  eventBus,
 	}
 	subsystem1.subsystemLibrary = NewSubsystemLibrary(subsystem1.eventBus, subsystem1.Name())
-	return NewBaseSubsystem(&subsystem1)
+	bs := NewBaseSubsystem(&subsystem1)
+	registerSubsystem1API(bs, &subsystem1)
+	return bs
 }
@@ -0,0 +1,74 @@
+// Code generated by subsystemgen from subsystem1.go; DO NOT EDIT.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"overseer/eventbus"
+	"reflect"
+)
+
+// Subsystem1Methods calls the methods served by subsystem1 over the event bus.
+type Subsystem1Methods interface {
+	SetOwner(owner string)
+	GetOwner() (owner string)
+	Ping(message string) (string, error)
+	PingCtx(ctx context.Context, message string) (string, error)
+}
+
+type Subsystem1MethodsInstance struct {
+	owner    string
+	eventBus eventbus.Bus
+}
+
+func (m *Subsystem1MethodsInstance) GetOwner() (owner string) {
+	return m.owner
+}
+
+func (m *Subsystem1MethodsInstance) SetOwner(owner string) {
+	m.owner = owner
+}
+
+// Ping replies with "pong".
+func (m *Subsystem1MethodsInstance) Ping(message string) (string, error) {
+	return m.PingCtx(context.Background(), message)
+}
+
+func (m *Subsystem1MethodsInstance) PingCtx(ctx context.Context, message string) (string, error) {
+	var result string
+	methodResponse := SubsystemMethodCtx(ctx, m.eventBus, m.owner, "subsystem1", "ping", message)
+	if methodResponse.Error != nil {
+		return result, methodResponse.Error
+	}
+	if methodResponse.Data == nil {
+		return result, nil
+	}
+	result, ok := methodResponse.Data.(string)
+	if !ok {
+		return result, fmt.Errorf("subsystem1.ping returned %T, expected string", methodResponse.Data)
+	}
+	return result, nil
+}
+
+// registerSubsystem1API registers the methods of impl in the method registry of bs.
+func registerSubsystem1API(bs *BaseSubsystem, impl Subsystem1API) {
+	bs.registerMethod(MethodInfo{
+		Name: "ping",
+		Args: []reflect.Type{
+			reflect.TypeOf((*string)(nil)).Elem(),
+		},
+		ArgNames:    []string{"message"},
+		Result:      reflect.TypeOf((*string)(nil)).Elem(),
+		Description: "Ping replies with \"pong\".",
+	}, func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: ping expects 1 args, got %d", ErrInvalidArgs, len(args))
+		}
+		message, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: message must be string, got %T", ErrInvalidArgs, args[0])
+		}
+		return impl.Ping(ctx, message)
+	})
+}
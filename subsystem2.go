@@ -2,16 +2,32 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	logging "github.com/sirupsen/logrus"
 	"overseer/eventbus"
 )
 
+//go:generate go run ./cmd/subsystemgen -type Subsystem2API -output subsystem2_gen.go
+
+// Subsystem2API lists the methods subsystem2 serves to other subsystems.
+//
+//overseer:subsystem subsystem2
+type Subsystem2API interface {
+	// Ping replies with "pong".
+	Ping(ctx context.Context, message string) (string, error)
+
+	// PingSubsystem1 pings subsystem1 on behalf of the caller.
+	PingSubsystem1(ctx context.Context, message string) (string, error)
+
+	// ProcessActiveLeavesUpdate processes an empty active leaves update.
+	ProcessActiveLeavesUpdate(ctx context.Context) (any, error)
+}
+
 type Subsystem2 struct {
 	bs               *BaseSubsystem
 	cancel           context.CancelFunc
 	ctx              context.Context
+	parentCtx        context.Context
 	eventBus         eventbus.Bus
 	subsystemLibrary SubsystemLibrary
 }
@@ -20,9 +36,20 @@ func (t *Subsystem2) Name() string {
 	return "subsystem2"
 }
 
+// Dependencies returns the subsystems that must be running before Subsystem2 is started.
+func (t *Subsystem2) Dependencies() []string {
+	// ping_subsystem1 calls into subsystem1
+	return []string{"subsystem1"}
+}
+
 func (t *Subsystem2) OnStart() error {
+	if t.ctx.Err() != nil {
+		// restarted by the supervisor after OnStop cancelled the previous run
+		t.ctx, t.cancel = context.WithCancel(t.parentCtx)
+	}
+	ctx := t.ctx
 	go func() {
-		select {}
+		<-ctx.Done()
 	}()
 	t.eventBus.Publish(fmt.Sprintf("subsystem2:%v", StartEvent), nil)
 	return nil
@@ -34,44 +61,65 @@ func (t *Subsystem2) OnStop() error {
 	return nil
 }
 
-func (t *Subsystem2) Call(method string, args ...interface{}) (interface{}, error) {
-	switch method {
-	case "ping":
-		logging.WithField("args", args).Info("subsystem2 ping called")
-		return "pong", nil
+// Call serves the methods that are not in the method registry. All methods of Subsystem2 are
+// registered by registerSubsystem2API.
+func (t *Subsystem2) Call(ctx context.Context, method string, args ...interface{}) (interface{}, error) {
+	return nil, ErrMethodNotFound
+}
 
-	case "ping_subsystem1":
-		logging.WithField("args", args).Info("subsystem2 ping_subsystem1 called")
-		if len(args) != 1 {
-			return nil, errors.New("invalid number of args")
-		}
-		arg, ok := args[0].(string)
-		if !ok {
-			return nil, errors.New("invalid arg type")
-		}
+func (t *Subsystem2) Ping(ctx context.Context, message string) (string, error) {
+	caller, _ := CallerFromContext(ctx)
+	logging.WithFields(TraceFields(ctx)).WithFields(logging.Fields{
+		"caller":  caller,
+		"message": message,
+	}).Info("subsystem2 ping called")
+	return "pong", nil
+}
 
-		return t.subsystemLibrary.Subsystem1Methods().Ping(arg)
+func (t *Subsystem2) PingSubsystem1(ctx context.Context, message string) (string, error) {
+	logging.WithFields(TraceFields(ctx)).WithField("message", message).Info("subsystem2 ping_subsystem1 called")
+	return t.subsystemLibrary.Subsystem1Methods().PingCtx(ctx, message)
+}
 
-	case "process_active_leaves_update":
-		logging.WithField("args", args).Info("subsystem2 process_active_leaves_update called")
-		return nil, nil
+func (t *Subsystem2) ProcessActiveLeavesUpdate(ctx context.Context) (any, error) {
+	logging.Info("subsystem2 process_active_leaves_update called")
+	return nil, t.processActiveLeavesUpdate(ActiveLeavesUpdate{})
+}
 
+// OnSignal handles the signals broadcast by the overseer.
+func (t *Subsystem2) OnSignal(ctx context.Context, signal Signal) error {
+	switch signal := signal.(type) {
+	case ActiveLeavesUpdate:
+		return t.processActiveLeavesUpdate(signal)
 	default:
-		return nil, errors.New("method not found")
+		logging.WithField("signal", signal.SignalName()).Debug("subsystem2 ignoring signal")
+		return nil
 	}
 }
 
+func (t *Subsystem2) processActiveLeavesUpdate(update ActiveLeavesUpdate) error {
+	logging.WithFields(logging.Fields{
+		"activated":   update.Activated,
+		"deactivated": update.Deactivated,
+	}).Info("subsystem2 processing active leaves update")
+	return nil
+}
+
 func (t *Subsystem2) SetBaseSubsystem(bs *BaseSubsystem) {
 	t.bs = bs
 }
 
 func NewSubsystem2(ctx context.Context, eventBus eventbus.Bus) *BaseSubsystem {
-	ctx, cancel := context.WithCancel(context.WithValue(ctx, "subsystem", "subsystem2"))
+	parentCtx := context.WithValue(ctx, "subsystem", "subsystem2")
+	ctx, cancel := context.WithCancel(parentCtx)
 	subsystem2 := Subsystem2{
-		cancel:   cancel,
-		ctx:      ctx,
-		eventBus: eventBus,
+		cancel:    cancel,
+		ctx:       ctx,
+		parentCtx: parentCtx,
+		eventBus:  eventBus,
 	}
 	subsystem2.subsystemLibrary = NewSubsystemLibrary(subsystem2.eventBus, subsystem2.Name())
-	return NewBaseSubsystem(&subsystem2)
+	bs := NewBaseSubsystem(&subsystem2)
+	registerSubsystem2API(bs, &subsystem2)
+	return bs
 }
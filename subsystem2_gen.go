@@ -0,0 +1,146 @@
+// Code generated by subsystemgen from subsystem2.go; DO NOT EDIT.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"overseer/eventbus"
+	"reflect"
+)
+
+// Subsystem2Methods calls the methods served by subsystem2 over the event bus.
+type Subsystem2Methods interface {
+	SetOwner(owner string)
+	GetOwner() (owner string)
+	Ping(message string) (string, error)
+	PingCtx(ctx context.Context, message string) (string, error)
+	PingSubsystem1(message string) (string, error)
+	PingSubsystem1Ctx(ctx context.Context, message string) (string, error)
+	ProcessActiveLeavesUpdate() (any, error)
+	ProcessActiveLeavesUpdateCtx(ctx context.Context) (any, error)
+}
+
+type Subsystem2MethodsInstance struct {
+	owner    string
+	eventBus eventbus.Bus
+}
+
+func (m *Subsystem2MethodsInstance) GetOwner() (owner string) {
+	return m.owner
+}
+
+func (m *Subsystem2MethodsInstance) SetOwner(owner string) {
+	m.owner = owner
+}
+
+// Ping replies with "pong".
+func (m *Subsystem2MethodsInstance) Ping(message string) (string, error) {
+	return m.PingCtx(context.Background(), message)
+}
+
+func (m *Subsystem2MethodsInstance) PingCtx(ctx context.Context, message string) (string, error) {
+	var result string
+	methodResponse := SubsystemMethodCtx(ctx, m.eventBus, m.owner, "subsystem2", "ping", message)
+	if methodResponse.Error != nil {
+		return result, methodResponse.Error
+	}
+	if methodResponse.Data == nil {
+		return result, nil
+	}
+	result, ok := methodResponse.Data.(string)
+	if !ok {
+		return result, fmt.Errorf("subsystem2.ping returned %T, expected string", methodResponse.Data)
+	}
+	return result, nil
+}
+
+// PingSubsystem1 pings subsystem1 on behalf of the caller.
+func (m *Subsystem2MethodsInstance) PingSubsystem1(message string) (string, error) {
+	return m.PingSubsystem1Ctx(context.Background(), message)
+}
+
+func (m *Subsystem2MethodsInstance) PingSubsystem1Ctx(ctx context.Context, message string) (string, error) {
+	var result string
+	methodResponse := SubsystemMethodCtx(ctx, m.eventBus, m.owner, "subsystem2", "ping_subsystem1", message)
+	if methodResponse.Error != nil {
+		return result, methodResponse.Error
+	}
+	if methodResponse.Data == nil {
+		return result, nil
+	}
+	result, ok := methodResponse.Data.(string)
+	if !ok {
+		return result, fmt.Errorf("subsystem2.ping_subsystem1 returned %T, expected string", methodResponse.Data)
+	}
+	return result, nil
+}
+
+// ProcessActiveLeavesUpdate processes an empty active leaves update.
+func (m *Subsystem2MethodsInstance) ProcessActiveLeavesUpdate() (any, error) {
+	return m.ProcessActiveLeavesUpdateCtx(context.Background())
+}
+
+func (m *Subsystem2MethodsInstance) ProcessActiveLeavesUpdateCtx(ctx context.Context) (any, error) {
+	var result any
+	methodResponse := SubsystemMethodCtx(ctx, m.eventBus, m.owner, "subsystem2", "process_active_leaves_update")
+	if methodResponse.Error != nil {
+		return result, methodResponse.Error
+	}
+	if methodResponse.Data == nil {
+		return result, nil
+	}
+	return methodResponse.Data, nil
+}
+
+// registerSubsystem2API registers the methods of impl in the method registry of bs.
+func registerSubsystem2API(bs *BaseSubsystem, impl Subsystem2API) {
+	bs.registerMethod(MethodInfo{
+		Name: "ping",
+		Args: []reflect.Type{
+			reflect.TypeOf((*string)(nil)).Elem(),
+		},
+		ArgNames:    []string{"message"},
+		Result:      reflect.TypeOf((*string)(nil)).Elem(),
+		Description: "Ping replies with \"pong\".",
+	}, func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: ping expects 1 args, got %d", ErrInvalidArgs, len(args))
+		}
+		message, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: message must be string, got %T", ErrInvalidArgs, args[0])
+		}
+		return impl.Ping(ctx, message)
+	})
+	bs.registerMethod(MethodInfo{
+		Name: "ping_subsystem1",
+		Args: []reflect.Type{
+			reflect.TypeOf((*string)(nil)).Elem(),
+		},
+		ArgNames:    []string{"message"},
+		Result:      reflect.TypeOf((*string)(nil)).Elem(),
+		Description: "PingSubsystem1 pings subsystem1 on behalf of the caller.",
+	}, func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: ping_subsystem1 expects 1 args, got %d", ErrInvalidArgs, len(args))
+		}
+		message, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: message must be string, got %T", ErrInvalidArgs, args[0])
+		}
+		return impl.PingSubsystem1(ctx, message)
+	})
+	bs.registerMethod(MethodInfo{
+		Name:        "process_active_leaves_update",
+		Args:        []reflect.Type{},
+		ArgNames:    []string{},
+		Result:      reflect.TypeOf((*any)(nil)).Elem(),
+		Description: "ProcessActiveLeavesUpdate processes an empty active leaves update.",
+	}, func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%w: process_active_leaves_update expects 0 args, got %d", ErrInvalidArgs, len(args))
+		}
+		return impl.ProcessActiveLeavesUpdate(ctx)
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SubsystemState is a state in the lifecycle of a BaseSubsystem.
+type SubsystemState int
+
+const (
+	// IdleState is the state of a subsystem that has never been started.
+	IdleState SubsystemState = iota
+
+	// StartingState is the state of a subsystem while OnStart runs.
+	StartingState
+
+	// RunningState is the state of a subsystem that started successfully and accepts calls.
+	RunningState
+
+	// StoppingState is the state of a subsystem while OnStop runs.
+	StoppingState
+
+	// StoppedState is the state of a subsystem that has been stopped.
+	StoppedState
+
+	// FailedState is the state of a subsystem whose OnStart returned an error or that reported a
+	// crash with Fail.
+	FailedState
+
+	// RestartingState is the state of a stopped subsystem that the supervisor is about to start again.
+	RestartingState
+)
+
+var subsystemStateNames = map[SubsystemState]string{
+	IdleState:       "idle",
+	StartingState:   "starting",
+	RunningState:    "running",
+	StoppingState:   "stopping",
+	StoppedState:    "stopped",
+	FailedState:     "failed",
+	RestartingState: "restarting",
+}
+
+func (s SubsystemState) String() string {
+	if name, ok := subsystemStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("SubsystemState(%d)", int(s))
+}
+
+// MarshalText encodes the state by name.
+func (s SubsystemState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// subsystemTransitions lists the states each state may transition to.
+var subsystemTransitions = map[SubsystemState][]SubsystemState{
+	IdleState:       {StartingState, StoppingState},
+	StartingState:   {RunningState, FailedState},
+	RunningState:    {StoppingState, FailedState},
+	StoppingState:   {StoppedState},
+	StoppedState:    {RestartingState},
+	FailedState:     {StartingState, StoppingState},
+	RestartingState: {StartingState},
+}
+
+// CanTransition reports whether a subsystem in state s may move to state to.
+func (s SubsystemState) CanTransition(to SubsystemState) bool {
+	return slices.Contains(subsystemTransitions[s], to)
+}
+
+// StateTransition describes a change of a subsystem's state. It is passed to the functions
+// registered with BaseSubsystem.OnTransition and published on the "<subsystem>:state" topic.
+type StateTransition struct {
+	Subsystem string
+	From      SubsystemState
+	To        SubsystemState
+	Time      time.Time
+}
+
+// InvalidTransitionError is returned when a subsystem is asked to make a transition its current
+// state does not allow.
+type InvalidTransitionError struct {
+	Subsystem string
+	From      SubsystemState
+	To        SubsystemState
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("subsystem %v cannot transition from %v to %v", e.Subsystem, e.From, e.To)
+}
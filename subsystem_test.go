@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"overseer/eventbus"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseSubsystemStateMachine(t *testing.T) {
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "a", recorder: &recorder{}})
+	var transitions []StateTransition
+	bs.OnTransition(func(transition StateTransition) {
+		transitions = append(transitions, transition)
+	})
+	require.Equal(t, IdleState, bs.State())
+
+	ok, err := bs.Start()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, RunningState, bs.State())
+
+	ok, err = bs.Start()
+	require.NoError(t, err)
+	require.False(t, ok, "a running subsystem must not be started twice")
+
+	require.True(t, bs.Stop())
+	require.False(t, bs.Stop())
+	require.Equal(t, StoppedState, bs.State())
+
+	ok, err = bs.Start()
+	require.NoError(t, err)
+	require.False(t, ok, "a stopped subsystem must not be started again")
+
+	ok, err = bs.restart()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	var states []SubsystemState
+	for _, transition := range transitions {
+		states = append(states, transition.To)
+	}
+	require.Equal(t, []SubsystemState{
+		StartingState, RunningState,
+		StoppingState, StoppedState,
+		RestartingState, StartingState, RunningState,
+	}, states)
+}
+
+func TestBaseSubsystemStartFailure(t *testing.T) {
+	startErr := errors.New("boom")
+	impl := &recordingSubsystem{name: "a", startErr: startErr, recorder: &recorder{}}
+	bs := NewBaseSubsystem(impl)
+
+	_, err := bs.Start()
+	require.ErrorIs(t, err, startErr)
+	require.Equal(t, FailedState, bs.State())
+
+	impl.startErr = nil
+	ok, err := bs.Start()
+	require.NoError(t, err)
+	require.True(t, ok, "a subsystem that failed to start may be started again")
+}
+
+func TestBaseSubsystemInvalidTransition(t *testing.T) {
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "a", recorder: &recorder{}})
+	_, err := bs.transition(RunningState)
+	var invalid *InvalidTransitionError
+	require.True(t, errors.As(err, &invalid))
+	require.Equal(t, IdleState, invalid.From)
+	require.Equal(t, IdleState, bs.State())
+}
+
+func TestBaseSubsystemWaitFor(t *testing.T) {
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "a", recorder: &recorder{}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, bs.WaitFor(ctx, RunningState), context.DeadlineExceeded)
+
+	started := make(chan error, 1)
+	go func() {
+		started <- bs.WaitFor(context.Background(), StartingState)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	_, err := bs.Start()
+	require.NoError(t, err)
+	require.NoError(t, <-started)
+	require.NoError(t, bs.WaitFor(context.Background(), RunningState))
+}
+
+func TestStateTransitionsPublished(t *testing.T) {
+	bus := eventbus.New()
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "a", recorder: &recorder{}})
+	NewOverseer(bus, bs)
+
+	running := make(chan StateTransition, 1)
+	_, err := bus.Subscribe("a:"+string(StateEvent), func(data any) {
+		if transition := data.(StateTransition); transition.To == RunningState {
+			running <- transition
+		}
+	})
+	require.NoError(t, err)
+	_, err = bs.Start()
+	require.NoError(t, err)
+	transition := <-running
+	require.Equal(t, StartingState, transition.From)
+}
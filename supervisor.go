@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// RestartStrategy determines which subsystems are restarted when one of them fails.
+type RestartStrategy int
+
+const (
+	// OneForOne restarts only the failed subsystem.
+	OneForOne RestartStrategy = iota
+
+	// OneForAll restarts every running subsystem when one of them fails.
+	OneForAll
+
+	// RestForOne restarts the failed subsystem and every running subsystem started after it.
+	RestForOne
+)
+
+func (r RestartStrategy) String() string {
+	switch r {
+	case OneForOne:
+		return "one_for_one"
+	case OneForAll:
+		return "one_for_all"
+	case RestForOne:
+		return "rest_for_one"
+	default:
+		return fmt.Sprintf("RestartStrategy(%d)", int(r))
+	}
+}
+
+// SupervisorSpec configures how a Supervisor restarts failed subsystems.
+type SupervisorSpec struct {
+	Strategy RestartStrategy
+
+	// MaxRestarts is the intensity of the supervisor: the number of restarts it performs within
+	// Window, counted across all subsystems. A failure beyond it is given up on, and the failed
+	// subsystem left stopped. A zero Window disables the limit: every failure is restarted, each
+	// after MinBackoff.
+	MaxRestarts int
+	Window      time.Duration
+
+	// MinBackoff is the delay before the first restart within Window; it doubles with every
+	// further restart up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultSupervisorSpec restarts failed subsystems one for one, at most 5 times a minute.
+var DefaultSupervisorSpec = SupervisorSpec{
+	Strategy:    OneForOne,
+	MaxRestarts: 5,
+	Window:      time.Minute,
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+}
+
+// SupervisorEvent is published with RestartEvent and GiveUpEvent.
+type SupervisorEvent struct {
+	Subsystem string
+	Strategy  RestartStrategy
+	Err       error // the failure that triggered the restart, or the start error for follow-up failures
+	Restarts  int   // restarts by the supervisor within the intensity window
+	Backoff   time.Duration
+}
+
+// Supervisor restarts failed subsystems of an Overseer according to a SupervisorSpec.
+type Supervisor struct {
+	overseer *Overseer
+	spec     SupervisorSpec
+
+	lock       sync.Mutex
+	restarts   []time.Time     // restart times within the window, of any subsystem
+	pending    map[string]bool // subsystems with a restart scheduled
+	generation uint64          // incremented to abandon scheduled restarts
+}
+
+// Supervise makes the overseer restart failed subsystems according to spec, replacing any
+// previous supervisor. Subsystems report failures with BaseSubsystem.Fail; panics in Call are
+// reported automatically.
+func (s *Overseer) Supervise(spec SupervisorSpec) *Supervisor {
+	supervisor := &Supervisor{
+		overseer: s,
+		spec:     spec,
+		pending:  make(map[string]bool),
+	}
+	s.lock.Lock()
+	previous := s.supervisor
+	s.supervisor = supervisor
+	s.lock.Unlock()
+	if previous != nil {
+		previous.cancelPending()
+	}
+	return supervisor
+}
+
+// handleFailure is notified by BaseSubsystem.Fail for every registered subsystem.
+func (s *Overseer) handleFailure(bs *BaseSubsystem, err error) {
+	s.lock.RLock()
+	supervisor := s.supervisor
+	s.lock.RUnlock()
+	if supervisor == nil {
+		logging.WithField("Subsystem", bs.Name()).Warn("subsystem failed without a supervisor")
+		return
+	}
+	supervisor.handle(bs, err)
+}
+
+// cancelPending abandons every restart that has been scheduled but not performed yet.
+func (sv *Supervisor) cancelPending() {
+	sv.lock.Lock()
+	defer sv.lock.Unlock()
+	sv.generation++
+	sv.pending = make(map[string]bool)
+}
+
+func (sv *Supervisor) handle(failed *BaseSubsystem, err error) {
+	name := failed.Name()
+	sv.lock.Lock()
+	if sv.pending[name] {
+		sv.lock.Unlock()
+		return
+	}
+	now := time.Now()
+	recent := sv.restarts[:0]
+	for _, at := range sv.restarts {
+		if now.Sub(at) < sv.spec.Window {
+			recent = append(recent, at)
+		}
+	}
+	sv.restarts = recent
+	if sv.spec.Window > 0 && len(recent) >= sv.spec.MaxRestarts {
+		sv.lock.Unlock()
+		sv.giveUp(failed, err, len(recent))
+		return
+	}
+	backoff := sv.backoff(len(recent))
+	sv.restarts = append(recent, now)
+	sv.pending[name] = true
+	generation := sv.generation
+	restarts := len(sv.restarts)
+	sv.lock.Unlock()
+
+	affected, orderErr := sv.affected(failed)
+	if orderErr != nil {
+		logging.WithField("Subsystem", name).WithError(orderErr).Error("could not determine subsystems to restart")
+		affected = []*BaseSubsystem{failed}
+	}
+	logging.WithFields(logging.Fields{
+		"Subsystem": name,
+		"strategy":  sv.spec.Strategy,
+		"backoff":   backoff,
+		"restarts":  restarts,
+	}).Info("scheduling subsystem restart")
+
+	go func() {
+		for i := len(affected) - 1; i >= 0; i-- {
+			affected[i].Stop()
+		}
+		time.Sleep(backoff)
+
+		sv.lock.Lock()
+		if generation != sv.generation {
+			sv.lock.Unlock()
+			return
+		}
+		delete(sv.pending, name)
+		sv.lock.Unlock()
+
+		for _, bs := range affected {
+			_, startErr := bs.restart()
+			if startErr != nil {
+				bs.Fail(fmt.Errorf("restart failed: %w", startErr))
+				continue
+			}
+			sv.publish(bs.Name(), RestartEvent, SupervisorEvent{
+				Subsystem: bs.Name(),
+				Strategy:  sv.spec.Strategy,
+				Err:       err,
+				Restarts:  restarts,
+				Backoff:   backoff,
+			})
+		}
+	}()
+}
+
+// affected returns the subsystems to restart for a failure of failed, in start order.
+func (sv *Supervisor) affected(failed *BaseSubsystem) ([]*BaseSubsystem, error) {
+	if sv.spec.Strategy == OneForOne {
+		return []*BaseSubsystem{failed}, nil
+	}
+	order, err := sv.overseer.startOrder()
+	if err != nil {
+		return nil, err
+	}
+	var affected []*BaseSubsystem
+	after := false
+	for _, bs := range order {
+		if bs == failed {
+			after = true
+			affected = append(affected, bs)
+			continue
+		}
+		if !bs.IsRunning() {
+			continue
+		}
+		if sv.spec.Strategy == OneForAll || after {
+			affected = append(affected, bs)
+		}
+	}
+	return affected, nil
+}
+
+func (sv *Supervisor) backoff(restarts int) time.Duration {
+	backoff := sv.spec.MinBackoff
+	for i := 0; i < restarts && backoff < sv.spec.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if sv.spec.MaxBackoff > 0 && backoff > sv.spec.MaxBackoff {
+		backoff = sv.spec.MaxBackoff
+	}
+	return backoff
+}
+
+func (sv *Supervisor) giveUp(failed *BaseSubsystem, err error, restarts int) {
+	logging.WithFields(logging.Fields{
+		"Subsystem": failed.Name(),
+		"restarts":  restarts,
+		"window":    sv.spec.Window,
+	}).WithError(err).Error("giving up on subsystem")
+	failed.Stop()
+	sv.publish(failed.Name(), GiveUpEvent, SupervisorEvent{
+		Subsystem: failed.Name(),
+		Strategy:  sv.spec.Strategy,
+		Err:       err,
+		Restarts:  restarts,
+	})
+}
+
+func (sv *Supervisor) publish(name string, event Event, data SupervisorEvent) {
+	sv.overseer.eventBus.Publish(fmt.Sprintf("%v:%v", name, event), data)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"overseer/eventbus"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testSupervisorSpec = SupervisorSpec{
+	MaxRestarts: 2,
+	Window:      time.Minute,
+	MinBackoff:  time.Millisecond,
+	MaxBackoff:  10 * time.Millisecond,
+}
+
+func newSupervisedOverseer(t *testing.T, strategy RestartStrategy, rec *recorder) (*Overseer, eventbus.Bus) {
+	bus := eventbus.New()
+	overseer := NewOverseer(bus,
+		NewBaseSubsystem(&recordingSubsystem{name: "a", recorder: rec}),
+		NewBaseSubsystem(&recordingSubsystem{name: "b", deps: []string{"a"}, recorder: rec}),
+		NewBaseSubsystem(&recordingSubsystem{name: "c", deps: []string{"b"}, recorder: rec}),
+	)
+	spec := testSupervisorSpec
+	spec.Strategy = strategy
+	overseer.Supervise(spec)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	return overseer, bus
+}
+
+func awaitEvent(t *testing.T, bus eventbus.Bus, topic string) <-chan interface{} {
+	ch := make(chan interface{}, 1)
+	_, err := bus.SubscribeOnce(topic, func(data any) {
+		ch <- data
+	})
+	require.NoError(t, err)
+	return ch
+}
+
+func receive(t *testing.T, ch <-chan interface{}) SupervisorEvent {
+	select {
+	case data := <-ch:
+		return data.(SupervisorEvent)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for supervisor event")
+		return SupervisorEvent{}
+	}
+}
+
+func TestSupervisorStrategies(t *testing.T) {
+	for _, tc := range []struct {
+		strategy  RestartStrategy
+		restarted []string
+	}{
+		{OneForOne, []string{"stop:b", "start:b"}},
+		{OneForAll, []string{"stop:c", "stop:b", "stop:a", "start:a", "start:b", "start:c"}},
+		{RestForOne, []string{"stop:c", "stop:b", "start:b", "start:c"}},
+	} {
+		t.Run(tc.strategy.String(), func(t *testing.T) {
+			rec := &recorder{}
+			overseer, bus := newSupervisedOverseer(t, tc.strategy, rec)
+			last := tc.restarted[len(tc.restarted)-1][len("start:"):]
+			restarted := awaitEvent(t, bus, last+":"+string(RestartEvent))
+
+			resp := SubsystemMethod(bus, "test", "b", "panic")
+			require.Error(t, resp.Error)
+			event := receive(t, restarted)
+			require.Equal(t, 1, event.Restarts)
+
+			require.Equal(t, tc.restarted, rec.Calls()[3:])
+			for _, bs := range overseer.Subsystems {
+				require.True(t, bs.IsRunning(), bs.Name())
+			}
+		})
+	}
+}
+
+func TestSupervisorGivesUp(t *testing.T) {
+	rec := &recorder{}
+	overseer, bus := newSupervisedOverseer(t, OneForOne, rec)
+	b := overseer.Subsystems["b"]
+
+	for i := 0; i < testSupervisorSpec.MaxRestarts; i++ {
+		restarted := awaitEvent(t, bus, "b:"+string(RestartEvent))
+		b.Fail(errors.New("crashed"))
+		receive(t, restarted)
+	}
+
+	gaveUp := awaitEvent(t, bus, "b:"+string(GiveUpEvent))
+	b.Fail(errors.New("crashed again"))
+	event := receive(t, gaveUp)
+	require.Equal(t, testSupervisorSpec.MaxRestarts, event.Restarts)
+	require.False(t, b.IsRunning())
+}
+
+func TestSupervisorIntensity(t *testing.T) {
+	rec := &recorder{}
+	overseer, bus := newSupervisedOverseer(t, OneForOne, rec)
+
+	for _, name := range []string{"a", "b"} {
+		restarted := awaitEvent(t, bus, name+":"+string(RestartEvent))
+		overseer.Subsystems[name].Fail(errors.New("crashed"))
+		receive(t, restarted)
+	}
+
+	gaveUp := awaitEvent(t, bus, "c:"+string(GiveUpEvent))
+	overseer.Subsystems["c"].Fail(errors.New("crashed"))
+	event := receive(t, gaveUp)
+	require.Equal(t, testSupervisorSpec.MaxRestarts, event.Restarts)
+	require.False(t, overseer.Subsystems["c"].IsRunning())
+	require.True(t, overseer.Subsystems["a"].IsRunning())
+}
+
+func TestSupervisorWithoutWindow(t *testing.T) {
+	bus := eventbus.New()
+	b := NewBaseSubsystem(&recordingSubsystem{name: "b", recorder: &recorder{}})
+	overseer := NewOverseer(bus, b)
+	spec := testSupervisorSpec
+	spec.Window = 0
+	overseer.Supervise(spec)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+
+	for i := 0; i < 2*spec.MaxRestarts; i++ {
+		restarted := awaitEvent(t, bus, "b:"+string(RestartEvent))
+		b.Fail(errors.New("crashed"))
+		event := receive(t, restarted)
+		require.Equal(t, spec.MinBackoff, event.Backoff)
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	sv := &Supervisor{spec: SupervisorSpec{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}}
+	require.Equal(t, time.Second, sv.backoff(0))
+	require.Equal(t, 2*time.Second, sv.backoff(1))
+	require.Equal(t, 4*time.Second, sv.backoff(2))
+	require.Equal(t, 5*time.Second, sv.backoff(3))
+}
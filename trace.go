@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"overseer/eventbus"
+	"time"
+
+	logging "github.com/sirupsen/logrus"
+)
+
+// SpanContext identifies a span: a method call, part of the trace of the calls it was made for.
+// IDs are lowercase hex, 32 digits for traces and 16 for spans, as in W3C Trace Context.
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// IsValid reports whether sc identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx in which method calls are made as children of the span sc.
+func ContextWithSpan(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanFromContext returns the span of ctx: the one set with ContextWithSpan or, in the ctx handed
+// to Subsystem.Call or a registered method, the span of the request served.
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	if sc, ok := ctx.Value(spanContextKey{}).(SpanContext); ok && sc.IsValid() {
+		return sc, true
+	}
+	if methodRequest, ok := RequestFromContext(ctx); ok && methodRequest.TraceID != "" {
+		return SpanContext{TraceID: methodRequest.TraceID, SpanID: methodRequest.SpanID}, true
+	}
+	return SpanContext{}, false
+}
+
+// TraceFields returns the log fields identifying the span of ctx, if any, so that the log lines of
+// nested calls can be correlated:
+//
+//	logging.WithFields(TraceFields(ctx)).Info("ping called")
+func TraceFields(ctx context.Context) logging.Fields {
+	sc, ok := SpanFromContext(ctx)
+	if !ok {
+		return logging.Fields{}
+	}
+	return logging.Fields{"TraceID": sc.TraceID, "SpanID": sc.SpanID}
+}
+
+// startSpan gives a request without a span one, a child of the span of ctx if there is one.
+func startSpan(ctx context.Context, methodRequest MethodRequest) MethodRequest {
+	if methodRequest.TraceID == "" {
+		if parent, ok := SpanFromContext(ctx); ok {
+			methodRequest.TraceID, methodRequest.ParentSpanID = parent.TraceID, parent.SpanID
+		} else {
+			methodRequest.TraceID = randomID(16)
+		}
+	}
+	if methodRequest.SpanID == "" {
+		methodRequest.SpanID = randomID(8)
+	}
+	return methodRequest
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// TracedEvent is an event published with PublishCtx, carrying the span it was published in.
+type TracedEvent struct {
+	SpanContext
+	Data any
+}
+
+// PublishCtx publishes data on topic, wrapped in a TracedEvent if ctx has a span, see
+// SpanFromContext. Handlers unwrap it with EventData.
+func PublishCtx(ctx context.Context, eventBus eventbus.Bus, topic string, data any) error {
+	if sc, ok := SpanFromContext(ctx); ok {
+		data = TracedEvent{SpanContext: sc, Data: data}
+	}
+	return eventBus.Publish(topic, data)
+}
+
+// EventData returns the data of an event and the span it was published in, if it was published
+// with PublishCtx. A handler passes the span on with ContextWithSpan:
+//
+//	data, sc, ok := EventData(event)
+//	if ok {
+//		ctx = ContextWithSpan(ctx, sc)
+//	}
+func EventData(event any) (any, SpanContext, bool) {
+	if traced, ok := event.(TracedEvent); ok {
+		return traced.Data, traced.SpanContext, true
+	}
+	return event, SpanContext{}, false
+}
+
+// Span is a method call served, or rejected, by the overseer.
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string // empty for the root of a trace
+	Name         string // <subsystem>.<method>
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	Err          error // nil if the call succeeded
+}
+
+// SpanExporter receives the spans of the method calls an overseer routes, see
+// Overseer.SetSpanExporter. ExportSpan is called concurrently, once a call completed, so it must be
+// safe for concurrent use and should not block.
+type SpanExporter interface {
+	ExportSpan(span Span)
+}
+
+// SetSpanExporter exports the span of every method call the overseer routes to exporter, or to
+// nobody if exporter is nil. Requests carry their span IDs either way.
+func (s *Overseer) SetSpanExporter(exporter SpanExporter) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.spanExporter = exporter
+}
+
+// exportSpan exports the span of a request served since start, or rejected if start is zero.
+func (s *Overseer) exportSpan(methodRequest MethodRequest, start time.Time, err error) {
+	s.lock.RLock()
+	exporter := s.spanExporter
+	s.lock.RUnlock()
+	if exporter == nil || methodRequest.TraceID == "" {
+		return
+	}
+	end := time.Now()
+	if start.IsZero() {
+		start = end
+	}
+	exporter.ExportSpan(Span{
+		TraceID:      methodRequest.TraceID,
+		SpanID:       methodRequest.SpanID,
+		ParentSpanID: methodRequest.ParentSpanID,
+		Name:         methodRequest.Subsystem + "." + methodRequest.Method,
+		Start:        start,
+		End:          end,
+		Attributes: map[string]string{
+			"overseer.caller":     methodRequest.Caller,
+			"overseer.subsystem":  methodRequest.Subsystem,
+			"overseer.method":     methodRequest.Method,
+			"overseer.request_id": methodRequest.ID,
+		},
+		Err: err,
+	})
+}
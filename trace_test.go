@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"overseer/eventbus"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExporter struct {
+	lock  sync.Mutex
+	spans []Span
+}
+
+func (e *recordingExporter) ExportSpan(span Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *recordingExporter) Spans() []Span {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]Span(nil), e.spans...)
+}
+
+type teeExporter []SpanExporter
+
+func (t teeExporter) ExportSpan(span Span) {
+	for _, exporter := range t {
+		exporter.ExportSpan(span)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	bus := eventbus.New()
+	inner := NewBaseSubsystem(&recordingSubsystem{name: "inner", recorder: &recorder{}})
+	outer := NewBaseSubsystem(&recordingSubsystem{name: "outer", recorder: &recorder{}})
+	var nested MethodRequest
+	outer.MustRegister("fan", "", func(ctx context.Context) (string, error) {
+		resp := SubsystemMethodCtx(ctx, bus, "outer", "inner", "ping")
+		nested = resp.Request
+		return "fanned", resp.Error
+	})
+	overseer := NewOverseer(bus, inner, outer)
+	recording := &recordingExporter{}
+	path := filepath.Join(t.TempDir(), "spans.json")
+	file, err := NewOTLPFileExporter(path)
+	require.NoError(t, err)
+	overseer.SetSpanExporter(teeExporter{recording, file})
+	require.NoError(t, overseer.StartAll(context.Background()))
+	defer overseer.StopAll(context.Background())
+
+	resp := SubsystemMethod(bus, "test", "outer", "fan")
+	require.NoError(t, resp.Error)
+	root := resp.Request
+	require.Len(t, root.TraceID, 32)
+	require.Len(t, root.SpanID, 16)
+	require.Empty(t, root.ParentSpanID)
+	require.Equal(t, root.TraceID, nested.TraceID)
+	require.Equal(t, root.SpanID, nested.ParentSpanID)
+	require.NotEqual(t, root.SpanID, nested.SpanID)
+
+	spans := recording.Spans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "inner.ping", spans[0].Name)
+	require.Equal(t, nested.SpanID, spans[0].SpanID)
+	require.Equal(t, root.SpanID, spans[0].ParentSpanID)
+	require.Equal(t, "outer.fan", spans[1].Name)
+	require.Equal(t, "test", spans[1].Attributes["overseer.caller"])
+	require.False(t, spans[1].Start.After(spans[0].Start))
+	require.False(t, spans[1].End.Before(spans[0].End))
+
+	resp = SubsystemMethod(bus, "test", "inner", "panic")
+	require.Error(t, resp.Error)
+	require.NotEqual(t, root.TraceID, resp.Request.TraceID)
+	require.NoError(t, file.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var exported []otlpTraces
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var traces otlpTraces
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &traces))
+		exported = append(exported, traces)
+	}
+	require.Len(t, exported, 3)
+	span := exported[0].ResourceSpans[0].ScopeSpans[0].Spans[0]
+	require.Equal(t, root.TraceID, span.TraceID)
+	require.Equal(t, root.SpanID, span.ParentSpanID)
+	require.Equal(t, otlpSpanKindServer, span.Kind)
+	require.Equal(t, otlpStatusCodeUnset, span.Status.Code)
+	failed := exported[2].ResourceSpans[0].ScopeSpans[0].Spans[0]
+	require.Equal(t, otlpStatusCodeError, failed.Status.Code)
+	require.NotEmpty(t, failed.Status.Message)
+	require.Equal(t, "service.name", exported[2].ResourceSpans[0].Resource.Attributes[0].Key)
+}
+
+func TestOTLPFileExporterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	exporter, err := NewOTLPFileExporter(path)
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exporter.ExportSpan(Span{TraceID: randomID(16), SpanID: randomID(8), Name: "echo.ping"})
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, exporter.Close())
+	exporter.ExportSpan(Span{TraceID: randomID(16), SpanID: randomID(8), Name: "echo.late"})
+	require.NoError(t, exporter.Close())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 100, bytes.Count(b, []byte("\n")))
+	require.NotContains(t, string(b), "echo.late")
+}
+
+func TestTracedEvents(t *testing.T) {
+	bus := eventbus.New()
+	sc := SpanContext{TraceID: randomID(16), SpanID: randomID(8)}
+	var received any
+	_, err := bus.Subscribe("topic", func(data any) {
+		received = data
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, PublishCtx(ContextWithSpan(context.Background(), sc), bus, "topic", "data"))
+	data, got, ok := EventData(received)
+	require.True(t, ok)
+	require.Equal(t, "data", data)
+	require.Equal(t, sc, got)
+
+	require.NoError(t, PublishCtx(context.Background(), bus, "topic", "plain"))
+	require.Equal(t, "plain", received)
+	_, _, ok = EventData(received)
+	require.False(t, ok)
+
+	ctx := withRequest(context.Background(), MethodRequest{TraceID: sc.TraceID, SpanID: sc.SpanID})
+	require.Equal(t, sc.TraceID, TraceFields(ctx)["TraceID"])
+	require.Empty(t, TraceFields(context.Background()))
+}
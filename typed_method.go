@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// TypeMismatchError is returned when the caller and the callee of a typed method disagree on the
+// type of its request or response. It matches ErrTypeMismatch.
+type TypeMismatchError struct {
+	Subsystem string
+	Method    string
+	Kind      string // "request" or "response"
+	Expected  string
+	Actual    string
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("%v.%v: %v type mismatch: expected %v, got %v", e.Subsystem, e.Method, e.Kind, e.Expected, e.Actual)
+}
+
+func (e *TypeMismatchError) Is(target error) bool {
+	return target == ErrTypeMismatch
+}
+
+// methodHandler serves a method registered on a BaseSubsystem.
+type methodHandler func(ctx context.Context, args ...any) (any, error)
+
+// RegisterMethod registers fn to serve method on bs. Calls to a registered method are served by fn
+// instead of Subsystem.Call, and a request that is not a Req fails with a *TypeMismatchError.
+func RegisterMethod[Req, Resp any](bs *BaseSubsystem, method string, fn func(context.Context, Req) (Resp, error)) {
+	info := MethodInfo{
+		Name:   method,
+		Args:   []reflect.Type{reflect.TypeOf((*Req)(nil)).Elem()},
+		Result: reflect.TypeOf((*Resp)(nil)).Elem(),
+	}
+	bs.registerMethod(info, func(ctx context.Context, args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, &TypeMismatchError{
+				Subsystem: bs.Name(),
+				Method:    method,
+				Kind:      "request",
+				Expected:  typeName[Req](),
+				Actual:    fmt.Sprintf("%d arguments", len(args)),
+			}
+		}
+		req, ok := as[Req](args[0])
+		if !ok {
+			return nil, &TypeMismatchError{
+				Subsystem: bs.Name(),
+				Method:    method,
+				Kind:      "request",
+				Expected:  typeName[Req](),
+				Actual:    fmt.Sprintf("%T", args[0]),
+			}
+		}
+		return fn(ctx, req)
+	})
+}
+
+// Invoke calls a method registered with RegisterMethod on subsystem, on behalf of the owner of lib.
+func Invoke[Req, Resp any](lib SubsystemLibrary, subsystem string, method string, req Req) (Resp, error) {
+	return InvokeCtx[Req, Resp](context.Background(), lib, subsystem, method, req)
+}
+
+// InvokeCtx is Invoke with a context, see SubsystemMethodCtx. A response that is not a Resp fails
+// with a *TypeMismatchError.
+func InvokeCtx[Req, Resp any](ctx context.Context, lib SubsystemLibrary, subsystem string, method string, req Req) (Resp, error) {
+	var resp Resp
+	methodResponse := SubsystemMethodCtx(ctx, lib.GetEventBus(), lib.GetOwner(), subsystem, method, req)
+	if methodResponse.Error != nil {
+		return resp, methodResponse.Error
+	}
+	resp, ok := as[Resp](methodResponse.Data)
+	if !ok {
+		return resp, &TypeMismatchError{
+			Subsystem: subsystem,
+			Method:    method,
+			Kind:      "response",
+			Expected:  typeName[Resp](),
+			Actual:    fmt.Sprintf("%T", methodResponse.Data),
+		}
+	}
+	return resp, nil
+}
+
+// as converts v to T. A nil v converts to the zero value of T if T can be nil.
+func as[T any](v any) (T, bool) {
+	if v == nil {
+		var zero T
+		switch reflect.TypeOf((*T)(nil)).Elem().Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return zero, true
+		default:
+			return zero, false
+		}
+	}
+	t, ok := v.(T)
+	return t, ok
+}
+
+func typeName[T any]() string {
+	return reflect.TypeOf((*T)(nil)).Elem().String()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"overseer/eventbus"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type greetRequest struct {
+	Name string
+}
+
+type greetResponse struct {
+	Greeting string
+}
+
+func newTypedOverseer(t *testing.T) (SubsystemLibrary, *BaseSubsystem) {
+	bus := eventbus.New()
+	bs := NewBaseSubsystem(&recordingSubsystem{name: "greeter", recorder: &recorder{}})
+	RegisterMethod(bs, "greet", func(ctx context.Context, req greetRequest) (greetResponse, error) {
+		if req.Name == "" {
+			return greetResponse{}, errors.New("name is required")
+		}
+		return greetResponse{Greeting: "hello " + req.Name}, nil
+	})
+	RegisterMethod(bs, "upper", func(ctx context.Context, s string) (string, error) {
+		return strings.ToUpper(s), nil
+	})
+	overseer := NewOverseer(bus, bs)
+	require.NoError(t, overseer.StartAll(context.Background()))
+	return NewSubsystemLibrary(bus, "test"), bs
+}
+
+func TestInvokeTypedMethod(t *testing.T) {
+	lib, _ := newTypedOverseer(t)
+
+	resp, err := Invoke[greetRequest, greetResponse](lib, "greeter", "greet", greetRequest{Name: "overseer"})
+	require.NoError(t, err)
+	require.Equal(t, "hello overseer", resp.Greeting)
+
+	_, err = Invoke[greetRequest, greetResponse](lib, "greeter", "greet", greetRequest{})
+	require.EqualError(t, err, "name is required")
+
+	upper, err := Invoke[string, string](lib, "greeter", "upper", "ping")
+	require.NoError(t, err)
+	require.Equal(t, "PING", upper)
+}
+
+func TestInvokeTypeMismatch(t *testing.T) {
+	lib, _ := newTypedOverseer(t)
+
+	_, err := Invoke[string, greetResponse](lib, "greeter", "greet", "overseer")
+	require.ErrorIs(t, err, ErrTypeMismatch)
+	var mismatch *TypeMismatchError
+	require.True(t, errors.As(err, &mismatch))
+	require.Equal(t, "request", mismatch.Kind)
+	require.Equal(t, "main.greetRequest", mismatch.Expected)
+	require.Equal(t, "string", mismatch.Actual)
+
+	_, err = Invoke[greetRequest, string](lib, "greeter", "greet", greetRequest{Name: "overseer"})
+	require.ErrorIs(t, err, ErrTypeMismatch)
+	require.True(t, errors.As(err, &mismatch))
+	require.Equal(t, "response", mismatch.Kind)
+}
+
+func TestRegisteredMethodsTakePrecedence(t *testing.T) {
+	_, bs := newTypedOverseer(t)
+
+	result, err := bs.Call(context.Background(), "anything")
+	require.NoError(t, err)
+	require.Equal(t, "greeter", result, "unregistered methods fall back to Subsystem.Call")
+
+	result, err = bs.Call(context.Background(), "upper", "a")
+	require.NoError(t, err)
+	require.Equal(t, "A", result)
+}
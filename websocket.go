@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is appended to the key of a WebSocket handshake to compute its accept header,
+// see RFC 6455, section 1.3.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebSocketMessage bounds the size of a message read from a WebSocket.
+const maxWebSocketMessage = 1 << 20
+
+// wsWriteTimeout bounds how long writing a message to a WebSocket may take, so that a peer that
+// stopped reading cannot hold up the writer.
+const wsWriteTimeout = 10 * time.Second
+
+// WebSocket opcodes, see RFC 6455, section 5.2.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// errWebSocketClosed is returned by wsConn.ReadMessage once the peer closed the connection.
+var errWebSocketClosed = errors.New("websocket closed")
+
+// wsConn is a WebSocket connection, implementing the parts of RFC 6455 the gateway needs: text and
+// binary messages, fragmentation, ping and close. It has no support for extensions.
+type wsConn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	mask      bool       // masks outgoing frames, as clients must
+	writeLock sync.Mutex // guards writes to conn
+}
+
+// isWebSocketUpgrade reports whether r asks to upgrade the connection to a WebSocket.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+func headerContains(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept header answering key.
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgradeWebSocket completes the handshake of a WebSocket upgrade request and takes over its
+// connection.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "invalid websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("invalid websocket handshake")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response writer cannot be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %v\r\n\r\n", websocketAccept(key))
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings and closes on the way.
+func (c *wsConn) ReadMessage() (opcode byte, message []byte, err error) {
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.WriteMessage(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			_ = c.WriteMessage(wsClose, payload)
+			return 0, nil, errWebSocketClosed
+		case wsContinuation:
+			if opcode == 0 {
+				return 0, nil, errors.New("unexpected continuation frame")
+			}
+		case wsText, wsBinary:
+			if opcode != 0 {
+				return 0, nil, errors.New("expected continuation frame")
+			}
+			opcode = op
+		default:
+			return 0, nil, fmt.Errorf("unknown opcode %d", op)
+		}
+		if len(message)+len(payload) > maxWebSocketMessage {
+			return 0, nil, fmt.Errorf("message larger than %d bytes", maxWebSocketMessage)
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(b[:])
+	}
+	if length > maxWebSocketMessage {
+		return false, 0, nil, fmt.Errorf("frame larger than %d bytes", maxWebSocketMessage)
+	}
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.r, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage writes a message in a single frame, within wsWriteTimeout. The connection is closed
+// if the write fails, since part of the frame may have been written.
+func (c *wsConn) WriteMessage(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	maskBit := byte(0)
+	if c.mask {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if c.mask {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		frame = append(frame, key[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^key[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	err := c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err == nil {
+		_, err = c.conn.Write(frame)
+	}
+	if err != nil {
+		c.conn.Close()
+	}
+	return err
+}
+
+// Close closes the connection without a closing handshake.
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}